@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"company-api/middleware"
+)
+
+// adminScanHandler walks the whole collection one page at a time for audits.
+// Every page after the first is delayed by AdminScanDelay, so a client
+// following next_cursor cannot read faster than one page per delay.
+func (s *Server) adminScanHandler(w http.ResponseWriter, r *http.Request) {
+	cursor := r.URL.Query().Get("cursor")
+	if cursor != "" && s.config.AdminScanDelay > 0 {
+		timer := time.NewTimer(s.config.AdminScanDelay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	page, err := s.batchProcessor.ScanCompanies(ctx, s.config.AdminScanPageSize, cursor)
+	if err != nil {
+		s.sendPageError(w, ctx, err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Companies scanned successfully",
+		Data: map[string]interface{}{
+			"companies":   page.Companies,
+			"next_cursor": page.NextCursor,
+			"has_more":    page.HasMore,
+		},
+	})
+}
+
+// adminArchiveHandler lists, one page at a time, the companies created before
+// the RFC 3339 timestamp in before, for archival jobs to export
+func (s *Server) adminArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	before, err := time.Parse(time.RFC3339, r.URL.Query().Get("before"))
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "\"before\" must be an RFC 3339 timestamp",
+		})
+		return
+	}
+	limit, cursor, err := s.parsePageParams(r)
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	page, err := s.batchProcessor.CompaniesCreatedBefore(ctx, before, limit, cursor)
+	if err != nil {
+		s.sendPageError(w, ctx, err)
+		return
+	}
+	s.sendPage(w, page)
+}
+
+// adminCacheWarmHandler primes the list cache, for deploys to run before
+// taking traffic
+func (s *Server) adminCacheWarmHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := withWriteTimeout(w, r, 30*time.Second)
+	defer cancel()
+
+	result, err := s.batchProcessor.WarmListCache(ctx)
+	if errors.Is(err, middleware.ErrCacheDisabled) {
+		s.sendResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: "List cache is disabled; set LIST_CACHE_TTL to enable it",
+		})
+		return
+	}
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to warm cache", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Cache warmed successfully",
+		Data:    result,
+	})
+}
+
+// adminPurgeHandler permanently removes soft-deleted companies deleted before
+// the RFC 3339 timestamp in before
+func (s *Server) adminPurgeHandler(w http.ResponseWriter, r *http.Request) {
+	before, err := time.Parse(time.RFC3339, r.URL.Query().Get("before"))
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "\"before\" must be an RFC 3339 timestamp",
+		})
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	purged, err := s.batchProcessor.PurgeDeleted(ctx, before)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to purge companies", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Deleted companies purged successfully",
+		Data: map[string]interface{}{
+			"purged_count": purged,
+		},
+	})
+}
+
+// adminRepairTreatedHandler converts treated fields stored with the wrong
+// type, such as the string "true", into booleans so the companies decode
+// again
+func (s *Server) adminRepairTreatedHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := withWriteTimeout(w, r, 60*time.Second)
+	defer cancel()
+
+	repaired, err := s.batchProcessor.RepairTreatedType(ctx)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to repair treated field", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Treated field repaired successfully",
+		Data: map[string]interface{}{
+			"repaired_count": repaired,
+		},
+	})
+}
+
+// adminIndexesHandler lists the collection's indexes with their usage counts
+func (s *Server) adminIndexesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	indexes, err := s.batchProcessor.ListIndexes(ctx)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to list indexes", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Indexes listed successfully",
+		Data:    indexes,
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"company-api/middleware"
+)
+
+func TestAdminScanThrottle(t *testing.T) {
+	s := newTestServer(t, map[string]string{"ADMIN_SCAN_DELAY": "1h"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/admin/scan?cursor=abc", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	s.adminScanHandler(w, r)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("canceled scan waited %v for the delay", elapsed)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("canceled scan wrote %q, want nothing", w.Body.String())
+	}
+}
+
+func TestAdminScanRequiresKey(t *testing.T) {
+	s := newTestServer(t, map[string]string{"API_KEYS": "ops:s3cret"})
+	if w := serve(s, http.MethodGet, "/api/v1/admin/scan", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("scan without a key = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAdminPurgeRequiresBefore(t *testing.T) {
+	s := newTestServer(t, map[string]string{"API_KEYS": "ops:s3cret"})
+	header := http.Header{"X-Api-Key": {"s3cret"}}
+	for _, target := range []string{"/api/v1/admin/purge", "/api/v1/admin/purge?before=yesterday"} {
+		if w := serve(s, http.MethodPost, target, "", header); w.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want %d", target, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAdminArchiveValidation(t *testing.T) {
+	s := newTestServer(t, map[string]string{"API_KEYS": "ops:s3cret"})
+	header := http.Header{"X-Api-Key": {"s3cret"}}
+	for _, target := range []string{
+		"/api/v1/admin/archive",
+		"/api/v1/admin/archive?before=2024-01-01",
+		"/api/v1/admin/archive?before=2024-01-01T00:00:00Z&limit=0",
+	} {
+		if w := serve(s, http.MethodGet, target, "", header); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want %d", target, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAdminCacheWarm(t *testing.T) {
+	header := http.Header{"X-Api-Key": {"s3cret"}}
+	tests := []struct {
+		ttl  string
+		want int
+	}{
+		{"0", http.StatusConflict},
+		{"1m", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run("ttl "+tt.ttl, func(t *testing.T) {
+			var opts []middleware.Option
+			if tt.ttl != "0" {
+				opts = append(opts, middleware.WithListCacheTTL(time.Minute))
+			}
+			s := newStoreTestServer(t, map[string]string{"API_KEYS": "ops:s3cret", "LIST_CACHE_TTL": tt.ttl}, opts...)
+			if w := serve(s, http.MethodPost, "/api/v1/admin/cache/warm", "", header); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestAdminRepairTreated(t *testing.T) {
+	s := newStoreTestServer(t, map[string]string{"API_KEYS": "ops:s3cret"})
+	if w := serve(s, http.MethodPost, "/api/v1/admin/repair/treated", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("repair without a key = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w := serve(s, http.MethodPost, "/api/v1/admin/repair/treated", "", http.Header{"X-Api-Key": {"s3cret"}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"repaired_count":0`) {
+		t.Errorf("repair = %d %s, want 200 with nothing repaired", w.Code, w.Body)
+	}
+}
+
+func TestAdminIndexes(t *testing.T) {
+	s := newStoreTestServer(t, map[string]string{"API_KEYS": "ops:s3cret"})
+	if w := serve(s, http.MethodGet, "/api/v1/admin/indexes", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("indexes without a key = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w := serve(s, http.MethodGet, "/api/v1/admin/indexes", "", http.Header{"X-Api-Key": {"s3cret"}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"field":"name"`) {
+		t.Errorf("indexes = %d %s, want 200 listing the name index", w.Code, w.Body)
+	}
+}
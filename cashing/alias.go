@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"company-api/middleware"
+)
+
+// treatedAliases returns the incoming JSON keys accepted in place of
+// "treated": the X-Treated-Alias header if set, otherwise TreatedAliases
+func (s *Server) treatedAliases(r *http.Request) []string {
+	if alias := r.Header.Get("X-Treated-Alias"); alias != "" {
+		return splitList(alias)
+	}
+	return s.config.TreatedAliases
+}
+
+// decodeCompanyRequest decodes a batch body, mapping any aliased treated key
+// onto "treated". An explicit "treated" key takes precedence over aliases. A
+// bare JSON array, as produced by the backup endpoint, is accepted as the
+// list of companies.
+func decodeCompanyRequest(body io.Reader, aliases []string) (CompanyRequest, error) {
+	var req CompanyRequest
+	br, bare := peekArray(body)
+	dec := json.NewDecoder(br)
+
+	if len(aliases) == 0 {
+		if bare {
+			err := dec.Decode(&req.Companies)
+			return req, err
+		}
+		err := dec.Decode(&req)
+		return req, err
+	}
+
+	var raw struct {
+		Companies []map[string]json.RawMessage `json:"companies"`
+	}
+	var err error
+	if bare {
+		err = dec.Decode(&raw.Companies)
+	} else {
+		err = dec.Decode(&raw)
+	}
+	if err != nil {
+		return req, err
+	}
+
+	req.Companies = make([]middleware.Company, len(raw.Companies))
+	for i, fields := range raw.Companies {
+		company, err := decodeAliasedCompany(fields, aliases)
+		if err != nil {
+			return req, fmt.Errorf("company %d: %v", i, err)
+		}
+		req.Companies[i] = company
+	}
+	return req, nil
+}
+
+// importSource returns the X-Import-Source header, the source recorded for
+// companies in an upload that do not name their own
+func importSource(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get("X-Import-Source"))
+}
+
+// applySource sets source on companies that do not name their own
+func applySource(companies []middleware.Company, source string) {
+	if source == "" {
+		return
+	}
+	for i := range companies {
+		if companies[i].Source == "" {
+			companies[i].Source = source
+		}
+	}
+}
+
+// decodeAliasedCompany decodes one company's raw fields, mapping the first
+// aliased treated key present onto "treated"
+func decodeAliasedCompany(fields map[string]json.RawMessage, aliases []string) (middleware.Company, error) {
+	var company middleware.Company
+	if _, ok := fields["treated"]; !ok {
+		for _, alias := range aliases {
+			if value, ok := fields[alias]; ok {
+				fields["treated"] = value
+				break
+			}
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return company, err
+	}
+	err = json.Unmarshal(data, &company)
+	return company, err
+}
+
+// peekArray reports whether body starts, after whitespace, with a JSON array.
+// The returned reader replaces body for further reading.
+func peekArray(body io.Reader) (*bufio.Reader, bool) {
+	br := bufio.NewReader(body)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return br, false
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			br.Discard(1)
+		default:
+			return br, b[0] == '['
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"company-api/middleware"
+)
+
+func TestDecodeCompanyRequestAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		aliases []string
+		want    []bool
+	}{
+		{"no aliases", `{"companies":[{"name":"Acme","processed":true}]}`, nil, []bool{false}},
+		{"alias", `{"companies":[{"name":"Acme","processed":true}]}`, []string{"processed"}, []bool{true}},
+		{"second alias", `{"companies":[{"name":"Acme","done":true}]}`, []string{"processed", "done"}, []bool{true}},
+		{"treated wins", `{"companies":[{"name":"Acme","treated":false,"processed":true}]}`, []string{"processed"}, []bool{false}},
+		{"bare array", `  [{"name":"Acme","processed":true},{"name":"Globex"}]`, []string{"processed"}, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := decodeCompanyRequest(strings.NewReader(tt.body), tt.aliases)
+			if err != nil {
+				t.Fatalf("decodeCompanyRequest failed: %v", err)
+			}
+			if len(req.Companies) != len(tt.want) {
+				t.Fatalf("got %d companies, want %d", len(req.Companies), len(tt.want))
+			}
+			for i, company := range req.Companies {
+				if company.Treated != tt.want[i] {
+					t.Errorf("company %d treated = %v, want %v", i, company.Treated, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeCompanyRequestInvalidAliasValue(t *testing.T) {
+	body := `{"companies":[{"name":"Acme","processed":"yes"}]}`
+	if _, err := decodeCompanyRequest(strings.NewReader(body), []string{"processed"}); err == nil {
+		t.Error("a non-boolean aliased value should be rejected")
+	}
+}
+
+func TestTreatedAliases(t *testing.T) {
+	s := newTestServer(t, map[string]string{"TREATED_ALIASES": "processed,done"})
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/companies/batch", nil)
+	if got := s.treatedAliases(r); len(got) != 2 || got[0] != "processed" || got[1] != "done" {
+		t.Errorf("configured aliases = %v, want [processed done]", got)
+	}
+	r.Header.Set("X-Treated-Alias", "handled")
+	if got := s.treatedAliases(r); len(got) != 1 || got[0] != "handled" {
+		t.Errorf("header aliases = %v, want [handled]", got)
+	}
+}
+
+func TestApplySource(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/companies/batch", nil)
+	r.Header.Set("X-Import-Source", "  nightly-crm ")
+	companies := []middleware.Company{{Name: "Acme"}, {Name: "Globex", Source: "manual"}}
+	applySource(companies, importSource(r))
+	if companies[0].Source != "nightly-crm" || companies[1].Source != "manual" {
+		t.Errorf("sources = %q, %q; want nightly-crm and manual kept", companies[0].Source, companies[1].Source)
+	}
+
+	applySource(companies[:1], "")
+	if companies[0].Source != "nightly-crm" {
+		t.Errorf("an empty source replaced %q", companies[0].Source)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys := parseAPIKeys([]string{"importer:s3cret", "anonymous"})
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(keys))
+	}
+	if keys[0] != (APIKey{Name: "importer", Key: "s3cret"}) {
+		t.Errorf("named key = %+v", keys[0])
+	}
+	if keys[1].Key != "anonymous" || keys[1].Name == "anonymous" || len(keys[1].Name) != len("key-")+8 {
+		t.Errorf("unnamed key = %+v, want a hashed name that hides the key", keys[1])
+	}
+}
+
+func TestReplaceAllGuards(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		key  string
+		body string
+		want int
+	}{
+		{"no keys configured", "", "s3cret", `{"confirm":true,"companies":[{"name":"Acme"}]}`, http.StatusForbidden},
+		{"wrong key", "importer:s3cret", "guess", `{"confirm":true,"companies":[{"name":"Acme"}]}`, http.StatusUnauthorized},
+		{"unconfirmed", "importer:s3cret", "s3cret", `{"companies":[{"name":"Acme"}]}`, http.StatusBadRequest},
+		{"no companies", "importer:s3cret", "s3cret", `{"confirm":true,"companies":[]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, map[string]string{"API_KEYS": tt.keys})
+			header := http.Header{"X-Api-Key": {tt.key}}
+			w := serve(s, http.MethodPost, "/api/v1/companies/replace-all", tt.body, header)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		required string
+		path     string
+		key      string
+		want     int
+	}{
+		{"optional", "false", "/api/v1/companies", "", http.StatusNoContent},
+		{"missing key", "true", "/api/v1/companies", "", http.StatusUnauthorized},
+		{"valid key", "true", "/api/v1/companies", "s3cret", http.StatusNoContent},
+		{"exempt path", "true", "/metrics", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, map[string]string{
+				"AUTH_REQUIRED": tt.required,
+				"API_KEYS":      "importer:s3cret",
+			})
+			handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				r.Header.Set("X-API-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"company-api/middleware"
+)
+
+// backupHandler streams every company as a gzip-compressed JSON array for
+// download. Documents are encoded as they are read, so memory stays flat. A
+// failure part way leaves the gzip stream unterminated, so a truncated
+// backup fails to decompress rather than passing for a complete one.
+func (s *Server) backupHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// A full backup takes longer than the server's WriteTimeout allows
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("Unable to clear write deadline for backup", "error", err)
+	}
+
+	filename := fmt.Sprintf("companies-%s.json.gz", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	count := 0
+	if _, err := gz.Write([]byte("[")); err != nil {
+		return
+	}
+	err := s.batchProcessor.EachCompany(r.Context(), func(company middleware.Company) error {
+		if count > 0 {
+			if _, err := gz.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		count++
+		return enc.Encode(company)
+	})
+	if err == nil {
+		_, err = gz.Write([]byte("]"))
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		slog.Error("Backup failed", "written", count, "error", err)
+		return
+	}
+	slog.Info("Backup completed", "companies", count)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"company-api/middleware"
+)
+
+func TestBackupHandler(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+	seed := []middleware.Company{{Name: "Globex"}, {Name: "Acme", Address: "1 Main St"}}
+	if _, err := s.batchProcessor.ProcessBatch(context.Background(), seed, middleware.BatchOptions{}); err != nil {
+		t.Fatalf("failed to seed companies: %v", err)
+	}
+
+	w := serve(s, http.MethodGet, "/api/v1/companies/backup", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if disposition := w.Header().Get("Content-Disposition"); !strings.Contains(disposition, ".json.gz") {
+		t.Errorf("Content-Disposition = %q, want a .json.gz attachment", disposition)
+	}
+
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("backup is not gzipped: %v", err)
+	}
+	var companies []middleware.Company
+	if err := json.NewDecoder(gz).Decode(&companies); err != nil {
+		t.Fatalf("backup is not a JSON array: %v", err)
+	}
+	if len(companies) != 2 || companies[0].Name != "Acme" || companies[0].Address != "1 Main St" || companies[1].Name != "Globex" {
+		t.Errorf("backup = %+v, want Acme and Globex in name order", companies)
+	}
+}
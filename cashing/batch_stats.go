@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// histogram counts observations into buckets with fixed upper bounds, in the
+// cumulative form Prometheus uses
+type histogram struct {
+	bounds []int64
+
+	mu     sync.Mutex
+	counts []uint64 // counts[i] is observations <= bounds[i]; the last is +Inf
+	count  uint64
+	sum    int64
+}
+
+// newHistogram returns a histogram with the given ascending bucket bounds
+func newHistogram(bounds []int64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// observe records one value
+func (h *histogram) observe(v int64) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return v <= h.bounds[i] })
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.count++
+	h.sum += v
+}
+
+// histogramBucket is the number of observations at or below LE
+type histogramBucket struct {
+	LE    string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+// histogramSnapshot is a point-in-time copy of a histogram
+type histogramSnapshot struct {
+	Count   uint64            `json:"count"`
+	Sum     int64             `json:"sum"`
+	Buckets []histogramBucket `json:"buckets"`
+}
+
+// snapshot returns the histogram's cumulative bucket counts
+func (h *histogram) snapshot() histogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	snap := histogramSnapshot{
+		Count:   h.count,
+		Sum:     h.sum,
+		Buckets: make([]histogramBucket, len(h.counts)),
+	}
+	var cumulative uint64
+	for i, n := range h.counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatInt(h.bounds[i], 10)
+		}
+		snap.Buckets[i] = histogramBucket{LE: le, Count: cumulative}
+	}
+	return snap
+}
+
+// batchStats records the shape of batch uploads for capacity planning
+type batchStats struct {
+	// companies is the number of companies per batch
+	companies *histogram
+	// bytes is the decoded payload size of each batch, after decompression
+	bytes *histogram
+}
+
+// newBatchStats returns batch stats using the configured bucket bounds
+func newBatchStats(cfg *Config) *batchStats {
+	return &batchStats{
+		companies: newHistogram(cfg.BatchSizeBuckets),
+		bytes:     newHistogram(cfg.BatchBytesBuckets),
+	}
+}
+
+// observe records one decoded batch
+func (b *batchStats) observe(companies int, bytes int64) {
+	b.companies.observe(int64(companies))
+	b.bytes.observe(bytes)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// parseBuckets parses a comma-separated list of strictly ascending, positive
+// bucket bounds
+func parseBuckets(key, value string) ([]int64, error) {
+	items := splitList(value)
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%s must list at least one bucket bound", key)
+	}
+	bounds := make([]int64, len(items))
+	for i, item := range items {
+		n, err := strconv.ParseInt(item, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%s bounds must be positive integers, got %q", key, item)
+		}
+		if i > 0 && n <= bounds[i-1] {
+			return nil, fmt.Errorf("%s bounds must be ascending, got %d after %d", key, n, bounds[i-1])
+		}
+		bounds[i] = n
+	}
+	return bounds, nil
+}
+
+// adminBatchStatsHandler returns the batch size and payload size histograms
+// recorded since startup
+func (s *Server) adminBatchStatsHandler(w http.ResponseWriter, r *http.Request) {
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Batch statistics fetched successfully",
+		Data: map[string]interface{}{
+			"companies_per_batch": s.batchStats.companies.snapshot(),
+			"bytes_per_batch":     s.batchStats.bytes.snapshot(),
+		},
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]int64{1, 10, 100})
+	for _, v := range []int64{0, 1, 5, 10, 50, 1000} {
+		h.observe(v)
+	}
+
+	want := histogramSnapshot{
+		Count: 6,
+		Sum:   1066,
+		Buckets: []histogramBucket{
+			{LE: "1", Count: 2},
+			{LE: "10", Count: 4},
+			{LE: "100", Count: 5},
+			{LE: "+Inf", Count: 6},
+		},
+	}
+	if got := h.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseBuckets(t *testing.T) {
+	bounds, err := parseBuckets("BATCH_SIZE_BUCKETS", "1, 10,100")
+	if err != nil || !reflect.DeepEqual(bounds, []int64{1, 10, 100}) {
+		t.Errorf("parseBuckets = %v, %v; want [1 10 100]", bounds, err)
+	}
+	for _, value := range []string{"", "0,10", "10,10", "10,1", "1,many"} {
+		if _, err := parseBuckets("BATCH_SIZE_BUCKETS", value); err == nil {
+			t.Errorf("parseBuckets(%q) should fail", value)
+		}
+	}
+}
+
+func TestLoadConfigBatchBuckets(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"BATCH_SIZE_BUCKETS": "5,50"})
+	if !reflect.DeepEqual(cfg.BatchSizeBuckets, []int64{5, 50}) {
+		t.Errorf("BatchSizeBuckets = %v, want [5 50]", cfg.BatchSizeBuckets)
+	}
+	t.Setenv("BATCH_BYTES_BUCKETS", "100,10")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject descending BATCH_BYTES_BUCKETS")
+	}
+}
+
+func TestBatchUploadRecordsStats(t *testing.T) {
+	s := newStoreTestServer(t, map[string]string{"API_KEYS": "ops:s3cret"})
+	body := `{"companies":[{"name":"Acme"},{"name":"Globex"},{"name":"Initech"}]}`
+	if w := serve(s, http.MethodPost, "/api/v1/companies/batch", body, http.Header{"X-Api-Key": {"s3cret"}}); w.Code != http.StatusOK {
+		t.Fatalf("batch upload status = %d: %s", w.Code, w.Body)
+	}
+
+	w := serve(s, http.MethodGet, "/api/v1/admin/stats/batches", "", http.Header{"X-Api-Key": {"s3cret"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats status = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Companies histogramSnapshot `json:"companies_per_batch"`
+			Bytes     histogramSnapshot `json:"bytes_per_batch"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if got := resp.Data.Companies; got.Count != 1 || got.Sum != 3 {
+		t.Errorf("companies per batch = %+v, want one batch of 3", got)
+	}
+	if got := resp.Data.Bytes; got.Count != 1 || got.Sum != int64(len(body)) {
+		t.Errorf("bytes per batch = %+v, want one batch of %d bytes", got, len(body))
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// claimCompaniesHandler marks up to n untreated companies treated and returns
+// them, so that workers can share the untreated backlog. n defaults to 1 and
+// may not exceed MaxPageSize.
+func (s *Server) claimCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	n := 1
+	if value := r.URL.Query().Get("n"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > s.config.MaxPageSize {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("n must be between 1 and %d, got %q", s.config.MaxPageSize, value),
+			})
+			return
+		}
+		n = parsed
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	companies, err := s.batchProcessor.ClaimNextUntreatedBatch(ctx, n)
+	if err != nil {
+		// Companies claimed before the failure are already treated, so hand
+		// them over rather than leave them unprocessed
+		status := errorStatus(ctx, err)
+		s.sendResponse(w, status, APIResponse{
+			Success: false,
+			Message: s.errorMessage(status, "Failed to claim companies", err),
+			Data:    s.presentCompanies(companies),
+		})
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Claimed %d companies", len(companies)),
+		Data:    s.presentCompanies(companies),
+	})
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClaimCompaniesValidatesN(t *testing.T) {
+	s := newTestServer(t, map[string]string{"DEFAULT_PAGE_SIZE": "10", "MAX_PAGE_SIZE": "50"})
+	for _, n := range []string{"0", "-1", "51", "all"} {
+		if w := serve(s, http.MethodPost, "/api/v1/companies/claim?n="+n, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("POST /companies/claim?n=%s answered %d, want 400", n, w.Code)
+		}
+	}
+}
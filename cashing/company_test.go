@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"company-api/middleware"
+)
+
+func TestCompanyLocation(t *testing.T) {
+	tests := []struct {
+		prefix string
+		name   string
+		want   string
+	}{
+		{"/api/v1", "Acme", "/api/v1/companies/Acme"},
+		{"/api/v1", "Acme/Europe & Co", "/api/v1/companies/Acme%2FEurope%20&%20Co"},
+		{"/", "Acme", "/companies/Acme"},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t, map[string]string{"API_PREFIX": tt.prefix})
+		if got := s.companyLocation(tt.name); got != tt.want {
+			t.Errorf("companyLocation(%q) with prefix %s = %q, want %q", tt.name, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestCreateCompanyRejectsInvalid(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, body := range []string{`{"name":`, `{"address":"1 Main St"}`, `[]`} {
+		if w := serve(s, http.MethodPost, "/api/v1/companies", body, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("POST /companies %s = %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+	// The write options are validated as for a batch upload
+	for _, target := range []string{"/api/v1/companies?mode=replace", "/api/v1/companies?mode=insert"} {
+		header := http.Header{"X-Conflict-Strategy": {"skip"}}
+		if w := serve(s, http.MethodPost, target, `{"name":"Acme"}`, header); w.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want %d", target, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestCreateAndGetCompany(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+
+	w := serve(s, http.MethodPost, "/api/v1/companies", `{"name":"Acme Corp","address":"1 Main St"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	location := w.Header().Get("Location")
+	if location != "/api/v1/companies/Acme%20Corp" {
+		t.Errorf("Location = %q", location)
+	}
+
+	w = serve(s, http.MethodPost, "/api/v1/companies", `{"name":"Acme Corp","address":"2 Main St"}`, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+		t.Errorf("update = %d with Location %q, want 200 without one", w.Code, w.Header().Get("Location"))
+	}
+
+	w = serve(s, http.MethodGet, location, "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d, want %d", location, w.Code, http.StatusOK)
+	}
+	var resp struct {
+		Data middleware.Company `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.Name != "Acme Corp" || resp.Data.Address != "2 Main St" {
+		t.Errorf("company = %+v, want the updated Acme Corp", resp.Data)
+	}
+
+	if w := serve(s, http.MethodGet, "/api/v1/companies/Globex", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET unknown company = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestCreateCompanyWriteOptions(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+	if _, err := s.batchProcessor.ProcessBatch(context.Background(), []middleware.Company{{Name: "Acme", Address: "1 Main St"}}, middleware.BatchOptions{}); err != nil {
+		t.Fatalf("failed to seed companies: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+		want   int
+	}{
+		{"skip existing", "/api/v1/companies", http.Header{"X-Conflict-Strategy": {"skip"}}, http.StatusOK},
+		{"error on existing", "/api/v1/companies", http.Header{"X-Conflict-Strategy": {"error"}}, http.StatusConflict},
+		{"insert existing", "/api/v1/companies?mode=insert", nil, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, http.MethodPost, tt.target, `{"name":"Acme","address":"2 Main St"}`, tt.header)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	company, err := s.batchProcessor.GetCompany(context.Background(), "Acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if company.Address != "1 Main St" {
+		t.Errorf("address = %q, want the existing company left unchanged", company.Address)
+	}
+}
+
+func TestBatchUploadLocations(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+	if _, err := s.batchProcessor.ProcessBatch(context.Background(), []middleware.Company{{Name: "Acme"}}, middleware.BatchOptions{}); err != nil {
+		t.Fatalf("failed to seed companies: %v", err)
+	}
+
+	w := serve(s, http.MethodPost, "/api/v1/companies/batch?locations=true", `{"companies":[{"name":"Acme"},{"name":"Globex"}]}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var resp struct {
+		Data middleware.BatchResult `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Data.Locations) != 1 || resp.Data.Locations[0] != "/api/v1/companies/Globex" {
+		t.Errorf("locations = %v, want only the created Globex", resp.Data.Locations)
+	}
+}
+
+func TestGetCompanyHistoryInclude(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+	if w := serve(s, http.MethodPost, "/api/v1/companies", `{"name":"Acme","address":"1 Main St"}`, nil); w.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", w.Code, w.Body)
+	}
+	if err := s.batchProcessor.SetTreated(context.Background(), "Acme", true); err != nil {
+		t.Fatalf("SetTreated failed: %v", err)
+	}
+
+	w := serve(s, http.MethodGet, "/api/v1/companies/Acme", "", nil)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"history"`) {
+		t.Errorf("GET without include = %d %s, want the company alone", w.Code, w.Body)
+	}
+
+	w = serve(s, http.MethodGet, "/api/v1/companies/Acme?include=history", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET with include=history = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Company middleware.Company      `json:"company"`
+			History []middleware.AuditEntry `json:"history"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.Company.Name != "Acme" || len(resp.Data.History) == 0 || resp.Data.History[0].Action != "treated" {
+		t.Errorf("response = %+v, want Acme with its treated entry first", resp.Data)
+	}
+}
+
+func TestGetCompanyHistoryValidation(t *testing.T) {
+	s := newTestServer(t, map[string]string{"MAX_PAGE_SIZE": "100"})
+	for _, query := range []string{"include=audit", "include=history&history_limit=0", "include=history&history_limit=101", "include=history&history_limit=all"} {
+		if w := serve(s, http.MethodGet, "/api/v1/companies/Acme?"+query, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /companies/Acme?%s = %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"company-api/middleware"
+)
+
+// Config holds the runtime settings read from the environment
+type Config struct {
+	// LogFormat selects the slog handler: "text" or "json"
+	LogFormat string
+	// LogOutput is "stdout", "stderr" or a file path to append to
+	LogOutput string
+	// LogLevel is the minimum level that is emitted
+	LogLevel slog.Level
+	// LogSampleRates maps request paths to access log sampling rates: 1 in
+	// N requests is logged, or none for 0. Unlisted paths log every request.
+	LogSampleRates map[string]int
+	// BatchLogLevel is the level of the per-chunk batch result log; set it
+	// below LogLevel (e.g. debug) to suppress those lines
+	BatchLogLevel slog.Level
+	// MongoRetryWrites enables the driver's retryable writes
+	MongoRetryWrites bool
+	// MongoRetryReads enables the driver's retryable reads
+	MongoRetryReads bool
+	// MongoTransientRetries is how often a chunk write or company read that
+	// fails with a pool, network or failover error is retried
+	MongoTransientRetries int
+	// TrackSeen counts how many uploads have included each company. It is
+	// off by default as it makes every upsert a modification, so nothing is
+	// ever reported unchanged.
+	TrackSeen bool
+	// ListCacheTTL is how long the full company list is cached; 0 disables
+	// caching
+	ListCacheTTL time.Duration
+	// ListCacheCompress keeps the cached list gzipped in memory, trading CPU
+	// on every hit for memory
+	ListCacheCompress bool
+	// SelfTest writes and reads back a sentinel document at startup, failing
+	// startup if either does not work
+	SelfTest bool
+	// MongoAppName tags our operations in MongoDB's currentOp and logs
+	MongoAppName string
+	// IndexBuildMode is "background" (default) or "foreground"; CI uses
+	// foreground for deterministic startup index builds
+	IndexBuildMode middleware.IndexBuildMode
+	// AddressNormalization is "verbatim" (default), "whitespace" or "title"
+	AddressNormalization middleware.AddressNormalization
+	// KeepRawAddress stores each address as received next to the
+	// normalized one
+	KeepRawAddress bool
+	// IndexRaceRetries is how often a startup index build that conflicts
+	// with another replica's is retried
+	IndexRaceRetries int
+	// NameCollationLocale, if set, builds the name index with a collation of
+	// this locale and NameCollationStrength, and applies it to every lookup
+	// by name
+	NameCollationLocale   string
+	NameCollationStrength int
+	// APIPrefix is the path the API routes are mounted under
+	APIPrefix string
+	// HealthPath is the path of the health check, mounted outside APIPrefix
+	HealthPath string
+	// APIKeys are accepted in the X-API-Key header on protected endpoints.
+	// API_KEYS entries may be "name:key" to name the actor in audit records.
+	APIKeys []APIKey
+	// MultiTenant serves each tenant, named by the X-Tenant-ID header or a
+	// /tenants/{tenant} path prefix, from its own companies collection
+	MultiTenant bool
+	// Tenants lists the tenants served when MultiTenant is on. Requests for
+	// any other tenant are refused, so clients cannot create collections by
+	// inventing tenant identifiers.
+	Tenants []string
+	// AuthRequired enforces APIKeys on every endpoint, not just admin ones
+	AuthRequired bool
+	// CORSAllowedOrigins lists origins allowed to call the API; "*" allows
+	// any and an empty list disables CORS handling
+	CORSAllowedOrigins []string
+	// AllowedHosts lists the Host header values accepted, as host names
+	// without ports; "*.example.com" allows any subdomain. Empty accepts any
+	// host.
+	AllowedHosts []string
+	// ExemptPaths bypass host validation, authentication and CORS
+	// enforcement, though they still pass through logging and panic
+	// recovery. Defaults to the health check and /metrics.
+	ExemptPaths []string
+	// MaxConnections caps simultaneously accepted connections; 0 is unlimited
+	MaxConnections int
+	// MaxConcurrentPerKey caps the requests each API key may have in flight;
+	// further requests get 429. 0 is unlimited.
+	MaxConcurrentPerKey int
+	// ReadHeaderTimeout bounds how long a client may take to send request
+	// headers, closing connections held open by slowloris-style senders
+	ReadHeaderTimeout time.Duration
+	// MaxHeaderBytes caps the size of request headers
+	MaxHeaderBytes int
+	// IdleTimeout is how long an idle keep-alive connection is kept open
+	IdleTimeout time.Duration
+	// KeepAlive enables HTTP keep-alive connections
+	KeepAlive bool
+	// HSTSMaxAge, if positive, is sent in Strict-Transport-Security on
+	// HTTPS responses
+	HSTSMaxAge time.Duration
+	// HTTPSRedirect redirects plaintext requests, as reported by
+	// X-Forwarded-Proto, to https with 308
+	HTTPSRedirect bool
+	// CompressionMinSize is the smallest response body, in bytes, to gzip
+	CompressionMinSize int
+	// CompressionLevel is the gzip level: -1 (default), 1 (BestSpeed) to
+	// 9 (BestCompression), or 0 to disable compression
+	CompressionLevel int
+	// DefaultPageSize applies when a paginated request gives no limit
+	DefaultPageSize int
+	// MaxPageSize caps the limit a paginated request may ask for
+	MaxPageSize int
+	// MaxListSize is the most companies the unpaginated list returns; larger
+	// collections are refused with 413. 0 disables the check.
+	MaxListSize int
+	// MaxWriteOps caps the database writes one request may generate, such as
+	// the companies of a batch or the upserts and deletes of a bulk request;
+	// larger requests are refused with 413, except NDJSON imports, which are
+	// cut off after MaxWriteOps companies. 0 disables the check.
+	MaxWriteOps int
+	// RejectOversizedPages answers limits above MaxPageSize with 400 instead
+	// of clamping them
+	RejectOversizedPages bool
+	// AcceptEmptyBatches answers a batch upload with no companies as a
+	// successful no-op instead of 400, for clients that poll with empty batches
+	AcceptEmptyBatches bool
+	// MultiStatus answers writes where some companies failed with 207, and
+	// writes where all of them failed with 500, instead of 200 for both
+	MultiStatus bool
+	// TreatedAliases are incoming JSON keys mapped onto "treated" in batch
+	// uploads, for importers that call it "processed", "done", etc.
+	TreatedAliases []string
+	// ErrorDetail includes the underlying error in responses to unexpected
+	// failures. Turn it off in production so database internals are only
+	// logged and clients get a generic message.
+	ErrorDetail bool
+	// PublicView strips internal fields such as _id from company responses
+	PublicView bool
+	// MaxRequestTimeout caps the timeout a client may ask for with the
+	// X-Request-Timeout header
+	MaxRequestTimeout time.Duration
+	// BatchTimeout bounds processing of a synchronous batch upload, on top of
+	// the request's own lifetime
+	BatchTimeout time.Duration
+	// StreamBatchTimeout bounds a streamed batch, which outlives its request
+	// if the client disconnects; 0 means no limit
+	StreamBatchTimeout time.Duration
+	// AdminScanPageSize is the number of documents per admin scan page
+	AdminScanPageSize int
+	// AdminScanDelay throttles admin scans by delaying every page after the
+	// first
+	AdminScanDelay time.Duration
+	// UpsertFields lists the company fields batch uploads may write besides
+	// the name; empty allows all of them
+	UpsertFields []string
+	// MaxDecompressedBytes caps the size of a gzip-encoded upload after
+	// decompression
+	MaxDecompressedBytes int64
+	// BatchSizeBuckets and BatchBytesBuckets are the upper bounds of the
+	// histograms of companies per batch upload and decoded bytes per batch
+	// upload, served by /admin/stats/batches
+	BatchSizeBuckets  []int64
+	BatchBytesBuckets []int64
+	// StrictContentType rejects batch uploads that are not sent as JSON or
+	// NDJSON with 415; turn it off for clients that send no Content-Type
+	StrictContentType bool
+	// RequireContentLength rejects JSON batch uploads sent without a
+	// Content-Length, i.e. chunked, with 411; NDJSON uploads may stream
+	RequireContentLength bool
+	// MaxBodyBytes caps the size of a JSON batch upload as sent, before any
+	// decompression; larger uploads are refused with 413
+	MaxBodyBytes int64
+}
+
+// LoadConfig builds a Config from environment variables, applying defaults
+// for anything unset
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		LogFormat:    strings.ToLower(getEnv("LOG_FORMAT", "text")),
+		LogOutput:    getEnv("LOG_OUTPUT", "stdout"),
+		APIKeys:      parseAPIKeys(splitList(os.Getenv("API_KEYS"))),
+		MongoAppName: getEnv("MONGO_APP_NAME", "company-api"),
+	}
+
+	var err error
+	if cfg.APIPrefix, err = parsePath("API_PREFIX", getEnv("API_PREFIX", "/api/v1")); err != nil {
+		return nil, err
+	}
+	if cfg.HealthPath, err = parsePath("HEALTH_PATH", getEnv("HEALTH_PATH", "/health")); err != nil {
+		return nil, err
+	}
+
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return nil, fmt.Errorf("LOG_FORMAT must be \"text\" or \"json\", got %q", cfg.LogFormat)
+	}
+
+	if cfg.LogLevel, err = parseLogLevel("LOG_LEVEL", getEnv("LOG_LEVEL", "info")); err != nil {
+		return nil, err
+	}
+	if cfg.BatchLogLevel, err = parseLogLevel("BATCH_LOG_LEVEL", getEnv("BATCH_LOG_LEVEL", "info")); err != nil {
+		return nil, err
+	}
+	if cfg.LogSampleRates, err = parseSampleRates(splitList(os.Getenv("LOG_SAMPLE_RATES"))); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxConnections, err = getEnvInt("MAX_CONNECTIONS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MaxConnections < 0 {
+		return nil, fmt.Errorf("MAX_CONNECTIONS must not be negative, got %d", cfg.MaxConnections)
+	}
+	if cfg.MaxConcurrentPerKey, err = getEnvInt("MAX_CONCURRENT_PER_KEY", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MaxConcurrentPerKey < 0 {
+		return nil, fmt.Errorf("MAX_CONCURRENT_PER_KEY must not be negative, got %d", cfg.MaxConcurrentPerKey)
+	}
+
+	if cfg.ReadHeaderTimeout, err = getEnvDuration("READ_HEADER_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ReadHeaderTimeout <= 0 {
+		return nil, fmt.Errorf("READ_HEADER_TIMEOUT must be positive, got %v", cfg.ReadHeaderTimeout)
+	}
+	if cfg.MaxHeaderBytes, err = getEnvInt("MAX_HEADER_BYTES", http.DefaultMaxHeaderBytes); err != nil {
+		return nil, err
+	}
+	if cfg.MaxHeaderBytes <= 0 {
+		return nil, fmt.Errorf("MAX_HEADER_BYTES must be positive, got %d", cfg.MaxHeaderBytes)
+	}
+	if cfg.IdleTimeout, err = getEnvDuration("IDLE_TIMEOUT", 60*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.KeepAlive, err = getEnvBool("KEEP_ALIVE", true); err != nil {
+		return nil, err
+	}
+	if cfg.HSTSMaxAge, err = getEnvDuration("HSTS_MAX_AGE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.HSTSMaxAge < 0 {
+		return nil, fmt.Errorf("HSTS_MAX_AGE must not be negative, got %v", cfg.HSTSMaxAge)
+	}
+	if cfg.HTTPSRedirect, err = getEnvBool("HTTPS_REDIRECT", false); err != nil {
+		return nil, err
+	}
+
+	if cfg.CompressionMinSize, err = getEnvInt("COMPRESSION_MIN_SIZE", 1024); err != nil {
+		return nil, err
+	}
+	if cfg.CompressionMinSize < 0 {
+		return nil, fmt.Errorf("COMPRESSION_MIN_SIZE must not be negative, got %d", cfg.CompressionMinSize)
+	}
+	if cfg.CompressionLevel, err = getEnvInt("COMPRESSION_LEVEL", gzip.DefaultCompression); err != nil {
+		return nil, err
+	}
+	if cfg.CompressionLevel < gzip.DefaultCompression || cfg.CompressionLevel > gzip.BestCompression {
+		return nil, fmt.Errorf("COMPRESSION_LEVEL must be between %d and %d, got %d",
+			gzip.DefaultCompression, gzip.BestCompression, cfg.CompressionLevel)
+	}
+
+	if cfg.MongoRetryWrites, err = getEnvBool("MONGO_RETRY_WRITES", true); err != nil {
+		return nil, err
+	}
+	if cfg.MongoRetryReads, err = getEnvBool("MONGO_RETRY_READS", true); err != nil {
+		return nil, err
+	}
+	if cfg.MongoTransientRetries, err = getEnvInt("MONGO_TRANSIENT_RETRIES", 2); err != nil {
+		return nil, err
+	}
+	if cfg.MongoTransientRetries < 0 {
+		return nil, fmt.Errorf("MONGO_TRANSIENT_RETRIES must not be negative, got %d", cfg.MongoTransientRetries)
+	}
+	if cfg.TrackSeen, err = getEnvBool("TRACK_SEEN", false); err != nil {
+		return nil, err
+	}
+	if cfg.SelfTest, err = getEnvBool("SELF_TEST", false); err != nil {
+		return nil, err
+	}
+	if cfg.IndexBuildMode, err = middleware.ParseIndexBuildMode(os.Getenv("INDEX_BUILD_MODE")); err != nil {
+		return nil, fmt.Errorf("INDEX_BUILD_MODE: %v", err)
+	}
+	if cfg.AddressNormalization, err = middleware.ParseAddressNormalization(os.Getenv("ADDRESS_NORMALIZATION")); err != nil {
+		return nil, fmt.Errorf("ADDRESS_NORMALIZATION: %v", err)
+	}
+	if cfg.KeepRawAddress, err = getEnvBool("KEEP_RAW_ADDRESS", false); err != nil {
+		return nil, err
+	}
+	if cfg.IndexRaceRetries, err = getEnvInt("INDEX_RACE_RETRIES", 3); err != nil {
+		return nil, err
+	}
+	if cfg.IndexRaceRetries < 0 {
+		return nil, fmt.Errorf("INDEX_RACE_RETRIES must not be negative, got %d", cfg.IndexRaceRetries)
+	}
+	cfg.NameCollationLocale = os.Getenv("NAME_COLLATION_LOCALE")
+	if cfg.NameCollationStrength, err = getEnvInt("NAME_COLLATION_STRENGTH", 2); err != nil {
+		return nil, err
+	}
+	if cfg.ListCacheTTL, err = getEnvDuration("LIST_CACHE_TTL", 0); err != nil {
+		return nil, err
+	}
+	if cfg.ListCacheTTL < 0 {
+		return nil, fmt.Errorf("LIST_CACHE_TTL must not be negative, got %v", cfg.ListCacheTTL)
+	}
+	if cfg.ListCacheCompress, err = getEnvBool("LIST_CACHE_COMPRESS", false); err != nil {
+		return nil, err
+	}
+
+	if cfg.MultiTenant, err = getEnvBool("MULTI_TENANT", false); err != nil {
+		return nil, err
+	}
+	for _, tenant := range splitList(os.Getenv("TENANTS")) {
+		if tenant, err = middleware.ParseTenant(tenant); err != nil {
+			return nil, fmt.Errorf("TENANTS: %v", err)
+		}
+		cfg.Tenants = append(cfg.Tenants, tenant)
+	}
+	if cfg.MultiTenant && len(cfg.Tenants) == 0 {
+		return nil, fmt.Errorf("TENANTS must list the tenants to serve when MULTI_TENANT is enabled")
+	}
+	if cfg.AuthRequired, err = getEnvBool("AUTH_REQUIRED", false); err != nil {
+		return nil, err
+	}
+	cfg.CORSAllowedOrigins = splitList(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	cfg.AllowedHosts = splitList(os.Getenv("ALLOWED_HOSTS"))
+	cfg.ExemptPaths = splitList(getEnv("EXEMPT_PATHS", cfg.HealthPath+",/metrics"))
+
+	if cfg.DefaultPageSize, err = getEnvInt("DEFAULT_PAGE_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if cfg.MaxPageSize, err = getEnvInt("MAX_PAGE_SIZE", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.DefaultPageSize <= 0 || cfg.MaxPageSize <= 0 {
+		return nil, fmt.Errorf("DEFAULT_PAGE_SIZE and MAX_PAGE_SIZE must be positive")
+	}
+	if cfg.DefaultPageSize > cfg.MaxPageSize {
+		return nil, fmt.Errorf("DEFAULT_PAGE_SIZE (%d) must not exceed MAX_PAGE_SIZE (%d)", cfg.DefaultPageSize, cfg.MaxPageSize)
+	}
+	if cfg.MaxListSize, err = getEnvInt("MAX_LIST_SIZE", 10000); err != nil {
+		return nil, err
+	}
+	if cfg.MaxListSize < 0 {
+		return nil, fmt.Errorf("MAX_LIST_SIZE must not be negative, got %d", cfg.MaxListSize)
+	}
+	if cfg.MaxWriteOps, err = getEnvInt("MAX_WRITE_OPS", 100000); err != nil {
+		return nil, err
+	}
+	if cfg.MaxWriteOps < 0 {
+		return nil, fmt.Errorf("MAX_WRITE_OPS must not be negative, got %d", cfg.MaxWriteOps)
+	}
+	switch policy := getEnv("PAGE_SIZE_POLICY", "clamp"); policy {
+	case "clamp":
+	case "reject":
+		cfg.RejectOversizedPages = true
+	default:
+		return nil, fmt.Errorf("PAGE_SIZE_POLICY must be \"clamp\" or \"reject\", got %q", policy)
+	}
+	switch policy := getEnv("EMPTY_BATCH_POLICY", "reject"); policy {
+	case "reject":
+	case "accept":
+		cfg.AcceptEmptyBatches = true
+	default:
+		return nil, fmt.Errorf("EMPTY_BATCH_POLICY must be \"reject\" or \"accept\", got %q", policy)
+	}
+	switch policy := getEnv("PARTIAL_SUCCESS_STATUS", "207"); policy {
+	case "207":
+		cfg.MultiStatus = true
+	case "200":
+	default:
+		return nil, fmt.Errorf("PARTIAL_SUCCESS_STATUS must be \"207\" or \"200\", got %q", policy)
+	}
+
+	if cfg.AdminScanPageSize, err = getEnvInt("ADMIN_SCAN_PAGE_SIZE", 500); err != nil {
+		return nil, err
+	}
+	if cfg.AdminScanPageSize <= 0 {
+		return nil, fmt.Errorf("ADMIN_SCAN_PAGE_SIZE must be positive, got %d", cfg.AdminScanPageSize)
+	}
+	if cfg.AdminScanDelay, err = getEnvDuration("ADMIN_SCAN_DELAY", time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.AdminScanDelay < 0 {
+		return nil, fmt.Errorf("ADMIN_SCAN_DELAY must not be negative, got %v", cfg.AdminScanDelay)
+	}
+
+	if cfg.BatchSizeBuckets, err = parseBuckets("BATCH_SIZE_BUCKETS", getEnv("BATCH_SIZE_BUCKETS", "1,10,100,1000,10000,100000")); err != nil {
+		return nil, err
+	}
+	if cfg.BatchBytesBuckets, err = parseBuckets("BATCH_BYTES_BUCKETS", getEnv("BATCH_BYTES_BUCKETS", "1024,16384,131072,1048576,8388608,67108864")); err != nil {
+		return nil, err
+	}
+
+	cfg.TreatedAliases = splitList(os.Getenv("TREATED_ALIASES"))
+	cfg.UpsertFields = splitList(os.Getenv("UPSERT_FIELDS"))
+
+	if cfg.PublicView, err = getEnvBool("PUBLIC_VIEW", true); err != nil {
+		return nil, err
+	}
+	if cfg.ErrorDetail, err = getEnvBool("ERROR_DETAIL", true); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxRequestTimeout, err = getEnvDuration("MAX_REQUEST_TIMEOUT", 2*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.MaxRequestTimeout <= 0 {
+		return nil, fmt.Errorf("MAX_REQUEST_TIMEOUT must be positive, got %v", cfg.MaxRequestTimeout)
+	}
+	if cfg.BatchTimeout, err = getEnvDuration("BATCH_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.BatchTimeout <= 0 {
+		return nil, fmt.Errorf("BATCH_TIMEOUT must be positive, got %v", cfg.BatchTimeout)
+	}
+	if cfg.StreamBatchTimeout, err = getEnvDuration("STREAM_BATCH_TIMEOUT", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.StreamBatchTimeout < 0 {
+		return nil, fmt.Errorf("STREAM_BATCH_TIMEOUT must not be negative, got %v", cfg.StreamBatchTimeout)
+	}
+	if cfg.StrictContentType, err = getEnvBool("STRICT_CONTENT_TYPE", true); err != nil {
+		return nil, err
+	}
+	if cfg.RequireContentLength, err = getEnvBool("REQUIRE_CONTENT_LENGTH", false); err != nil {
+		return nil, err
+	}
+	maxDecompressed, err := getEnvInt("MAX_DECOMPRESSED_BYTES", 256<<20)
+	if err != nil {
+		return nil, err
+	}
+	if maxDecompressed <= 0 {
+		return nil, fmt.Errorf("MAX_DECOMPRESSED_BYTES must be positive, got %d", maxDecompressed)
+	}
+	cfg.MaxDecompressedBytes = int64(maxDecompressed)
+	maxBody, err := getEnvInt("MAX_BODY_BYTES", 64<<20)
+	if err != nil {
+		return nil, err
+	}
+	if maxBody <= 0 {
+		return nil, fmt.Errorf("MAX_BODY_BYTES must be positive, got %d", maxBody)
+	}
+	cfg.MaxBodyBytes = int64(maxBody)
+
+	return cfg, nil
+}
+
+// parseLogLevel maps a level name (debug, info, warn, error) to a slog.Level
+func parseLogLevel(key, value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("%s must be one of debug, info, warn, error, got %q", key, value)
+	}
+	return level, nil
+}
+
+// parsePath validates a configured URL path and strips any trailing slash
+func parsePath(key, value string) (string, error) {
+	if !strings.HasPrefix(value, "/") {
+		return "", fmt.Errorf("%s must start with \"/\", got %q", key, value)
+	}
+	if trimmed := strings.TrimRight(value, "/"); trimmed != "" {
+		return trimmed, nil
+	}
+	return "/", nil
+}
+
+// getEnv returns the value of an environment variable or a default
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt returns the integer value of an environment variable or a default
+func getEnvInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer, got %q", key, value)
+	}
+	return n, nil
+}
+
+// getEnvDuration returns the duration value (e.g. "30s") of an environment
+// variable or a default
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration such as \"30s\", got %q", key, value)
+	}
+	return d, nil
+}
+
+// getEnvBool returns the boolean value of an environment variable or a default
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean, got %q", key, value)
+	}
+	return b, nil
+}
+
+// splitList parses a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
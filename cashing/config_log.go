@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+
+	"company-api/middleware"
+)
+
+// mongoSettings are the MongoDB connection and batching settings the server
+// starts with
+type mongoSettings struct {
+	URI        string
+	Database   string
+	Collection string
+	BatchSize  int
+	Workers    int
+}
+
+// defaultMongoSettings are the settings used by main
+var defaultMongoSettings = mongoSettings{
+	URI:        "mongodb://localhost:27017",
+	Database:   "companies_db",
+	Collection: "companies",
+	BatchSize:  100,
+	Workers:    4,
+}
+
+// logEffectiveConfig writes one line listing the configuration that took
+// effect, defaults included, so a misconfigured instance can be diagnosed
+// from its startup log
+func logEffectiveConfig(cfg *Config, store mongoSettings) {
+	slog.Info("Effective configuration", configSummary(cfg, store)...)
+}
+
+// configSummary returns the effective configuration as slog attributes.
+// Secrets are left out: the URI's password is redacted and only the number of
+// API keys is given.
+func configSummary(cfg *Config, store mongoSettings) []any {
+	return []any{
+		slog.Group("mongo",
+			"uri", redactURI(store.URI),
+			"database", store.Database,
+			"collection", store.Collection,
+			"pool_size", middleware.MaxPoolSize(store.Workers),
+			"app_name", cfg.MongoAppName,
+			"retry_writes", cfg.MongoRetryWrites,
+			"retry_reads", cfg.MongoRetryReads,
+			"transient_retries", cfg.MongoTransientRetries,
+			"index_build_mode", cfg.IndexBuildMode,
+		),
+		slog.Group("batch",
+			"size", store.BatchSize,
+			"workers", store.Workers,
+			"timeout", cfg.BatchTimeout,
+			"stream_timeout", cfg.StreamBatchTimeout,
+			"upsert_fields", cfg.UpsertFields,
+			"track_seen", cfg.TrackSeen,
+			"address_normalization", cfg.AddressNormalization,
+			"keep_raw_address", cfg.KeepRawAddress,
+			"max_write_ops", cfg.MaxWriteOps,
+			"require_content_length", cfg.RequireContentLength,
+			"max_body_bytes", cfg.MaxBodyBytes,
+			"multi_status", cfg.MultiStatus,
+		),
+		slog.Group("http",
+			"addr", serverAddr,
+			"api_prefix", cfg.APIPrefix,
+			"health_path", cfg.HealthPath,
+			"allowed_hosts", cfg.AllowedHosts,
+			"read_header_timeout", cfg.ReadHeaderTimeout,
+			"read_timeout", serverReadTimeout,
+			"write_timeout", serverWriteTimeout,
+			"idle_timeout", cfg.IdleTimeout,
+			"max_request_timeout", cfg.MaxRequestTimeout,
+			"max_connections", cfg.MaxConnections,
+		),
+		slog.Group("auth",
+			"required", cfg.AuthRequired,
+			"api_keys", len(cfg.APIKeys),
+			"max_concurrent_per_key", cfg.MaxConcurrentPerKey,
+		),
+		"multi_tenant", cfg.MultiTenant,
+		"tenants", len(cfg.Tenants),
+		"list_cache_ttl", cfg.ListCacheTTL,
+		"list_cache_compress", cfg.ListCacheCompress,
+		"log_level", cfg.LogLevel,
+		"error_detail", cfg.ErrorDetail,
+	}
+}
+
+// redactURI replaces the password in a MongoDB connection string. The
+// userinfo is located by hand because url.Parse rejects the comma-separated
+// host lists replica set URIs use.
+func redactURI(uri string) string {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return uri
+	}
+	authority, path := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		authority, path = rest[:i], rest[i:]
+	}
+	at := strings.LastIndex(authority, "@")
+	if at < 0 {
+		return uri
+	}
+	user, _, hasPassword := strings.Cut(authority[:at], ":")
+	if !hasPassword {
+		return uri
+	}
+	return scheme + "://" + user + ":xxxxx" + authority[at:] + path
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"company-api/middleware"
+)
+
+func TestLoadConfigTrackSeen(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.TrackSeen {
+		t.Error("TRACK_SEEN should default to false")
+	}
+	if cfg := testConfig(t, map[string]string{"TRACK_SEEN": "true"}); !cfg.TrackSeen {
+		t.Error("TRACK_SEEN=true should enable the seen counter")
+	}
+}
+
+func TestLoadConfigMaxBodyBytes(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.MaxBodyBytes != 64<<20 {
+		t.Errorf("MAX_BODY_BYTES default = %d, want %d", cfg.MaxBodyBytes, 64<<20)
+	}
+	t.Setenv("MAX_BODY_BYTES", "0")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("MAX_BODY_BYTES=0 should be rejected")
+	}
+}
+
+func TestLoadConfigLogging(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		valid bool
+	}{
+		{"defaults", nil, true},
+		{"json upper case", map[string]string{"LOG_FORMAT": "JSON"}, true},
+		{"unknown format", map[string]string{"LOG_FORMAT": "xml"}, false},
+		{"debug level", map[string]string{"LOG_LEVEL": "debug"}, true},
+		{"unknown level", map[string]string{"LOG_LEVEL": "verbose"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			if _, err := LoadConfig(); (err == nil) != tt.valid {
+				t.Errorf("LoadConfig error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		valid bool
+	}{
+		{"/api/v1", "/api/v1", true},
+		{"/api/v2/", "/api/v2", true},
+		{"/", "/", true},
+		{"//", "/", true},
+		{"api", "", false},
+	}
+	for _, tt := range tests {
+		got, err := parsePath("API_PREFIX", tt.value)
+		if (err == nil) != tt.valid || got != tt.want {
+			t.Errorf("parsePath(%q) = %q, %v; want %q, valid %v", tt.value, got, err, tt.want, tt.valid)
+		}
+	}
+}
+
+func TestLoadConfigMaxConnections(t *testing.T) {
+	if cfg := testConfig(t, map[string]string{"MAX_CONNECTIONS": "8"}); cfg.MaxConnections != 8 {
+		t.Errorf("MaxConnections = %d, want 8", cfg.MaxConnections)
+	}
+	for _, value := range []string{"-1", "many"} {
+		t.Setenv("MAX_CONNECTIONS", value)
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("MAX_CONNECTIONS=%s should be rejected", value)
+		}
+	}
+}
+
+func TestLoadConfigCompression(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"COMPRESSION_MIN_SIZE": "-1"},
+		{"COMPRESSION_LEVEL": "10"},
+		{"COMPRESSION_LEVEL": "-2"},
+	} {
+		t.Run(fmt.Sprint(env), func(t *testing.T) {
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			if _, err := LoadConfig(); err == nil {
+				t.Errorf("LoadConfig should reject %v", env)
+			}
+		})
+	}
+}
+
+func TestLoadConfigBatchTimeouts(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"BATCH_TIMEOUT": "2m", "STREAM_BATCH_TIMEOUT": "0"})
+	if cfg.BatchTimeout != 2*time.Minute || cfg.StreamBatchTimeout != 0 {
+		t.Errorf("timeouts = %v, %v; want 2m0s, 0s", cfg.BatchTimeout, cfg.StreamBatchTimeout)
+	}
+	for _, env := range []map[string]string{
+		{"BATCH_TIMEOUT": "0"},
+		{"BATCH_TIMEOUT": "30"},
+		{"STREAM_BATCH_TIMEOUT": "-1s"},
+	} {
+		t.Run(fmt.Sprint(env), func(t *testing.T) {
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			if _, err := LoadConfig(); err == nil {
+				t.Errorf("LoadConfig should reject %v", env)
+			}
+		})
+	}
+}
+
+func TestLoadConfigServerLimits(t *testing.T) {
+	cfg := testConfig(t, nil)
+	if cfg.ReadHeaderTimeout != 5*time.Second || cfg.MaxHeaderBytes != http.DefaultMaxHeaderBytes ||
+		cfg.IdleTimeout != time.Minute || !cfg.KeepAlive {
+		t.Errorf("defaults = %v, %d, %v, %v", cfg.ReadHeaderTimeout, cfg.MaxHeaderBytes, cfg.IdleTimeout, cfg.KeepAlive)
+	}
+	for _, env := range []map[string]string{
+		{"READ_HEADER_TIMEOUT": "0s"},
+		{"MAX_HEADER_BYTES": "0"},
+		{"IDLE_TIMEOUT": "soon"},
+		{"KEEP_ALIVE": "maybe"},
+	} {
+		t.Run(fmt.Sprint(env), func(t *testing.T) {
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			if _, err := LoadConfig(); err == nil {
+				t.Errorf("LoadConfig should reject %v", env)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPageSizes(t *testing.T) {
+	cfg := testConfig(t, nil)
+	if cfg.DefaultPageSize != 100 || cfg.MaxPageSize != 1000 || cfg.RejectOversizedPages {
+		t.Errorf("defaults = %d, %d, reject %v", cfg.DefaultPageSize, cfg.MaxPageSize, cfg.RejectOversizedPages)
+	}
+	for _, env := range []map[string]string{
+		{"DEFAULT_PAGE_SIZE": "0"},
+		{"MAX_PAGE_SIZE": "-5"},
+		{"DEFAULT_PAGE_SIZE": "200", "MAX_PAGE_SIZE": "100"},
+		{"PAGE_SIZE_POLICY": "truncate"},
+	} {
+		t.Run(fmt.Sprint(env), func(t *testing.T) {
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			if _, err := LoadConfig(); err == nil {
+				t.Errorf("LoadConfig should reject %v", env)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMongoRetries(t *testing.T) {
+	if cfg := testConfig(t, nil); !cfg.MongoRetryWrites || !cfg.MongoRetryReads {
+		t.Error("retryable writes and reads should default to on")
+	}
+	cfg := testConfig(t, map[string]string{"MONGO_RETRY_WRITES": "false", "MONGO_RETRY_READS": "0"})
+	if cfg.MongoRetryWrites || cfg.MongoRetryReads {
+		t.Error("MONGO_RETRY_WRITES and MONGO_RETRY_READS should turn retries off")
+	}
+}
+
+func TestLoadConfigMongoAppName(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.MongoAppName != "company-api" {
+		t.Errorf("MongoAppName default = %q, want company-api", cfg.MongoAppName)
+	}
+	if cfg := testConfig(t, map[string]string{"MONGO_APP_NAME": "importer-eu"}); cfg.MongoAppName != "importer-eu" {
+		t.Errorf("MongoAppName = %q, want importer-eu", cfg.MongoAppName)
+	}
+}
+
+func TestLoadConfigUpsertFields(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"UPSERT_FIELDS": "address, treated"})
+	if fmt.Sprint(cfg.UpsertFields) != "[address treated]" {
+		t.Errorf("UpsertFields = %q, want [address treated]", cfg.UpsertFields)
+	}
+}
+
+func TestLoadConfigBatchLogLevel(t *testing.T) {
+	if cfg := testConfig(t, map[string]string{"BATCH_LOG_LEVEL": "debug"}); cfg.BatchLogLevel != slog.LevelDebug {
+		t.Errorf("BatchLogLevel = %v, want debug", cfg.BatchLogLevel)
+	}
+	t.Setenv("BATCH_LOG_LEVEL", "chatty")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "BATCH_LOG_LEVEL") {
+		t.Errorf("LoadConfig error = %v, want BATCH_LOG_LEVEL rejected", err)
+	}
+}
+
+func TestLoadConfigSelfTest(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.SelfTest {
+		t.Error("SelfTest should default to off")
+	}
+	if cfg := testConfig(t, map[string]string{"SELF_TEST": "true"}); !cfg.SelfTest {
+		t.Error("SELF_TEST=true should turn the self-test on")
+	}
+}
+
+func TestLoadConfigAdminScan(t *testing.T) {
+	cfg := testConfig(t, nil)
+	if cfg.AdminScanPageSize != 500 || cfg.AdminScanDelay != time.Second {
+		t.Errorf("admin scan defaults = %d, %v, want 500, 1s", cfg.AdminScanPageSize, cfg.AdminScanDelay)
+	}
+
+	for _, env := range []map[string]string{
+		{"ADMIN_SCAN_PAGE_SIZE": "0"},
+		{"ADMIN_SCAN_DELAY": "-1s"},
+	} {
+		t.Run(fmt.Sprint(env), func(t *testing.T) {
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			if _, err := LoadConfig(); err == nil {
+				t.Errorf("LoadConfig should reject %v", env)
+			}
+		})
+	}
+}
+
+func TestLoadConfigListCacheTTL(t *testing.T) {
+	if cfg := testConfig(t, map[string]string{"LIST_CACHE_TTL": "30s"}); cfg.ListCacheTTL != 30*time.Second {
+		t.Errorf("ListCacheTTL = %v, want 30s", cfg.ListCacheTTL)
+	}
+	t.Setenv("LIST_CACHE_TTL", "-1s")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject a negative LIST_CACHE_TTL")
+	}
+}
+
+func TestLoadConfigMaxDecompressedBytes(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.MaxDecompressedBytes != 256<<20 {
+		t.Errorf("MaxDecompressedBytes default = %d, want %d", cfg.MaxDecompressedBytes, 256<<20)
+	}
+	t.Setenv("MAX_DECOMPRESSED_BYTES", "0")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject MAX_DECOMPRESSED_BYTES=0")
+	}
+}
+
+func TestLoadConfigLogSampleRates(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"LOG_SAMPLE_RATES": "/health/=10"})
+	if cfg.LogSampleRates["/health"] != 10 {
+		t.Errorf("LogSampleRates = %v, want /health sampled 1 in 10", cfg.LogSampleRates)
+	}
+	t.Setenv("LOG_SAMPLE_RATES", "/health")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "LOG_SAMPLE_RATES") {
+		t.Errorf("LoadConfig error = %v, want LOG_SAMPLE_RATES rejected", err)
+	}
+}
+
+func TestLoadConfigMaxListSize(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.MaxListSize != 10000 {
+		t.Errorf("MaxListSize default = %d, want 10000", cfg.MaxListSize)
+	}
+	if cfg := testConfig(t, map[string]string{"MAX_LIST_SIZE": "0"}); cfg.MaxListSize != 0 {
+		t.Errorf("MaxListSize = %d, want 0 to disable the check", cfg.MaxListSize)
+	}
+	t.Setenv("MAX_LIST_SIZE", "-1")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject a negative MAX_LIST_SIZE")
+	}
+}
+
+func TestLoadConfigIndexBuildMode(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.IndexBuildMode != middleware.IndexBuildBackground {
+		t.Errorf("IndexBuildMode default = %q, want background", cfg.IndexBuildMode)
+	}
+	if cfg := testConfig(t, map[string]string{"INDEX_BUILD_MODE": "foreground"}); cfg.IndexBuildMode != middleware.IndexBuildForeground {
+		t.Errorf("IndexBuildMode = %q, want foreground", cfg.IndexBuildMode)
+	}
+	t.Setenv("INDEX_BUILD_MODE", "eventually")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "INDEX_BUILD_MODE") {
+		t.Errorf("LoadConfig error = %v, want INDEX_BUILD_MODE rejected", err)
+	}
+}
+
+func TestLoadConfigEmptyBatchPolicy(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.AcceptEmptyBatches {
+		t.Error("empty batches should be rejected by default")
+	}
+	t.Setenv("EMPTY_BATCH_POLICY", "ignore")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "EMPTY_BATCH_POLICY") {
+		t.Errorf("LoadConfig error = %v, want EMPTY_BATCH_POLICY rejected", err)
+	}
+}
+
+func TestLoadConfigHTTPS(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"HSTS_MAX_AGE": "8760h", "HTTPS_REDIRECT": "true"})
+	if cfg.HSTSMaxAge != 8760*time.Hour || !cfg.HTTPSRedirect {
+		t.Errorf("HSTSMaxAge = %v, HTTPSRedirect = %v", cfg.HSTSMaxAge, cfg.HTTPSRedirect)
+	}
+	t.Setenv("HSTS_MAX_AGE", "-1h")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject a negative HSTS_MAX_AGE")
+	}
+}
+
+func TestLoadConfigMaxConcurrentPerKey(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.MaxConcurrentPerKey != 0 {
+		t.Errorf("MaxConcurrentPerKey default = %d, want 0 (unlimited)", cfg.MaxConcurrentPerKey)
+	}
+	t.Setenv("MAX_CONCURRENT_PER_KEY", "-1")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject a negative MAX_CONCURRENT_PER_KEY")
+	}
+}
+
+func TestLoadConfigIndexRaceRetries(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.IndexRaceRetries != 3 {
+		t.Errorf("IndexRaceRetries default = %d, want 3", cfg.IndexRaceRetries)
+	}
+	t.Setenv("INDEX_RACE_RETRIES", "-1")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject a negative INDEX_RACE_RETRIES")
+	}
+}
+
+func TestLoadConfigListCacheCompress(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.ListCacheCompress {
+		t.Error("ListCacheCompress should default to false")
+	}
+	if cfg := testConfig(t, map[string]string{"LIST_CACHE_COMPRESS": "true"}); !cfg.ListCacheCompress {
+		t.Error("LIST_CACHE_COMPRESS=true should enable compression")
+	}
+	t.Setenv("LIST_CACHE_COMPRESS", "sometimes")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject an invalid LIST_CACHE_COMPRESS")
+	}
+}
+
+func TestLoadConfigErrorDetail(t *testing.T) {
+	if cfg := testConfig(t, nil); !cfg.ErrorDetail {
+		t.Error("ErrorDetail should default to true")
+	}
+	if cfg := testConfig(t, map[string]string{"ERROR_DETAIL": "false"}); cfg.ErrorDetail {
+		t.Error("ERROR_DETAIL=false should hide error detail")
+	}
+}
+
+func TestLoadConfigPartialSuccessStatus(t *testing.T) {
+	if cfg := testConfig(t, nil); !cfg.MultiStatus {
+		t.Error("MultiStatus should default to true")
+	}
+	if cfg := testConfig(t, map[string]string{"PARTIAL_SUCCESS_STATUS": "200"}); cfg.MultiStatus {
+		t.Error("PARTIAL_SUCCESS_STATUS=200 should turn off 207")
+	}
+	t.Setenv("PARTIAL_SUCCESS_STATUS", "206")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject PARTIAL_SUCCESS_STATUS=206")
+	}
+}
+
+func TestLoadConfigAddressNormalization(t *testing.T) {
+	cfg := testConfig(t, nil)
+	if cfg.AddressNormalization != middleware.AddressVerbatim || cfg.KeepRawAddress {
+		t.Errorf("address defaults = %q, raw %v; want verbatim without raw", cfg.AddressNormalization, cfg.KeepRawAddress)
+	}
+	cfg = testConfig(t, map[string]string{"ADDRESS_NORMALIZATION": "title", "KEEP_RAW_ADDRESS": "true"})
+	if cfg.AddressNormalization != middleware.AddressTitleCase || !cfg.KeepRawAddress {
+		t.Errorf("address settings = %q, raw %v; want title with raw", cfg.AddressNormalization, cfg.KeepRawAddress)
+	}
+	t.Setenv("ADDRESS_NORMALIZATION", "upper")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject an unknown ADDRESS_NORMALIZATION")
+	}
+}
+
+func TestLoadConfigTenants(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"MULTI_TENANT": "true", "TENANTS": "Acme, globex"})
+	if len(cfg.Tenants) != 2 || cfg.Tenants[0] != "acme" || cfg.Tenants[1] != "globex" {
+		t.Errorf("Tenants = %v, want [acme globex]", cfg.Tenants)
+	}
+	t.Setenv("TENANTS", "acme.eu")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should reject an invalid tenant in TENANTS")
+	}
+	t.Setenv("TENANTS", "")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig should require TENANTS when MULTI_TENANT is enabled")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// limitBatchBody bounds the size of a batch upload as sent. It answers 411
+// when RequireContentLength is on and the upload arrives without a
+// Content-Length, as chunked uploads do, and 413 when the declared length is
+// over MaxBodyBytes; a body that turns out longer than that fails when read.
+// The length is checked before gunzipBody, which discards it. NDJSON uploads
+// are exempt: they are the streaming mode, written as they arrive and bounded
+// by MaxWriteOps and StreamBatchTimeout instead.
+func (s *Server) limitBatchBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isNDJSON(r) {
+			next(w, r)
+			return
+		}
+		if s.config.RequireContentLength && r.ContentLength < 0 {
+			s.sendResponse(w, http.StatusLengthRequired, APIResponse{
+				Success: false,
+				Message: "Content-Length is required; send the batch unchunked or as application/x-ndjson",
+			})
+			return
+		}
+		if r.ContentLength > s.config.MaxBodyBytes {
+			s.sendBodyTooLarge(w)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxBodyBytes)
+		next(w, r)
+	}
+}
+
+// sendBodyTooLarge answers 413 for a batch upload over MaxBodyBytes
+func (s *Server) sendBodyTooLarge(w http.ResponseWriter) {
+	s.sendResponse(w, http.StatusRequestEntityTooLarge, APIResponse{
+		Success: false,
+		Message: fmt.Sprintf("Request body exceeds the limit of %d bytes; split the upload or send it as application/x-ndjson", s.config.MaxBodyBytes),
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitBatchBody(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"REQUIRE_CONTENT_LENGTH": "true",
+		"MAX_BODY_BYTES":         "16",
+	})
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	tests := []struct {
+		name          string
+		contentType   string
+		body          string
+		contentLength int64
+		want          int
+	}{
+		{"within the limit", "application/json", `{}`, 2, http.StatusNoContent},
+		{"chunked", "application/json", `{}`, -1, http.StatusLengthRequired},
+		{"over the limit", "application/json", strings.Repeat("x", 17), 17, http.StatusRequestEntityTooLarge},
+		{"chunked ndjson", "application/x-ndjson", strings.Repeat("x", 17), -1, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/companies/batch", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r.ContentLength = tt.contentLength
+			w := httptest.NewRecorder()
+			s.limitBatchBody(next)(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestBatchUploadBodyOverLimit(t *testing.T) {
+	s := newTestServer(t, map[string]string{"MAX_BODY_BYTES": "32"})
+	body := `{"companies":[{"name":"Acme"},{"name":"Globex"}]}`
+	// An unknown length, as sent chunked, is only caught while reading
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/companies/batch", io.NopCloser(strings.NewReader(body)))
+	r.Header.Set("Content-Type", "application/json")
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413: %s", w.Code, w.Body)
+	}
+}
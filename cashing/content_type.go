@@ -0,0 +1,30 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+)
+
+// uploadContentTypes are the media types accepted for batch uploads
+var uploadContentTypes = map[string]bool{
+	"application/json":     true,
+	"application/x-ndjson": true,
+}
+
+// checkContentType answers 415 and returns false when StrictContentType is on
+// and the request body is not JSON or NDJSON. Form-encoded and text bodies
+// otherwise decode into an empty batch.
+func (s *Server) checkContentType(w http.ResponseWriter, r *http.Request) bool {
+	if !s.config.StrictContentType {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err == nil && uploadContentTypes[mediaType] {
+		return true
+	}
+	s.sendResponse(w, http.StatusUnsupportedMediaType, APIResponse{
+		Success: false,
+		Message: "Content-Type must be application/json or application/x-ndjson",
+	})
+	return false
+}
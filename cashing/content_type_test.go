@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckContentType(t *testing.T) {
+	tests := []struct {
+		strict      string
+		contentType string
+		want        bool
+	}{
+		{"true", "application/json", true},
+		{"true", "application/json; charset=utf-8", true},
+		{"true", "application/x-ndjson", true},
+		{"true", "text/plain", false},
+		{"true", "application/x-www-form-urlencoded", false},
+		{"true", "", false},
+		{"false", "text/plain", true},
+		{"false", "", true},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t, map[string]string{"STRICT_CONTENT_TYPE": tt.strict})
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/companies/batch", nil)
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		if got := s.checkContentType(w, r); got != tt.want {
+			t.Errorf("STRICT_CONTENT_TYPE=%s, Content-Type %q: accepted %v, want %v", tt.strict, tt.contentType, got, tt.want)
+		}
+		if !tt.want && w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Content-Type %q answered %d, want 415", tt.contentType, w.Code)
+		}
+	}
+}
+
+func TestBatchUploadRejectsFormBody(t *testing.T) {
+	s := newTestServer(t, nil)
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	w := serve(s, http.MethodPost, "/api/v1/companies/batch", "companies=Acme", header)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status = %d, want 415", w.Code)
+	}
+}
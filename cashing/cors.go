@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsMiddleware applies the configured CORS policy. Exempt paths are open to
+// any origin; other requests from an origin outside CORSAllowedOrigins are
+// rejected. With no origins configured, CORS headers are not sent at all.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch {
+		case s.isExemptPath(r.URL.Path):
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case len(s.config.CORSAllowedOrigins) == 0:
+			next.ServeHTTP(w, r)
+			return
+		case s.allowedOrigin(origin):
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		default:
+			s.sendResponse(w, http.StatusForbidden, APIResponse{
+				Success: false,
+				Message: "Origin not allowed",
+			})
+			return
+		}
+
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key, X-Conflict-Strategy, X-Treated-Alias, X-Read-Concern, X-Read-Preference, X-Import-Source, X-Tenant-ID, X-Request-Timeout")
+			w.Header().Set("Access-Control-Max-Age", "600")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedOrigin reports whether origin is in the CORS allowlist
+func (s *Server) allowedOrigin(origin string) bool {
+	for _, allowed := range s.config.CORSAllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// preflightHandler answers CORS preflight requests once corsMiddleware has
+// set the headers
+func (s *Server) preflightHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
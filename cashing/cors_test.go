@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		origins    string
+		path       string
+		origin     string
+		wantStatus int
+		wantOrigin string
+	}{
+		{"no origin", "https://app.example.com", "/api/v1/companies", "", http.StatusNoContent, ""},
+		{"allowed origin", "https://app.example.com", "/api/v1/companies", "https://APP.example.com", http.StatusNoContent, "https://APP.example.com"},
+		{"wildcard", "*", "/api/v1/companies", "https://other.example.com", http.StatusNoContent, "https://other.example.com"},
+		{"foreign origin", "https://app.example.com", "/api/v1/companies", "https://evil.example.com", http.StatusForbidden, ""},
+		{"exempt path", "https://app.example.com", "/metrics", "https://evil.example.com", http.StatusNoContent, "*"},
+		{"cors disabled", "", "/api/v1/companies", "https://evil.example.com", http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, map[string]string{"CORS_ALLOWED_ORIGINS": tt.origins})
+			handler := s.corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"CORS_ALLOWED_ORIGINS": "https://app.example.com",
+		"AUTH_REQUIRED":        "true",
+		"API_KEYS":             "importer:s3cret",
+	})
+	header := http.Header{"Origin": {"https://app.example.com"}}
+	w := serve(s, http.MethodOptions, "/api/v1/companies/batch", "", header)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("preflight answered %d, want 204 without an API key", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Error("preflight response lacks Access-Control-Allow-Methods")
+	}
+}
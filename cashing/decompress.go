@@ -0,0 +1,43 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gunzipBody transparently decompresses request bodies sent with
+// Content-Encoding: gzip. The decompressed body is capped at
+// MaxDecompressedBytes so a small compressed upload cannot expand without
+// bound; reads past the cap fail like an oversized body.
+func (s *Server) gunzipBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+		case "", "identity":
+			next(w, r)
+			return
+		case "gzip", "x-gzip":
+		default:
+			s.sendResponse(w, http.StatusUnsupportedMediaType, APIResponse{
+				Success: false,
+				Message: "Unsupported Content-Encoding: " + encoding,
+			})
+			return
+		}
+
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid gzip body: " + err.Error(),
+			})
+			return
+		}
+		defer gz.Close()
+
+		r.Body = http.MaxBytesReader(w, gz, s.config.MaxDecompressedBytes)
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+		next(w, r)
+	}
+}
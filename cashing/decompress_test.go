@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGunzipBody(t *testing.T) {
+	body := `{"companies":[{"name":"Acme"}]}`
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		maxBytes string
+		want     int
+		wantBody string
+	}{
+		{"plain", "", []byte(body), "", http.StatusOK, body},
+		{"identity", "identity", []byte(body), "", http.StatusOK, body},
+		{"gzip", "gzip", gzipped(t, body), "", http.StatusOK, body},
+		{"x-gzip", "X-Gzip", gzipped(t, body), "", http.StatusOK, body},
+		{"corrupt gzip", "gzip", []byte(body), "", http.StatusBadRequest, ""},
+		{"unsupported", "br", []byte(body), "", http.StatusUnsupportedMediaType, ""},
+		{"over the cap", "gzip", gzipped(t, strings.Repeat(" ", 100)+body), "64", http.StatusRequestEntityTooLarge, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			if tt.maxBytes != "" {
+				env["MAX_DECOMPRESSED_BYTES"] = tt.maxBytes
+			}
+			s := newTestServer(t, env)
+			handler := s.gunzipBody(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Encoding") == "gzip" {
+					t.Error("Content-Encoding should be removed once decoded")
+				}
+				got, err := io.ReadAll(r.Body)
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					s.sendBodyTooLarge(w)
+					return
+				}
+				if string(got) != tt.wantBody {
+					t.Errorf("body = %q, want %q", got, tt.wantBody)
+				}
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/companies/batch", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				r.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
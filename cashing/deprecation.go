@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// deprecation describes a deprecated way of calling a route
+type deprecation struct {
+	// param, if set, limits the notice to requests using this query
+	// parameter; otherwise every request to the route is deprecated
+	param string
+	// replacement tells clients what to use instead
+	replacement string
+}
+
+// deprecated wraps next so that requests using the deprecated form carry a
+// Deprecation header and an RFC 7234 Warning naming the replacement
+func (s *Server) deprecated(dep deprecation, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if dep.param == "" || r.URL.Query().Has(dep.param) {
+			what := "This endpoint"
+			if dep.param != "" {
+				what = "The " + dep.param + " query parameter"
+			}
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Warning", fmt.Sprintf("299 - %q", what+" is deprecated; use "+dep.replacement))
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeprecated(t *testing.T) {
+	tests := []struct {
+		name        string
+		dep         deprecation
+		target      string
+		wantWarning string
+	}{
+		{"route", deprecation{replacement: "GET /companies"}, "/old", `299 - "This endpoint is deprecated; use GET /companies"`},
+		{"param used", deprecation{param: "name", replacement: "PUT /companies/{name}/treated"}, "/old?name=Acme",
+			`299 - "The name query parameter is deprecated; use PUT /companies/{name}/treated"`},
+		{"param unused", deprecation{param: "name", replacement: "PUT /companies/{name}/treated"}, "/old", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			called := false
+			handler := s.deprecated(tt.dep, func(w http.ResponseWriter, r *http.Request) { called = true })
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodPut, tt.target, nil))
+
+			if !called {
+				t.Error("the wrapped handler should still run")
+			}
+			if got := w.Header().Get("Warning"); got != tt.wantWarning {
+				t.Errorf("Warning = %q, want %q", got, tt.wantWarning)
+			}
+			if got, want := w.Header().Get("Deprecation") == "true", tt.wantWarning != ""; got != want {
+				t.Errorf("Deprecation header set %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// diffCompaniesHandler compares a batch against the stored companies without
+// writing it, reporting which would be created, changed or left unchanged by
+// an upload of the same body
+func (s *Server) diffCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkContentType(w, r) {
+		return
+	}
+
+	req, err := decodeCompanyRequest(r.Body, s.treatedAliases(r))
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	applySource(req.Companies, importSource(r))
+
+	if len(req.Companies) == 0 {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "No companies provided",
+		})
+		return
+	}
+
+	if err := validateCompanies("companies", req.Companies); err != nil {
+		s.sendValidationError(w, "Invalid companies", err)
+		return
+	}
+
+	ctx, cancel := withWriteTimeout(w, r, 30*time.Second)
+	defer cancel()
+
+	diff, err := s.batchProcessor.DiffBatch(ctx, req.Companies)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to diff companies", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Companies compared successfully",
+		Data:    diff,
+	})
+}
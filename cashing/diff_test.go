@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDiffCompaniesRejectsInvalid(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, body := range []string{`{"companies":`, `{"companies":[]}`, `{"companies":[{"address":"1 Main St"}]}`} {
+		if w := serve(s, http.MethodPost, "/api/v1/companies/diff", body, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("POST /companies/diff %s = %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEmptyBatchPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   int
+	}{
+		{"reject", http.StatusBadRequest},
+		{"accept", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			s := newTestServer(t, map[string]string{"EMPTY_BATCH_POLICY": tt.policy})
+			for _, body := range []string{`{"companies":[]}`, `[]`} {
+				if w := serve(s, http.MethodPost, "/api/v1/companies/batch", body, nil); w.Code != tt.want {
+					t.Errorf("empty batch %s = %d, want %d: %s", body, w.Code, tt.want, w.Body)
+				}
+			}
+		})
+	}
+}
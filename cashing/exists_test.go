@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"company-api/middleware"
+)
+
+func TestCompanyExistsHandler(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+	seed := []middleware.Company{{Name: "Acme/Europe"}}
+	if _, err := s.batchProcessor.ProcessBatch(context.Background(), seed, middleware.BatchOptions{}); err != nil {
+		t.Fatalf("failed to seed companies: %v", err)
+	}
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/api/v1/companies/Acme%2FEurope", http.StatusOK},
+		{"/api/v1/companies/Globex", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := serve(s, http.MethodHead, tt.target, "", nil)
+		if w.Code != tt.want {
+			t.Errorf("HEAD %s answered %d, want %d", tt.target, w.Code, tt.want)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("HEAD %s returned a body: %s", tt.target, w.Body)
+		}
+	}
+}
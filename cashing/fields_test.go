@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseWriteFields(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"fields=address", []string{"address"}, false},
+		{"fields=name,address", []string{"name", "address"}, false},
+		{"fields=name", []string{"name"}, false},
+		{"fields=address,createdAt", nil, true},
+		{"fields=_id", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/companies/batch?"+tt.query, nil)
+			got, err := parseWriteFields(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWriteFields error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(got)+len(tt.want) > 0 && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWriteFields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"company-api/middleware"
+)
+
+// groupCountHandler counts companies by the value of the groupable field
+// named in the field query parameter
+func (s *Server) groupCountHandler(w http.ResponseWriter, r *http.Request) {
+	field := r.URL.Query().Get("field")
+	if err := middleware.CheckField(field, middleware.FieldGroupable); err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid field: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	counts, err := s.batchProcessor.CountGroupedBy(ctx, field)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to count companies", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Companies counted successfully",
+		Data: map[string]interface{}{
+			"field":  field,
+			"counts": counts,
+		},
+	})
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGroupCountRejectsField(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, field := range []string{"", "name", "metadata", "$where"} {
+		if w := serve(s, http.MethodGet, "/api/v1/companies/group-count?field="+field, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("group-count by %q answered %d, want 400", field, w.Code)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"company-api/middleware"
+)
+
+func TestHealthCheckReportsWork(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+	w := serve(s, http.MethodGet, "/health", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var resp struct {
+		Data struct {
+			Work middleware.WorkStats `json:"work"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := middleware.WorkStats{Workers: 2, MaxPoolSize: middleware.MaxPoolSize(2)}
+	if resp.Data.Work != want {
+		t.Errorf("work = %+v, want %+v", resp.Data.Work, want)
+	}
+}
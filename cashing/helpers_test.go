@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"company-api/middleware"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testConfig loads the configuration from the environment after applying env
+// on top of the defaults
+func testConfig(t *testing.T, env map[string]string) *Config {
+	t.Helper()
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	return cfg
+}
+
+// newTestServer returns a server without a database, for requests that are
+// answered before the store is reached
+func newTestServer(t *testing.T, env map[string]string) *Server {
+	t.Helper()
+	return NewServer(nil, testConfig(t, env))
+}
+
+// newStoreTestServer returns a server backed by the MongoDB server named by
+// MONGO_TEST_URI, skipping the test when it is unset. It writes to a database
+// of its own that is dropped when the test ends.
+func newStoreTestServer(t *testing.T, env map[string]string, opts ...middleware.Option) *Server {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+	cfg := testConfig(t, env)
+
+	dbName := fmt.Sprintf("company_api_test_%d", time.Now().UnixNano())
+	bp, err := middleware.NewBatchProcessor(uri, dbName, "companies", 100, 2, opts...)
+	if err != nil {
+		t.Fatalf("failed to create batch processor: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		bp.Close(ctx)
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+		if err != nil {
+			t.Errorf("failed to connect to drop test database: %v", err)
+			return
+		}
+		defer client.Disconnect(ctx)
+		if err := client.Database(dbName).Drop(ctx); err != nil {
+			t.Errorf("failed to drop test database: %v", err)
+		}
+	})
+	return NewServer(bp, cfg)
+}
+
+// serve sends a request through s's router and returns the response. Bodies
+// are sent as JSON unless header sets another Content-Type.
+func serve(s *Server, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// hostMiddleware rejects requests whose Host header is not in AllowedHosts
+// with 400, so that links and redirects built from the Host, and anything
+// cached under it, cannot be pointed at an attacker's domain. Exempt paths,
+// such as the health check probed by address, are not checked. An empty
+// allowlist accepts any host.
+func (s *Server) hostMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.config.AllowedHosts) == 0 || s.isExemptPath(r.URL.Path) || s.hostAllowed(r.Host) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Host not allowed",
+		})
+	})
+}
+
+// hostAllowed reports whether host, with any port removed, matches an
+// AllowedHosts entry exactly or, for entries such as "*.example.com", is a
+// subdomain of it. Matching is case-insensitive.
+func (s *Server) hostAllowed(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return false
+	}
+
+	for _, allowed := range s.config.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
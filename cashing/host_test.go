@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostAllowed(t *testing.T) {
+	s := newTestServer(t, map[string]string{"ALLOWED_HOSTS": "api.example.com, *.Internal.example"})
+	for host, want := range map[string]bool{
+		"api.example.com":      true,
+		"API.Example.com:8443": true,
+		"api.example.com.":     true,
+		"svc.internal.example": true,
+		"a.b.internal.example": true,
+		"internal.example":     false,
+		"evil.com":             false,
+		"api.example.com.evil": false,
+		"evilinternal.example": false,
+		"":                     false,
+		"[::1]:8080":           false,
+	} {
+		if got := s.hostAllowed(host); got != want {
+			t.Errorf("hostAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestHostMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		host       string
+		target     string
+		wantStatus int
+	}{
+		{"allowed host", map[string]string{"ALLOWED_HOSTS": "api.example.com"}, "api.example.com", "/api/v1/companies", http.StatusOK},
+		{"disallowed host", map[string]string{"ALLOWED_HOSTS": "api.example.com"}, "evil.com", "/api/v1/companies", http.StatusBadRequest},
+		{"exempt health check", map[string]string{"ALLOWED_HOSTS": "api.example.com"}, "10.0.0.7:8080", "/health", http.StatusOK},
+		{"empty allowlist", nil, "evil.com", "/api/v1/companies", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.env)
+			handler := s.hostMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Host = tt.host
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// httpsMiddleware enforces HTTPS behind a TLS-terminating proxy, which
+// reports the client's scheme in X-Forwarded-Proto. With HSTSMaxAge set,
+// HTTPS responses carry Strict-Transport-Security; with HTTPSRedirect on,
+// plaintext requests are redirected to https with 308 so the method and body
+// are kept. Exempt paths, such as the health check probed by the load
+// balancer, are never redirected.
+func (s *Server) httpsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secure := r.TLS != nil || strings.EqualFold(forwardedProto(r), "https")
+
+		if !secure && s.config.HTTPSRedirect && !s.isExemptPath(r.URL.Path) {
+			target := "https://" + r.Host + r.URL.RequestURI()
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+			return
+		}
+		// Browsers ignore HSTS received over plaintext
+		if secure && s.config.HSTSMaxAge > 0 {
+			w.Header().Set("Strict-Transport-Security",
+				fmt.Sprintf("max-age=%d; includeSubDomains", int64(s.config.HSTSMaxAge.Seconds())))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedProto returns the scheme the client used according to the first
+// X-Forwarded-Proto entry, as set by the nearest proxy
+func forwardedProto(r *http.Request) string {
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.TrimSpace(proto)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		proto        string
+		tls          bool
+		wantStatus   int
+		wantLocation string
+		wantHSTS     string
+	}{
+		{"plaintext redirected", "/api/v1/companies?limit=5", "http", false, http.StatusPermanentRedirect, "https://example.com/api/v1/companies?limit=5", ""},
+		{"no proxy header redirected", "/api/v1/companies", "", false, http.StatusPermanentRedirect, "https://example.com/api/v1/companies", ""},
+		{"forwarded https", "/api/v1/companies", "HTTPS, http", false, http.StatusOK, "", "max-age=86400; includeSubDomains"},
+		{"direct TLS", "/api/v1/companies", "", true, http.StatusOK, "", "max-age=86400; includeSubDomains"},
+		{"exempt health check", "/health", "http", false, http.StatusOK, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, map[string]string{"HSTS_MAX_AGE": "24h", "HTTPS_REDIRECT": "true"})
+			handler := s.httpsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodPost, "http://example.com"+tt.target, nil)
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			if got := w.Header().Get("Strict-Transport-Security"); got != tt.wantHSTS {
+				t.Errorf("Strict-Transport-Security = %q, want %q", got, tt.wantHSTS)
+			}
+		})
+	}
+}
+
+func TestHTTPSMiddlewareDisabled(t *testing.T) {
+	s := newTestServer(t, nil)
+	handler := s.httpsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/companies", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Strict-Transport-Security") != "" {
+		t.Errorf("default config answered %d with HSTS %q, want neither redirect nor HSTS", w.Code, w.Header().Get("Strict-Transport-Security"))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// importFeedHeartbeat is how often an idle import feed sends a comment, so
+// proxies do not close the connection and a departed client is noticed
+const importFeedHeartbeat = 15 * time.Second
+
+// importFeedHandler streams each import log entry of the request's tenant
+// recorded by this instance as a server-sent event named "import", with the
+// import id as the event id. The stream runs until the client disconnects.
+func (s *Server) importFeedHandler(w http.ResponseWriter, r *http.Request) {
+	entries, unsubscribe := s.batchProcessor.SubscribeImports(r.Context())
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	// The server WriteTimeout is sized for regular requests, not long streams
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("Unable to clear write deadline for import feed", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Flushing straight away sends the headers, and keeps the stream out of
+	// response compression
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(importFeedHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case entry := <-entries:
+			data, err := json.Marshal(entry)
+			if err != nil {
+				slog.Error("Failed to encode import log entry", "import_id", entry.ID, "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: import\nid: %s\ndata: %s\n\n", entry.ID, data); err != nil {
+				slog.Info("Client left import feed", "error", err)
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				slog.Info("Client left import feed", "error", err)
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			slog.Info("Client left import feed", "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportFeedHandler(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+	ts := httptest.NewServer(s.router)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/v1/imports/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /imports/stream failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != ": connected" || !lines.Scan() || lines.Text() != "" {
+		t.Fatalf("stream does not open with the connected comment, got %q", lines.Text())
+	}
+
+	// The subscription exists once the connected comment arrived
+	if w := serve(s, http.MethodPost, "/api/v1/companies/batch", `[{"name":"Acme"}]`, nil); w.Code != http.StatusOK {
+		t.Fatalf("batch upload status = %d: %s", w.Code, w.Body)
+	}
+
+	var event []string
+	for lines.Scan() && lines.Text() != "" {
+		event = append(event, lines.Text())
+	}
+	if len(event) < 3 || event[0] != "event: import" || !strings.HasPrefix(event[1], "id: ") {
+		t.Fatalf("event = %q, want an import event with an id", event)
+	}
+	if !strings.HasPrefix(event[2], "data: ") || !strings.Contains(event[2], `"names":["Acme"]`) {
+		t.Errorf("event data = %q, want the import log entry naming Acme", event[2])
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestGetImportPaginatesNames(t *testing.T) {
+	s := newStoreTestServer(t, map[string]string{"API_KEYS": "ops:s3cret"})
+	body := `{"companies":[{"name":"Acme"},{"name":"Globex"},{"name":"Initech"}]}`
+	w := serve(s, http.MethodPost, "/api/v1/companies/batch", body, http.Header{"X-Api-Key": {"s3cret"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("batch upload status = %d: %s", w.Code, w.Body)
+	}
+	var upload struct {
+		Data struct {
+			ImportID string `json:"import_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &upload); err != nil || upload.Data.ImportID == "" {
+		t.Fatalf("batch response has no import id: %v: %s", err, w.Body)
+	}
+
+	var names []string
+	target := "/api/v1/imports/" + upload.Data.ImportID + "?limit=2"
+	for pages := 0; pages < 3; pages++ {
+		w := serve(s, http.MethodGet, target, "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d: %s", target, w.Code, w.Body)
+		}
+		var page struct {
+			Data struct {
+				Processed  int      `json:"processed_count"`
+				Names      []string `json:"names"`
+				NextCursor string   `json:"next_cursor"`
+				HasMore    bool     `json:"has_more"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("failed to decode import: %v", err)
+		}
+		if page.Data.Processed != 3 {
+			t.Errorf("processed_count = %d, want 3", page.Data.Processed)
+		}
+		names = append(names, page.Data.Names...)
+		if !page.Data.HasMore {
+			break
+		}
+		target = "/api/v1/imports/" + upload.Data.ImportID + "?limit=2&cursor=" + page.Data.NextCursor
+	}
+	if len(names) != 3 {
+		t.Errorf("paged through names %v, want all 3", names)
+	}
+
+	if w := serve(s, http.MethodGet, "/api/v1/imports/"+upload.Data.ImportID+"?cursor=bogus", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("GET with a bad cursor status = %d, want 400", w.Code)
+	}
+}
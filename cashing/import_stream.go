@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"company-api/middleware"
+)
+
+// isNDJSON reports whether the request body is newline-delimited JSON
+func isNDJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-ndjson"
+}
+
+// newNDJSONSource reads one company per JSON value from body, validating
+// each as it goes. Companies without a source are given source.
+func newNDJSONSource(body io.Reader, aliases []string, source string) middleware.CompanySource {
+	dec := json.NewDecoder(body)
+	return func() (middleware.Company, error) {
+		var company middleware.Company
+		if len(aliases) == 0 {
+			if err := dec.Decode(&company); err != nil {
+				return company, err
+			}
+		} else {
+			var fields map[string]json.RawMessage
+			if err := dec.Decode(&fields); err != nil {
+				return company, err
+			}
+			var err error
+			if company, err = decodeAliasedCompany(fields, aliases); err != nil {
+				return company, err
+			}
+		}
+		if company.Source == "" {
+			company.Source = source
+		}
+		return company, company.Validate()
+	}
+}
+
+// importStreamHandler upserts an NDJSON batch upload chunk by chunk while the
+// body is still arriving, so memory stays bounded however large the import.
+// Writes happen before the whole body has been read; a malformed line stops
+// the import and the response reports what was written up to that point. An
+// import longer than MaxWriteOps is cut off after that many companies, which
+// are written, and answered as a partial success naming the limit so the
+// client can upload the rest separately.
+func (s *Server) importStreamHandler(w http.ResponseWriter, r *http.Request) {
+	strategy, err := middleware.ParseConflictStrategy(r.Header.Get("X-Conflict-Strategy"))
+	if err == nil && strategy == middleware.ConflictError {
+		err = fmt.Errorf("%q is not supported for NDJSON uploads", strategy)
+	}
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid X-Conflict-Strategy header: " + err.Error(),
+		})
+		return
+	}
+	if mode := r.URL.Query().Get("mode"); mode != "" && mode != string(middleware.ModeUpsert) {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid mode: NDJSON uploads only support upsert",
+		})
+		return
+	}
+	if r.URL.Query().Has("sync") {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "sync is not supported for NDJSON uploads",
+		})
+		return
+	}
+
+	keepAddress, err := parseKeepAddress(r)
+	var fields []string
+	if err == nil {
+		fields, err = parseWriteFields(r)
+	}
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Reading and writing take as long as the upload does; bound the import
+	// by StreamBatchTimeout rather than the server's request timeouts
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		slog.Warn("Unable to clear read deadline for NDJSON import", "error", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("Unable to clear write deadline for NDJSON import", "error", err)
+	}
+
+	opts := middleware.BatchOptions{
+		ConflictStrategy: strategy,
+		KeepAddress:      keepAddress,
+		Fields:           fields,
+		Timeout:          s.config.StreamBatchTimeout,
+		Progress: func(processed, _ int) {
+			slog.Debug("NDJSON import progress", "processed", processed)
+		},
+	}
+	var exceeded bool
+	source := limitWriteOps(newNDJSONSource(r.Body, s.treatedAliases(r), importSource(r)), s.config.MaxWriteOps, &exceeded)
+	result, err := s.batchProcessor.ImportStream(r.Context(), source, opts)
+	if err != nil {
+		status := errorStatus(r.Context(), err)
+		var sourceErr *middleware.SourceError
+		if errors.As(err, &sourceErr) {
+			status = http.StatusBadRequest
+		}
+		s.sendResponse(w, status, APIResponse{
+			Success: false,
+			Message: s.errorMessage(status, "Failed to import companies", err),
+			Data:    result,
+		})
+		return
+	}
+
+	// Every company read was inserted, matched or dropped as a duplicate
+	// unless it failed
+	succeeded := result.Inserted + result.Overwritten + result.Skipped
+	if exceeded {
+		s.sendResponse(w, s.partialStatus(succeeded), APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Import stopped at the limit of %d companies per request: the first %d were processed (%d failed) and the rest were not read; upload them separately",
+				s.config.MaxWriteOps, s.config.MaxWriteOps, len(result.Errors)),
+			Data: result,
+		})
+		return
+	}
+
+	if len(result.Errors) > 0 {
+		s.sendResponse(w, s.partialStatus(succeeded), APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Import partially processed: %d companies failed", len(result.Errors)),
+			Data:    result,
+		})
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Import processed successfully",
+		Data:    result,
+	})
+}
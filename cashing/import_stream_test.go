@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsNDJSON(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"application/x-ndjson":                true,
+		"application/x-ndjson; charset=utf-8": true,
+		"application/json":                    false,
+		"":                                    false,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/companies/batch", nil)
+		r.Header.Set("Content-Type", contentType)
+		if got := isNDJSON(r); got != want {
+			t.Errorf("isNDJSON(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
+
+func TestNDJSONSource(t *testing.T) {
+	body := `{"name":"Acme","processed":true}
+{"name":"Globex","source":"crm"}
+{"name":"Initech","metadata":{"a.b":1}}
+`
+	next := newNDJSONSource(strings.NewReader(body), []string{"processed"}, "upload")
+
+	acme, err := next()
+	if err != nil || acme.Name != "Acme" || !acme.Treated || acme.Source != "upload" {
+		t.Errorf("first company = %+v, %v; want treated Acme from upload", acme, err)
+	}
+	globex, err := next()
+	if err != nil || globex.Source != "crm" {
+		t.Errorf("second company = %+v, %v; want its own source kept", globex, err)
+	}
+	if _, err := next(); err == nil {
+		t.Error("a company with an invalid metadata key should fail validation")
+	}
+	if _, err := next(); !errors.Is(err, io.EOF) {
+		t.Errorf("after the last line got %v, want io.EOF", err)
+	}
+}
+
+func TestImportStreamRejectsUnsupportedOptions(t *testing.T) {
+	s := newTestServer(t, nil)
+	header := http.Header{"Content-Type": {"application/x-ndjson"}}
+	tests := []struct {
+		name     string
+		target   string
+		strategy string
+	}{
+		{"error strategy", "/api/v1/companies/batch", "error"},
+		{"unknown strategy", "/api/v1/companies/batch", "merge"},
+		{"insert mode", "/api/v1/companies/batch?mode=insert", ""},
+		{"full sync", "/api/v1/companies/batch?sync=full", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := header.Clone()
+			if tt.strategy != "" {
+				h.Set("X-Conflict-Strategy", tt.strategy)
+			}
+			w := serve(s, http.MethodPost, tt.target, `{"name":"Acme"}`+"\n", h)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "net/http"
+
+// keyLimiter caps the requests each API key may have in flight at once, so
+// that one caller cannot occupy every worker
+type keyLimiter struct {
+	slots map[string]chan struct{}
+}
+
+// newKeyLimiter returns a limiter allowing limit concurrent requests per key
+// name, or nil when limit is 0
+func newKeyLimiter(keys []APIKey, limit int) *keyLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	l := &keyLimiter{slots: make(map[string]chan struct{}, len(keys))}
+	for _, key := range keys {
+		l.slots[key.Name] = make(chan struct{}, limit)
+	}
+	return l
+}
+
+// acquire takes one of name's slots without waiting, returning the function
+// that releases it, or false if all of them are in use
+func (l *keyLimiter) acquire(name string) (func(), bool) {
+	if l == nil {
+		return func() {}, true
+	}
+	slots, ok := l.slots[name]
+	if !ok {
+		return func() {}, true
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	default:
+		return nil, false
+	}
+}
+
+// sendKeyLimited answers a request whose API key is at its concurrency limit
+func (s *Server) sendKeyLimited(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	s.sendResponse(w, http.StatusTooManyRequests, APIResponse{
+		Success: false,
+		Message: "Too many concurrent requests for this API key",
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKeyLimiter(t *testing.T) {
+	l := newKeyLimiter([]APIKey{{Name: "importer", Key: "s3cret"}}, 2)
+
+	first, ok := l.acquire("importer")
+	if !ok {
+		t.Fatal("first slot should be free")
+	}
+	if _, ok := l.acquire("importer"); !ok {
+		t.Fatal("second slot should be free")
+	}
+	if _, ok := l.acquire("importer"); ok {
+		t.Error("a third request should be refused")
+	}
+	if _, ok := l.acquire("unknown"); !ok {
+		t.Error("names without slots should not be limited")
+	}
+	first()
+	if _, ok := l.acquire("importer"); !ok {
+		t.Error("a released slot should be reusable")
+	}
+
+	if newKeyLimiter(nil, 0) != nil {
+		t.Error("a limit of 0 should disable the limiter")
+	}
+	var disabled *keyLimiter
+	if _, ok := disabled.acquire("importer"); !ok {
+		t.Error("a nil limiter should admit every request")
+	}
+}
+
+func TestAuthMiddlewareKeyLimit(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"API_KEYS":               "importer:s3cret",
+		"MAX_CONCURRENT_PER_KEY": "1",
+	})
+	inner := httptest.NewRecorder()
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A second request from the same key arrives while this one runs
+		r2 := httptest.NewRequest(http.MethodGet, "/api/v1/companies", nil)
+		r2.Header.Set("X-API-Key", "s3cret")
+		s.authMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(inner, r2)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/companies", nil)
+	r.Header.Set("X-API-Key", "s3cret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("first request = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if inner.Code != http.StatusTooManyRequests || inner.Header().Get("Retry-After") != "1" {
+		t.Errorf("concurrent request = %d with Retry-After %q, want 429 with 1", inner.Code, inner.Header().Get("Retry-After"))
+	}
+
+	// The slot is released once the first request completes
+	w = httptest.NewRecorder()
+	s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("later request = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
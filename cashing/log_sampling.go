@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// logSampler decides which requests the access log records. Paths with a
+// rate of N log one request in N; a rate of 0 silences the path. Paths
+// without a rate log every request.
+type logSampler struct {
+	rates map[string]uint64
+	seen  map[string]*atomic.Uint64
+}
+
+// newLogSampler builds a sampler from per-path rates
+func newLogSampler(rates map[string]int) *logSampler {
+	sampler := &logSampler{
+		rates: make(map[string]uint64, len(rates)),
+		seen:  make(map[string]*atomic.Uint64, len(rates)),
+	}
+	for path, rate := range rates {
+		sampler.rates[path] = uint64(rate)
+		sampler.seen[path] = new(atomic.Uint64)
+	}
+	return sampler
+}
+
+// sample reports whether a request to path should be logged
+func (ls *logSampler) sample(path string) bool {
+	rate, ok := ls.rates[path]
+	if !ok {
+		return true
+	}
+	if rate == 0 {
+		return false
+	}
+	// Log the first request, then every rate-th one after it
+	return (ls.seen[path].Add(1)-1)%rate == 0
+}
+
+// parseSampleRates parses LOG_SAMPLE_RATES entries of the form "path=N"
+func parseSampleRates(entries []string) (map[string]int, error) {
+	rates := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		path, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("LOG_SAMPLE_RATES entries must look like path=N, got %q", entry)
+		}
+		path, err := parsePath("LOG_SAMPLE_RATES", strings.TrimSpace(path))
+		if err != nil {
+			return nil, err
+		}
+		rate, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("LOG_SAMPLE_RATES rate for %s must be a non-negative integer, got %q", path, value)
+		}
+		rates[path] = rate
+	}
+	return rates, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogSampler(t *testing.T) {
+	sampler := newLogSampler(map[string]int{"/health": 3, "/metrics": 0, "/ready": 1})
+
+	count := func(path string, requests int) int {
+		logged := 0
+		for i := 0; i < requests; i++ {
+			if sampler.sample(path) {
+				logged++
+			}
+		}
+		return logged
+	}
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/health", 4},
+		{"/metrics", 0},
+		{"/ready", 10},
+		{"/api/v1/companies", 10},
+	}
+	for _, tt := range tests {
+		if got := count(tt.path, 10); got != tt.want {
+			t.Errorf("logged %d of 10 requests to %s, want %d", got, tt.path, tt.want)
+		}
+	}
+}
+
+func TestParseSampleRates(t *testing.T) {
+	rates, err := parseSampleRates([]string{"/health=100", " /metrics = 0 "})
+	if err != nil {
+		t.Fatalf("parseSampleRates failed: %v", err)
+	}
+	if rates["/health"] != 100 || rates["/metrics"] != 0 || len(rates) != 2 {
+		t.Errorf("rates = %v", rates)
+	}
+
+	for _, entries := range [][]string{{"/health"}, {"/health=-1"}, {"/health=often"}, {"health=1"}} {
+		if _, err := parseSampleRates(entries); err == nil {
+			t.Errorf("parseSampleRates(%q) should fail", entries)
+		}
+	}
+}
+
+func TestLoggingMiddlewareSampling(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	s := newTestServer(t, map[string]string{"LOG_SAMPLE_RATES": "/quiet=0"})
+	status := http.StatusOK
+	handler := s.loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/quiet", nil))
+	if buf.Len() != 0 {
+		t.Errorf("silenced path logged %q", buf.String())
+	}
+	status = http.StatusInternalServerError
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/quiet", nil))
+	if !strings.Contains(buf.String(), "Completed request") || strings.Contains(buf.String(), "Started request") {
+		t.Errorf("log = %q, want only the completed server error", buf.String())
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.log")
+	tests := []struct {
+		format string
+		check  func(line string) bool
+	}{
+		{"json", func(line string) bool { return json.Valid([]byte(line)) }},
+		{"text", func(line string) bool { return strings.Contains(line, "msg=hello") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{
+				"LOG_FORMAT": tt.format,
+				"LOG_OUTPUT": path,
+				"LOG_LEVEL":  "warn",
+			})
+			logger, closeFn, err := newLogger(cfg)
+			if err != nil {
+				t.Fatalf("newLogger failed: %v", err)
+			}
+			logger.Info("dropped")
+			logger.Warn("hello")
+			closeFn()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read log file: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			last := lines[len(lines)-1]
+			if strings.Contains(string(data), "dropped") {
+				t.Errorf("info record written below LOG_LEVEL=warn: %s", data)
+			}
+			if !tt.check(last) {
+				t.Errorf("unexpected %s record: %s", tt.format, last)
+			}
+		})
+	}
+}
+
+func TestNewLoggerUnwritableFile(t *testing.T) {
+	cfg := testConfig(t, map[string]string{
+		"LOG_OUTPUT": filepath.Join(t.TempDir(), "missing", "api.log"),
+	})
+	if _, _, err := newLogger(cfg); err == nil {
+		t.Error("newLogger should fail when the log file cannot be opened")
+	}
+}
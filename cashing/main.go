@@ -3,10 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
+	"net/url"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -25,20 +34,38 @@ type APIResponse struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
+	// Code and Errors are set on validation failures; see
+	// sendValidationError
+	Code   string                  `json:"code,omitempty"`
+	Errors []middleware.FieldError `json:"errors,omitempty"`
+}
+
+// ReplaceAllRequest is the body of a replace-all request
+type ReplaceAllRequest struct {
+	Confirm   bool                 `json:"confirm"`
+	Companies []middleware.Company `json:"companies"`
 }
 
 // Server represents the API server
 type Server struct {
 	batchProcessor *middleware.BatchProcessor
+	config         *Config
 	router        *mux.Router
 	healthy       atomic.Bool
+	logSampler    *logSampler
+	keyLimiter    *keyLimiter
+	batchStats    *batchStats
 }
 
 // NewServer creates a new API server instance
-func NewServer(bp *middleware.BatchProcessor) *Server {
+func NewServer(bp *middleware.BatchProcessor, cfg *Config) *Server {
 	s := &Server{
 		batchProcessor: bp,
-		router:        mux.NewRouter(),
+		config:         cfg,
+		router:        mux.NewRouter().UseEncodedPath(),
+		logSampler:    newLogSampler(cfg.LogSampleRates),
+		keyLimiter:    newKeyLimiter(cfg.APIKeys, cfg.MaxConcurrentPerKey),
+		batchStats:    newBatchStats(cfg),
 	}
 	s.healthy.Store(true)
 	s.setupRoutes()
@@ -47,74 +74,265 @@ func NewServer(bp *middleware.BatchProcessor) *Server {
 
 // setupRoutes configures the API endpoints
 func (s *Server) setupRoutes() {
-	// Create a subrouter for API v1
-	api := s.router.PathPrefix("/api/v1").Subrouter()
-	
-	// Health check endpoint
-	s.router.HandleFunc("/health", s.healthCheckHandler).Methods(http.MethodGet)
-	
-	// API endpoints
-	api.HandleFunc("/companies/batch", s.batchUploadHandler).Methods(http.MethodPost)
-	api.HandleFunc("/companies", s.fetchAllCompaniesHandler).Methods(http.MethodGet)
-	api.HandleFunc("/companies/update-treated", s.updateTreatedHandler).Methods(http.MethodPut)
+	// Health check endpoint, registered first so it can live under the API prefix
+	s.router.HandleFunc(s.config.HealthPath, s.healthCheckHandler).Methods(http.MethodGet)
+
+	// Create a subrouter for the configured API prefix (default /api/v1)
+	api := s.router
+	if s.config.APIPrefix != "/" {
+		api = s.router.PathPrefix(s.config.APIPrefix).Subrouter()
+	}
 	
+	s.registerAPIRoutes(api)
+
+	// With multi-tenancy on, every endpoint is also served per tenant under
+	// /tenants/{tenant}, as an alternative to the X-Tenant-ID header
+	if s.config.MultiTenant {
+		s.registerAPIRoutes(api.PathPrefix("/tenants/{tenant}").Subrouter())
+	}
+
+	// Answer CORS preflight for any path; corsMiddleware supplies the headers
+	s.router.Methods(http.MethodOptions).HandlerFunc(s.preflightHandler)
+
 	// Apply middleware
-	s.router.Use(s.loggingMiddleware)
+	s.router.Use(
+		s.loggingMiddleware,
+		s.recoveryMiddleware,
+		s.hostMiddleware,
+		s.httpsMiddleware,
+		s.corsMiddleware,
+		s.authMiddleware,
+		s.tenantMiddleware,
+		s.readOptionsMiddleware,
+		s.requestTimeoutMiddleware,
+		s.compressionMiddleware,
+	)
 }
 
-// fetchAllCompaniesHandler fetches all companies
+// registerAPIRoutes registers the API endpoints on api
+func (s *Server) registerAPIRoutes(api *mux.Router) {
+	api.HandleFunc("/companies/batch", s.limitBatchBody(s.gunzipBody(s.batchUploadHandler))).Methods(http.MethodPost)
+	api.HandleFunc("/companies/bulk", s.gunzipBody(s.bulkHandler)).Methods(http.MethodPost)
+	api.HandleFunc("/companies/diff", s.gunzipBody(s.diffCompaniesHandler)).Methods(http.MethodPost)
+	api.HandleFunc("/companies/reconcile-treated", s.gunzipBody(s.reconcileTreatedHandler)).Methods(http.MethodPost)
+	api.HandleFunc("/companies", s.fetchAllCompaniesHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies", s.createCompanyHandler).Methods(http.MethodPost)
+	api.HandleFunc("/companies/search", s.searchCompaniesHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/autocomplete", s.autocompleteHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/by-name-length", s.nameLengthHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/changed", s.changedCompaniesHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/incomplete", s.incompleteCompaniesHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/recent", s.recentCompaniesHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/recently-treated", s.recentlyTreatedHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/backup", s.backupHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/group-count", s.groupCountHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/sample", s.sampleCompaniesHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/update-treated", s.deprecated(deprecation{
+		param:       "name",
+		replacement: "PUT /companies/{name}/treated",
+	}, s.updateTreatedHandler)).Methods(http.MethodPut)
+	api.HandleFunc("/companies/{name}/treated", s.setTreatedHandler).Methods(http.MethodPut)
+	api.HandleFunc("/companies/{name}/audit", s.companyAuditHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/rename", s.renameCompanyHandler).Methods(http.MethodPost)
+	api.HandleFunc("/companies/claim", s.claimCompaniesHandler).Methods(http.MethodPost)
+	api.HandleFunc("/companies/{name}", s.companyExistsHandler).Methods(http.MethodHead)
+	api.HandleFunc("/companies/{name}", s.getCompanyHandler).Methods(http.MethodGet)
+	api.HandleFunc("/companies/{name}", s.patchCompanyHandler).Methods(http.MethodPatch)
+	api.HandleFunc("/companies/replace-all", s.requireAPIKey(s.gunzipBody(s.replaceAllHandler))).Methods(http.MethodPost)
+	api.HandleFunc("/imports/stream", s.importFeedHandler).Methods(http.MethodGet)
+	api.HandleFunc("/imports/{id}", s.getImportHandler).Methods(http.MethodGet)
+	api.HandleFunc("/admin/scan", s.requireAPIKey(s.adminScanHandler)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/purge", s.requireAPIKey(s.adminPurgeHandler)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/repair/treated", s.requireAPIKey(s.adminRepairTreatedHandler)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/indexes", s.requireAPIKey(s.adminIndexesHandler)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/archive", s.requireAPIKey(s.adminArchiveHandler)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/cache/warm", s.requireAPIKey(s.adminCacheWarmHandler)).Methods(http.MethodPost)
+	api.HandleFunc("/admin/stats/batches", s.requireAPIKey(s.adminBatchStatsHandler)).Methods(http.MethodGet)
+}
+
+// fetchAllCompaniesHandler fetches all companies, or a single page of them
+// when limit or cursor is given
 func (s *Server) fetchAllCompaniesHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
 	defer cancel()
 
+	if isPaginated(r) {
+		limit, cursor, err := s.parsePageParams(r)
+		if err != nil {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		page, err := s.batchProcessor.FetchCompaniesPage(ctx, limit, cursor)
+		if err == nil {
+			err = s.setTotalCount(ctx, w, r, "")
+		}
+		if err != nil {
+			s.sendPageError(w, ctx, err)
+			return
+		}
+		s.sendPage(w, page)
+		return
+	}
+
+	// Refuse to buffer a list too large to hold in memory
+	if s.config.MaxListSize > 0 {
+		total, err := s.batchProcessor.CountCompanies(ctx, "")
+		if err != nil {
+			s.sendServerError(w, ctx, "Failed to fetch companies", err)
+			return
+		}
+		if total > int64(s.config.MaxListSize) {
+			w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+			s.sendResponse(w, http.StatusRequestEntityTooLarge, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("%d companies exceed the limit of %d for a full list; use limit and cursor to paginate, or GET /companies/backup", total, s.config.MaxListSize),
+			})
+			return
+		}
+	}
+
 	companies, err := s.batchProcessor.FetchAllCompanies(ctx)
 	if err != nil {
-		s.sendResponse(w, http.StatusInternalServerError, APIResponse{
-			Success: false,
-			Message: "Failed to fetch companies: " + err.Error(),
-		})
+		s.sendServerError(w, ctx, "Failed to fetch companies", err)
 		return
 	}
 
+	// The full list is its own total, so no separate count is needed
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(companies)))
 	s.sendResponse(w, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "Companies fetched successfully",
-		Data:    companies,
+		Data:    s.presentCompanies(companies),
 	})
 }
 
 // healthCheckHandler performs a health check
 func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := withRequestTimeout(r, 5*time.Second)
 	defer cancel()
 
 	if err := s.batchProcessor.HealthCheck(ctx); err != nil {
 		s.healthy.Store(false)
 		s.sendResponse(w, http.StatusServiceUnavailable, APIResponse{
 			Success: false,
-			Message: "Service unhealthy: " + err.Error(),
+			Message: s.internalError("Service unhealthy", err),
 		})
 		return
 	}
 
+	// Verifying indexes costs an extra round trip, so probes opt in to it
+	if r.URL.Query().Get("indexes") == "true" {
+		missing, err := s.batchProcessor.MissingIndexes(ctx)
+		if err != nil {
+			s.sendResponse(w, http.StatusServiceUnavailable, APIResponse{
+				Success: false,
+				Message: s.internalError("Service unhealthy", err),
+			})
+			return
+		}
+		if len(missing) > 0 {
+			s.sendResponse(w, http.StatusServiceUnavailable, APIResponse{
+				Success: false,
+				Message: "Service unhealthy: missing indexes",
+				Data: map[string]interface{}{
+					"missing_indexes": missing,
+				},
+			})
+			return
+		}
+	}
+
 	s.healthy.Store(true)
 	s.sendResponse(w, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "Service healthy",
+		Data: map[string]interface{}{
+			"work": s.batchProcessor.WorkStats(),
+		},
 	})
 }
 
-// loggingMiddleware logs each request with timing information
+// loggingMiddleware logs each request with timing information, sampled per
+// path according to LogSampleRates
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		log.Printf("Started %s %s", r.Method, r.URL.Path)
+		sampled := s.logSampler.sample(r.URL.Path)
+		if sampled {
+			slog.Info("Started request", "method", r.Method, "path", r.URL.Path)
+		}
 		
 		// Create a custom response writer to capture the status code
 		wrapped := wrapResponseWriter(w)
 		next.ServeHTTP(wrapped, r)
 		
-		log.Printf("Completed %s %s [%d] in %v", r.Method, r.URL.Path, wrapped.status, time.Since(start))
+		// Server errors are logged even on sampled paths
+		if !sampled && wrapped.status < http.StatusInternalServerError {
+			return
+		}
+		slog.Info("Completed request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", wrapped.status,
+			"duration", time.Since(start))
+	})
+}
+
+// readOptionsMiddleware applies the X-Read-Concern and X-Read-Preference
+// headers to the request's reads: a read concern for callers that need
+// read-after-write consistency, a read preference such as secondaryPreferred
+// for analytics that should stay off the primary
+func (s *Server) readOptionsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var err error
+
+		if level := r.Header.Get("X-Read-Concern"); level != "" {
+			if ctx, err = middleware.WithReadConcern(ctx, level); err != nil {
+				s.sendResponse(w, http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Invalid X-Read-Concern header: " + err.Error(),
+				})
+				return
+			}
+		}
+		if mode := r.Header.Get("X-Read-Preference"); mode != "" {
+			if ctx, err = middleware.WithReadPreference(ctx, mode); err != nil {
+				s.sendResponse(w, http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Invalid X-Read-Preference header: " + err.Error(),
+				})
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// recoveryMiddleware turns a panicking handler into a 500 response
+func (s *Server) recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				slog.Error("Recovered from panic",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"panic", err,
+					"stack", string(debug.Stack()))
+				s.sendResponse(w, http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Internal server error",
+				})
+			}
+		}()
+		next.ServeHTTP(w, r)
 	})
 }
 
@@ -133,8 +351,144 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// parseWriteOptions reads the X-Conflict-Strategy header and the mode,
+// empty_address and fields parameters shared by the batch and single-company
+// uploads. It answers 400 and returns false if any is invalid.
+func (s *Server) parseWriteOptions(w http.ResponseWriter, r *http.Request) (middleware.BatchOptions, bool) {
+	strategy, err := middleware.ParseConflictStrategy(r.Header.Get("X-Conflict-Strategy"))
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid X-Conflict-Strategy header: " + err.Error(),
+		})
+		return middleware.BatchOptions{}, false
+	}
+	mode, err := middleware.ParseWriteMode(r.URL.Query().Get("mode"))
+	if err == nil && mode == middleware.ModeInsert && r.Header.Get("X-Conflict-Strategy") != "" {
+		err = fmt.Errorf("X-Conflict-Strategy does not apply to insert mode")
+	}
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid mode: " + err.Error(),
+		})
+		return middleware.BatchOptions{}, false
+	}
+	keepAddress, err := parseKeepAddress(r)
+	var fields []string
+	if err == nil {
+		fields, err = parseWriteFields(r)
+	}
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return middleware.BatchOptions{}, false
+	}
+	return middleware.BatchOptions{
+		ConflictStrategy: strategy,
+		Mode:             mode,
+		KeepAddress:      keepAddress,
+		Fields:           fields,
+	}, true
+}
+
+// parseWriteFields reads the fields parameter, a comma-separated list of
+// settable fields to restrict the write to; "fields=address" writes names and
+// addresses and leaves treated and the rest untouched. The name is always
+// written and may be listed too; "fields=name" writes names only.
+func parseWriteFields(r *http.Request) ([]string, error) {
+	fields := splitList(r.URL.Query().Get("fields"))
+	for _, field := range fields {
+		if field == "name" {
+			continue
+		}
+		if err := middleware.CheckField(field, middleware.FieldSettable); err != nil {
+			return nil, fmt.Errorf("invalid fields parameter: %v", err)
+		}
+	}
+	return fields, nil
+}
+
+// parseKeepAddress reads the empty_address parameter: "keep" leaves a stored
+// address in place when the incoming one is empty, for pipelines that only
+// touch other fields; "overwrite", the default, clears it
+func parseKeepAddress(r *http.Request) (bool, error) {
+	switch policy := r.URL.Query().Get("empty_address"); policy {
+	case "", "overwrite":
+		return false, nil
+	case "keep":
+		return true, nil
+	default:
+		return false, fmt.Errorf("empty_address must be \"keep\" or \"overwrite\", got %q", policy)
+	}
+}
+
+// parseFullSync reads the sync=full parameter, which makes the batch replace
+// the collection's contents: companies missing from it are deleted, or marked
+// deleted with sync_delete=soft. Being destructive it also needs confirm=true
+// and an API key, and cannot be combined with streaming. It answers the
+// request and returns false if the sync is not allowed.
+func (s *Server) parseFullSync(w http.ResponseWriter, r *http.Request, opts *middleware.BatchOptions) bool {
+	query := r.URL.Query()
+	var err error
+	switch {
+	case query.Get("sync") != "full":
+		err = fmt.Errorf("sync must be \"full\", got %q", query.Get("sync"))
+	case query.Get("confirm") != "true":
+		err = fmt.Errorf("sync=full deletes every company missing from the batch; pass confirm=true to proceed")
+	case query.Get("stream") == "true":
+		err = fmt.Errorf("sync=full cannot be combined with stream=true")
+	case opts.Mode == middleware.ModeInsert:
+		err = fmt.Errorf("sync=full does not apply to insert mode")
+	}
+	if err == nil {
+		switch policy := query.Get("sync_delete"); policy {
+		case "", "hard":
+		case "soft":
+			opts.SoftDelete = true
+		default:
+			err = fmt.Errorf("sync_delete must be \"hard\" or \"soft\", got %q", policy)
+		}
+	}
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return false
+	}
+	if !s.checkAPIKey(w, r) {
+		return false
+	}
+	opts.FullSync = true
+	return true
+}
+
+// partialStatus is the status of a write in which some operations failed:
+// 207 Multi-Status if others succeeded, with the per-company errors in the
+// body, or 500 if none did. Without MultiStatus it is 200 either way, for
+// clients that cannot handle 207.
+func (s *Server) partialStatus(succeeded int) int {
+	switch {
+	case !s.config.MultiStatus:
+		return http.StatusOK
+	case succeeded > 0:
+		return http.StatusMultiStatus
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // batchUploadHandler processes a batch of company data
 func (s *Server) batchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	if !s.healthy.Load() {
 		s.sendResponse(w, http.StatusServiceUnavailable, APIResponse{
 			Success: false,
@@ -143,31 +497,125 @@ func (s *Server) batchUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req CompanyRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if !s.checkContentType(w, r) {
+		return
+	}
+	if isNDJSON(r) {
+		s.importStreamHandler(w, r)
+		return
+	}
+
+	body := &countingReader{r: r.Body}
+	req, err := decodeCompanyRequest(body, s.treatedAliases(r))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.sendBodyTooLarge(w)
+		return
+	}
+	if err != nil {
 		s.sendResponse(w, http.StatusBadRequest, APIResponse{
 			Success: false,
 			Message: "Invalid request body: " + err.Error(),
 		})
 		return
 	}
+	s.batchStats.observe(len(req.Companies), body.n)
+	applySource(req.Companies, importSource(r))
 
 	if len(req.Companies) == 0 {
+		if s.config.AcceptEmptyBatches {
+			s.sendResponse(w, http.StatusOK, APIResponse{
+				Success: true,
+				Message: "Empty batch, nothing to process",
+				Data:    middleware.BatchResult{},
+			})
+			return
+		}
 		s.sendResponse(w, http.StatusBadRequest, APIResponse{
 			Success: false,
 			Message: "No companies provided",
 		})
 		return
 	}
+	if !s.checkWriteOps(w, len(req.Companies)) {
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
+	if err := validateCompanies("companies", req.Companies); err != nil {
+		s.sendValidationError(w, "Invalid companies", err)
+		return
+	}
+	validation := time.Since(start)
+
+	opts, ok := s.parseWriteOptions(w, r)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Has("sync") {
+		if !s.parseFullSync(w, r, &opts) {
+			return
+		}
+	}
 
-	processedCount, err := s.batchProcessor.ProcessBatch(ctx, req.Companies)
+	if r.URL.Query().Get("stream") == "true" {
+		s.streamBatchUpload(w, r, req.Companies, opts)
+		return
+	}
+
+	// The processing deadline is configured separately from the request so
+	// that large synchronous batches can be given more room, and a client may
+	// change it with X-Request-Timeout; extend the server's write deadline to
+	// match so the response can still be sent
+	opts.Timeout = requestTimeout(r, s.config.BatchTimeout)
+	extendWriteDeadline(w, opts.Timeout)
+	result, err := s.batchProcessor.ProcessBatch(r.Context(), req.Companies, opts)
 	if err != nil {
-		s.sendResponse(w, http.StatusInternalServerError, APIResponse{
+		var canceled *middleware.BatchCanceledError
+		var conflict *middleware.NameConflictError
+		switch {
+		case errors.Is(err, middleware.ErrSyncAborted):
+			s.sendResponse(w, http.StatusUnprocessableEntity, APIResponse{
+				Success: false,
+				Message: "Failed to process batch: " + err.Error(),
+				Data:    result,
+			})
+		case errors.As(err, &conflict):
+			s.sendResponse(w, http.StatusConflict, APIResponse{
+				Success: false,
+				Message: "Failed to process batch: " + err.Error(),
+				Data: map[string]interface{}{
+					"conflicts": conflict.Names,
+				},
+			})
+		case errors.As(err, &canceled):
+			status := errorStatus(r.Context(), err)
+			s.sendResponse(w, status, APIResponse{
+				Success: false,
+				Message: s.errorMessage(status, "Failed to process batch", err),
+				Data: map[string]interface{}{
+					"processed_count":  result.Processed,
+					"completed_chunks": canceled.CompletedChunks,
+					"total_chunks":     canceled.TotalChunks,
+				},
+			})
+		default:
+			s.sendServerError(w, r.Context(), "Failed to process batch", err)
+		}
+		return
+	}
+	result.Timing.ValidationMS = middleware.Milliseconds(validation)
+	result.Timing.TotalMS = middleware.Milliseconds(time.Since(start))
+	if r.URL.Query().Get("locations") == "true" {
+		for _, name := range result.Created() {
+			result.Locations = append(result.Locations, s.companyLocation(name))
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		s.sendResponse(w, s.partialStatus(len(req.Companies)-len(result.Errors)), APIResponse{
 			Success: false,
-			Message: "Failed to process batch: " + err.Error(),
+			Message: fmt.Sprintf("Batch partially processed: %d companies failed", len(result.Errors)),
+			Data:    result,
 		})
 		return
 	}
@@ -175,8 +623,191 @@ func (s *Server) batchUploadHandler(w http.ResponseWriter, r *http.Request) {
 	s.sendResponse(w, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "Batch processed successfully",
+		Data:    result,
+	})
+}
+
+// BulkRequest is the body of a mixed upsert/delete request
+type BulkRequest struct {
+	Upserts []middleware.Company `json:"upserts"`
+	Deletes []string             `json:"deletes"`
+}
+
+// bulkHandler applies a mixed set of upserts and deletes in one BulkWrite.
+// Writes are unordered unless ordered=true is given.
+func (s *Server) bulkHandler(w http.ResponseWriter, r *http.Request) {
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	applySource(req.Upserts, importSource(r))
+
+	if len(req.Upserts) == 0 && len(req.Deletes) == 0 {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "No operations provided",
+		})
+		return
+	}
+	if !s.checkWriteOps(w, len(req.Upserts)+len(req.Deletes)) {
+		return
+	}
+
+	if err := validateCompanies("upserts", req.Upserts); err != nil {
+		s.sendValidationError(w, "Invalid companies", err)
+		return
+	}
+
+	ctx, cancel := withWriteTimeout(w, r, 30*time.Second)
+	defer cancel()
+
+	ordered := r.URL.Query().Get("ordered") == "true"
+	result, err := s.batchProcessor.ApplyBulk(ctx, req.Upserts, req.Deletes, ordered)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to apply bulk operations", err)
+		return
+	}
+
+	if len(result.Errors) > 0 {
+		// Ordered writes stop at the first failure, so count what was applied
+		// rather than what was not
+		succeeded := result.Inserted + result.Matched + result.Deleted
+		s.sendResponse(w, s.partialStatus(succeeded), APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Bulk operations partially applied: %d failed", len(result.Errors)),
+			Data:    result,
+		})
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Bulk operations applied successfully",
+		Data:    result,
+	})
+}
+
+// replaceAllHandler replaces the whole collection with the posted companies
+func (s *Server) replaceAllHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReplaceAllRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	applySource(req.Companies, importSource(r))
+
+	if !req.Confirm {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Replacing all companies requires \"confirm\": true",
+		})
+		return
+	}
+
+	if len(req.Companies) == 0 {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "No companies provided",
+		})
+		return
+	}
+	if !s.checkWriteOps(w, len(req.Companies)) {
+		return
+	}
+
+	if err := validateCompanies("companies", req.Companies); err != nil {
+		s.sendValidationError(w, "Invalid companies", err)
+		return
+	}
+
+	ctx, cancel := withWriteTimeout(w, r, 60*time.Second)
+	defer cancel()
+
+	count, err := s.batchProcessor.ReplaceAll(ctx, req.Companies)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to replace companies", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Companies replaced successfully",
 		Data: map[string]interface{}{
-			"processed_count": processedCount,
+			"count": count,
+		},
+	})
+}
+
+// importResponse is an import log entry with one page of the names it wrote
+type importResponse struct {
+	*middleware.ImportLog
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// getImportHandler returns the import log entry for an import id, with the
+// names it wrote paginated by the limit and cursor query parameters
+func (s *Server) getImportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	id, err := pathParam(r, "id")
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid import id in path",
+		})
+		return
+	}
+	limit, cursor, err := s.parsePageParams(r)
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	entry, err := s.batchProcessor.GetImport(ctx, id)
+	if errors.Is(err, middleware.ErrImportNotFound) {
+		s.sendResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Import not found",
+		})
+		return
+	}
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to fetch import", err)
+		return
+	}
+	names, err := s.batchProcessor.ImportNames(ctx, id, limit, cursor)
+	if errors.Is(err, middleware.ErrInvalidCursor) {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid cursor",
+		})
+		return
+	}
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to fetch import", err)
+		return
+	}
+	entry.Names = names.Names
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Import fetched successfully",
+		Data: importResponse{
+			ImportLog:  entry,
+			NextCursor: names.NextCursor,
+			HasMore:    names.HasMore,
 		},
 	})
 }
@@ -192,54 +823,467 @@ func (s *Server) updateTreatedHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
 	defer cancel()
 
 	if err := s.batchProcessor.UpdateTreatedField(ctx, companyName); err != nil {
-		s.sendResponse(w, http.StatusInternalServerError, APIResponse{
+		if errors.Is(err, middleware.ErrCompanyNotFound) {
+			s.sendResponse(w, http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		s.sendServerError(w, ctx, "Failed to update treated field", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Company treated field updated successfully",
+	})
+}
+
+// SetTreatedRequest is the optional body of a set-treated request
+type SetTreatedRequest struct {
+	Treated *bool `json:"treated"`
+}
+
+// setTreatedHandler sets the treated status of the company named in the path.
+// Without a body the company is marked treated.
+func (s *Server) setTreatedHandler(w http.ResponseWriter, r *http.Request) {
+	companyName, err := pathParam(r, "name")
+	if err != nil || companyName == "" {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
 			Success: false,
-			Message: "Failed to update treated field: " + err.Error(),
+			Message: "Invalid company name in path",
 		})
 		return
 	}
 
+	treated := true
+	var req SetTreatedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	if req.Treated != nil {
+		treated = *req.Treated
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	if err := s.batchProcessor.SetTreated(ctx, companyName, treated); err != nil {
+		if errors.Is(err, middleware.ErrCompanyNotFound) {
+			s.sendResponse(w, http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		s.sendServerError(w, ctx, "Failed to update treated field", err)
+		return
+	}
+
 	s.sendResponse(w, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "Company treated field updated successfully",
+		Data: map[string]interface{}{
+			"name":    companyName,
+			"treated": treated,
+		},
+	})
+}
+
+// companyExistsHandler answers 200 if the named company exists and 404 if
+// not, without a body
+func (s *Server) companyExistsHandler(w http.ResponseWriter, r *http.Request) {
+	companyName, err := pathParam(r, "name")
+	if err != nil || companyName == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 5*time.Second)
+	defer cancel()
+
+	exists, err := s.batchProcessor.CompanyExists(ctx, companyName)
+	switch {
+	case err != nil:
+		slog.Error("Failed to check company existence", "name", companyName, "error", err)
+		w.WriteHeader(errorStatus(ctx, err))
+	case exists:
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// getCompanyHandler returns a single company by name, with include=history
+// together with its recent audit entries
+func (s *Server) getCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	companyName, err := pathParam(r, "name")
+	if err != nil || companyName == "" {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid company name in path",
+		})
+		return
+	}
+
+	withHistory, historyLimit, err := s.parseHistoryInclude(r)
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 5*time.Second)
+	defer cancel()
+
+	var company *middleware.Company
+	var history []middleware.AuditEntry
+	if withHistory {
+		company, history, err = s.batchProcessor.GetCompanyWithHistory(ctx, companyName, historyLimit)
+	} else {
+		company, err = s.batchProcessor.GetCompany(ctx, companyName)
+	}
+	if err != nil {
+		status := errorStatus(ctx, err)
+		if errors.Is(err, middleware.ErrCompanyNotFound) {
+			status = http.StatusNotFound
+		}
+		s.sendResponse(w, status, APIResponse{
+			Success: false,
+			Message: s.errorMessage(status, "Failed to fetch company", err),
+		})
+		return
+	}
+
+	if withHistory {
+		s.sendResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Company fetched successfully",
+			Data: CompanyWithHistory{
+				Company: s.presentCompany(*company),
+				History: history,
+			},
+		})
+		return
+	}
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Company fetched successfully",
+		Data:    s.presentCompany(*company),
+	})
+}
+
+// CompanyWithHistory is the response to GET /companies/{name}?include=history
+type CompanyWithHistory struct {
+	Company interface{} `json:"company"`
+	// History lists the company's most recent audit entries, newest first
+	History []middleware.AuditEntry `json:"history"`
+}
+
+// parseHistoryInclude reads the include parameter, a comma-separated list in
+// which "history" is the only value, and history_limit, the number of audit
+// entries to return with it (default DefaultPageSize, at most MaxPageSize)
+func (s *Server) parseHistoryInclude(r *http.Request) (bool, int, error) {
+	withHistory := false
+	for _, include := range splitList(r.URL.Query().Get("include")) {
+		if include != "history" {
+			return false, 0, fmt.Errorf("include must be \"history\", got %q", include)
+		}
+		withHistory = true
+	}
+	limit := s.config.DefaultPageSize
+	if value := r.URL.Query().Get("history_limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > s.config.MaxPageSize {
+			return false, 0, fmt.Errorf("history_limit must be between 1 and %d, got %q", s.config.MaxPageSize, value)
+		}
+		limit = n
+	}
+	return withHistory, limit, nil
+}
+
+// createCompanyHandler upserts a single company through the same path as a
+// batch upload, honouring X-Conflict-Strategy and mode in the same way. A
+// newly created company is answered with 201 and a Location header pointing
+// at it.
+func (s *Server) createCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkContentType(w, r) {
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&fields)
+	var company middleware.Company
+	if err == nil {
+		company, err = decodeAliasedCompany(fields, s.treatedAliases(r))
+	}
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid company: " + err.Error(),
+		})
+		return
+	}
+	if company.Source == "" {
+		company.Source = importSource(r)
+	}
+
+	if err := company.Validate(); err != nil {
+		s.sendValidationError(w, "Invalid company", err)
+		return
+	}
+	opts, ok := s.parseWriteOptions(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 5*time.Second)
+	defer cancel()
+
+	result, err := s.batchProcessor.UpsertCompany(ctx, company, opts)
+	if err != nil {
+		status := errorStatus(ctx, err)
+		var writeErr *middleware.WriteError
+		var conflict *middleware.NameConflictError
+		switch {
+		case errors.As(err, &conflict):
+			status = http.StatusConflict
+		case errors.As(err, &writeErr) && writeErr.Code == middleware.DuplicateKeyCode:
+			status = http.StatusConflict
+		case errors.As(err, &writeErr) && (writeErr.Code == http.StatusBadRequest || writeErr.Code == http.StatusRequestEntityTooLarge):
+			status = writeErr.Code
+		}
+		s.sendResponse(w, status, APIResponse{
+			Success: false,
+			Message: s.errorMessage(status, "Failed to save company", err),
+		})
+		return
+	}
+
+	if result.Skipped > 0 {
+		s.sendResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Company already exists and was left unchanged",
+		})
+		return
+	}
+	if len(result.Created()) == 0 {
+		s.sendResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Company updated successfully",
+		})
+		return
+	}
+	w.Header().Set("Location", s.companyLocation(company.Name))
+	s.sendResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Company created successfully",
+	})
+}
+
+// companyLocation returns the URL path of the named company, escaping the
+// name as a single path segment
+func (s *Server) companyLocation(name string) string {
+	return strings.TrimSuffix(s.config.APIPrefix, "/") + "/companies/" + url.PathEscape(name)
+}
+
+// companyAuditHandler returns the audit history of a company
+func (s *Server) companyAuditHandler(w http.ResponseWriter, r *http.Request) {
+	companyName, err := pathParam(r, "name")
+	if err != nil || companyName == "" {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid company name in path",
+		})
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	entries, err := s.batchProcessor.CompanyAudit(ctx, companyName)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to fetch audit history", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Audit history fetched successfully",
+		Data:    entries,
 	})
 }
 
+// RenameRequest is the body of a rename request
+type RenameRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// renameCompanyHandler renames a company
+func (s *Server) renameCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	var req RenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if req.From == "" || req.To == "" {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Both \"from\" and \"to\" names are required",
+		})
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	err := s.batchProcessor.RenameCompany(ctx, req.From, req.To)
+	switch {
+	case errors.Is(err, middleware.ErrCompanyNotFound):
+		s.sendResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	case errors.Is(err, middleware.ErrCompanyExists):
+		s.sendResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	case err != nil:
+		s.sendServerError(w, ctx, "Failed to rename company", err)
+	default:
+		s.sendResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Company renamed successfully",
+			Data: map[string]interface{}{
+				"name": req.To,
+			},
+		})
+	}
+}
+
+// pathParam returns a decoded route variable. The router matches on the
+// encoded path so that names may contain an escaped '/'.
+func pathParam(r *http.Request, key string) (string, error) {
+	return url.PathUnescape(mux.Vars(r)[key])
+}
+
 // sendResponse sends a JSON response
 func (s *Server) sendResponse(w http.ResponseWriter, status int, response APIResponse) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding response: %v", err)
+		slog.Error("Error encoding response", "error", err)
 	}
 }
 
+// The server's listen address and its whole-request timeouts
+const (
+	serverAddr         = ":8080"
+	serverReadTimeout  = 15 * time.Second
+	serverWriteTimeout = 15 * time.Second
+)
+
 func main() {
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+
+	logger, closeLog, err := newLogger(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize logger:", err)
+	}
+	slog.SetDefault(logger)
+
+	// os.Exit skips deferred calls, so the log is closed, and a log file
+	// flushed, before exiting
+	err = run(cfg)
+	if err != nil {
+		slog.Error("Server failed", "error", err)
+	}
+	closeLog()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// run starts the server with cfg and blocks until it is shut down. It
+// returns an error if the server cannot start or stops for any other reason
+// than a shutdown.
+func run(cfg *Config) error {
 	// Initialize MongoDB connection
+	opts := []middleware.Option{
+		middleware.WithRetryableWrites(cfg.MongoRetryWrites),
+		middleware.WithRetryableReads(cfg.MongoRetryReads),
+		middleware.WithTransientRetries(cfg.MongoTransientRetries),
+		middleware.WithAppName(cfg.MongoAppName),
+		middleware.WithSettableFields(cfg.UpsertFields...),
+		middleware.WithBatchLogLevel(cfg.BatchLogLevel),
+		middleware.WithSeenCounter(cfg.TrackSeen),
+		middleware.WithListCacheTTL(cfg.ListCacheTTL),
+		middleware.WithListCacheCompression(cfg.ListCacheCompress),
+		middleware.WithIndexBuildMode(cfg.IndexBuildMode),
+		middleware.WithIndexRaceRetries(cfg.IndexRaceRetries),
+		middleware.WithAddressNormalization(cfg.AddressNormalization),
+		middleware.WithRawAddress(cfg.KeepRawAddress),
+	}
+	if cfg.NameCollationLocale != "" {
+		opts = append(opts, middleware.WithNameCollation(cfg.NameCollationLocale, cfg.NameCollationStrength))
+	}
+	store := defaultMongoSettings
+	logEffectiveConfig(cfg, store)
 	bp, err := middleware.NewBatchProcessor(
-		"mongodb://localhost:27017",
-		"companies_db",
-		"companies",
-		100, // batch size
-		4,   // number of workers
+		store.URI,
+		store.Database,
+		store.Collection,
+		store.BatchSize,
+		store.Workers,
+		opts...,
 	)
 	if err != nil {
-		log.Fatal("Failed to initialize batch processor:", err)
+		return fmt.Errorf("failed to initialize batch processor: %w", err)
+	}
+
+	if cfg.SelfTest {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := bp.SelfTest(ctx)
+		cancel()
+		if err != nil {
+			bp.Close(context.Background())
+			return fmt.Errorf("startup self-test failed: %w", err)
+		}
+		slog.Info("Startup self-test passed")
 	}
 
 	// Create and configure the server
-	server := NewServer(bp)
+	server := NewServer(bp, cfg)
 	httpServer := &http.Server{
-		Addr:         ":8080",
-		Handler:      server.router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:              serverAddr,
+		Handler:           server.router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+		WriteTimeout:      serverWriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
 	}
+	httpServer.SetKeepAlivesEnabled(cfg.KeepAlive)
 
 	// Graceful shutdown handling
 	go func() {
@@ -247,21 +1291,32 @@ func main() {
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
 
-		log.Println("Shutting down server...")
+		slog.Info("Shutting down server...")
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
 		if err := httpServer.Shutdown(ctx); err != nil {
-			log.Printf("Server shutdown error: %v", err)
+			slog.Error("Server shutdown error", "error", err)
 		}
 		if err := bp.Close(ctx); err != nil {
-			log.Printf("MongoDB connection closure error: %v", err)
+			slog.Error("MongoDB connection closure error", "error", err)
 		}
 	}()
 
+	listener, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		bp.Close(context.Background())
+		return fmt.Errorf("failed to listen on %s: %w", httpServer.Addr, err)
+	}
+	// Excess connections wait in the kernel accept queue instead of using fds
+	if cfg.MaxConnections > 0 {
+		listener = newLimitListener(listener, cfg.MaxConnections)
+	}
+
 	// Start the server
-	log.Printf("Server starting on port 8080")
-	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatal("Server error:", err)
+	slog.Info("Server starting on port 8080", "max_connections", cfg.MaxConnections)
+	if err := httpServer.Serve(listener); err != http.ErrServerClosed {
+		return fmt.Errorf("server error: %w", err)
 	}
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	s := newTestServer(t, nil)
+	handler := s.recoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/companies", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
+
+func TestReadOptionsMiddleware(t *testing.T) {
+	s := newTestServer(t, nil)
+	handler := s.readOptionsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	tests := []struct {
+		header, value string
+		want          int
+	}{
+		{"X-Read-Concern", "majority", http.StatusNoContent},
+		{"X-Read-Concern", "snapshot", http.StatusBadRequest},
+		{"X-Read-Preference", "secondaryPreferred", http.StatusNoContent},
+		{"X-Read-Preference", "fastest", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/companies", nil)
+		r.Header.Set(tt.header, tt.value)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: %s answered %d, want %d", tt.header, tt.value, w.Code, tt.want)
+		}
+	}
+}
+
+func TestParseKeepAddress(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    bool
+		wantErr bool
+	}{
+		{"", false, false},
+		{"?empty_address=overwrite", false, false},
+		{"?empty_address=keep", true, false},
+		{"?empty_address=ignore", false, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/companies/batch"+tt.query, nil)
+		got, err := parseKeepAddress(r)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseKeepAddress(%q) = %v, %v; want %v, error %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestBatchUploadRejectsBadEmptyAddress(t *testing.T) {
+	s := newTestServer(t, nil)
+	w := serve(s, http.MethodPost, "/api/v1/companies/batch?empty_address=ignore", `{"companies":[{"name":"Acme"}]}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPartialStatus(t *testing.T) {
+	tests := []struct {
+		policy    string
+		succeeded int
+		want      int
+	}{
+		{"207", 1, http.StatusMultiStatus},
+		{"207", 0, http.StatusInternalServerError},
+		{"200", 1, http.StatusOK},
+		{"200", 0, http.StatusOK},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t, map[string]string{"PARTIAL_SUCCESS_STATUS": tt.policy})
+		if got := s.partialStatus(tt.succeeded); got != tt.want {
+			t.Errorf("partialStatus(%d) with PARTIAL_SUCCESS_STATUS=%s = %d, want %d", tt.succeeded, tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestBatchUploadPartialFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		body   string
+		want   int
+	}{
+		{"some failed", "207", `{"companies":[{"name":"Acme"},{"name":"Globex"}]}`, http.StatusMultiStatus},
+		{"all failed", "207", `{"companies":[{"name":"Acme"}]}`, http.StatusInternalServerError},
+		{"some failed without 207", "200", `{"companies":[{"name":"Acme"},{"name":"Globex"}]}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStoreTestServer(t, map[string]string{"PARTIAL_SUCCESS_STATUS": tt.policy})
+			if w := serve(s, http.MethodPost, "/api/v1/companies/batch", `{"companies":[{"name":"Acme"}]}`, nil); w.Code != http.StatusOK {
+				t.Fatalf("seeding upload answered %d: %s", w.Code, w.Body)
+			}
+
+			// Inserting a company that already exists fails for that company only
+			w := serve(s, http.MethodPost, "/api/v1/companies/batch?mode=insert", tt.body, nil)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), `"errors"`) {
+				t.Errorf("body = %s, want the per-company errors", w.Body)
+			}
+		})
+	}
+}
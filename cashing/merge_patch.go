@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"company-api/middleware"
+)
+
+// maxPatchBytes caps a merge patch body at MongoDB's document size limit
+const maxPatchBytes = 16 * 1024 * 1024
+
+// patchCompanyHandler applies an RFC 7386 JSON Merge Patch to the company
+// named in the path: present members are set, explicit nulls are removed and
+// omitted members are left unchanged
+func (s *Server) patchCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	companyName, err := pathParam(r, "name")
+	if err != nil || companyName == "" {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid company name in path",
+		})
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		s.sendResponse(w, http.StatusUnsupportedMediaType, APIResponse{
+			Success: false,
+			Message: "Content-Type must be application/merge-patch+json",
+		})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchBytes))
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	patch, err := middleware.ParseMergePatch(body)
+	if err != nil {
+		s.sendValidationError(w, "Invalid request body", err)
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	company, err := s.batchProcessor.PatchCompany(ctx, companyName, patch)
+	if err != nil {
+		status := errorStatus(ctx, err)
+		if errors.Is(err, middleware.ErrCompanyNotFound) {
+			status = http.StatusNotFound
+		}
+		s.sendResponse(w, status, APIResponse{
+			Success: false,
+			Message: s.errorMessage(status, "Failed to patch company", err),
+		})
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Company patched successfully",
+		Data:    s.presentCompany(*company),
+	})
+}
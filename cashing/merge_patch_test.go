@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPatchCompanyRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"wrong content type", "text/plain", `{"address":"1 Main St"}`, http.StatusUnsupportedMediaType},
+		{"not an object", "application/merge-patch+json", `"1 Main St"`, http.StatusBadRequest},
+		{"name", "application/merge-patch+json", `{"name":"Globex"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			w := serve(s, http.MethodPatch, "/api/v1/companies/Acme", tt.body, http.Header{"Content-Type": {tt.contentType}})
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
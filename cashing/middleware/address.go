@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// AddressNormalization selects how upserts clean up incoming addresses
+type AddressNormalization string
+
+const (
+	// AddressVerbatim stores addresses exactly as received
+	AddressVerbatim AddressNormalization = "verbatim"
+	// AddressWhitespace trims addresses and collapses runs of whitespace,
+	// including newlines, into single spaces
+	AddressWhitespace AddressNormalization = "whitespace"
+	// AddressTitleCase also title-cases every word, so "12 HIGH st" becomes
+	// "12 High St"
+	AddressTitleCase AddressNormalization = "title"
+)
+
+// ParseAddressNormalization validates a normalization name; an empty value
+// selects AddressVerbatim
+func ParseAddressNormalization(value string) (AddressNormalization, error) {
+	switch mode := AddressNormalization(strings.ToLower(value)); mode {
+	case "":
+		return AddressVerbatim, nil
+	case AddressVerbatim, AddressWhitespace, AddressTitleCase:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown address normalization %q (want verbatim, whitespace or title)", value)
+	}
+}
+
+// apply returns address normalized under mode
+func (mode AddressNormalization) apply(address string) string {
+	switch mode {
+	case AddressWhitespace:
+		return strings.Join(strings.Fields(address), " ")
+	case AddressTitleCase:
+		return titleCase(strings.Join(strings.Fields(address), " "))
+	default:
+		return address
+	}
+}
+
+// titleCase upper-cases the first letter of every word and lower-cases the
+// rest. Words start after a space or hyphen, so "12th" and "o'neil" keep
+// their lowercase letters after the first character.
+func titleCase(s string) string {
+	runes := []rune(s)
+	start := true
+	for i, r := range runes {
+		if start {
+			runes[i] = unicode.ToUpper(r)
+		} else {
+			runes[i] = unicode.ToLower(r)
+		}
+		start = r == ' ' || r == '-'
+	}
+	return string(runes)
+}
+
+// setAddress adds company's normalized address to doc, along with the
+// address as received when raw addresses are kept. With keepAddress an
+// address that normalizes to empty is left out, keeping the stored one.
+func setAddress(doc bson.M, company Company, settings writeSettings) {
+	address := settings.addressNormalization.apply(company.Address)
+	if address == "" && settings.keepAddress {
+		return
+	}
+	doc["address"] = address
+	if settings.rawAddress {
+		doc["addressRaw"] = company.Address
+	}
+}
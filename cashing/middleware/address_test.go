@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseAddressNormalization(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    AddressNormalization
+		wantErr bool
+	}{
+		{"", AddressVerbatim, false},
+		{"verbatim", AddressVerbatim, false},
+		{"Whitespace", AddressWhitespace, false},
+		{"title", AddressTitleCase, false},
+		{"upper", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAddressNormalization(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAddressNormalization(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAddressNormalizationApply(t *testing.T) {
+	address := "  12th  HIGH st\n  o'neil-SMITH  bldg "
+	tests := []struct {
+		mode AddressNormalization
+		want string
+	}{
+		{AddressVerbatim, address},
+		{AddressWhitespace, "12th HIGH st o'neil-SMITH bldg"},
+		{AddressTitleCase, "12th High St O'neil-Smith Bldg"},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.apply(address); got != tt.want {
+			t.Errorf("%s apply = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestSetAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  string
+		settings writeSettings
+		want     bson.M
+	}{
+		{"verbatim", " 1 main st ", writeSettings{addressNormalization: AddressVerbatim}, bson.M{"address": " 1 main st "}},
+		{"normalized with raw", " 1 main st ", writeSettings{addressNormalization: AddressTitleCase, rawAddress: true}, bson.M{"address": "1 Main St", "addressRaw": " 1 main st "}},
+		{"blank kept", "   ", writeSettings{addressNormalization: AddressWhitespace, keepAddress: true, rawAddress: true}, bson.M{}},
+		{"blank cleared", "   ", writeSettings{addressNormalization: AddressWhitespace}, bson.M{"address": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := bson.M{}
+			setAddress(doc, Company{Name: "Acme", Address: tt.address}, tt.settings)
+			if !reflect.DeepEqual(doc, tt.want) {
+				t.Errorf("doc = %v, want %v", doc, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessBatchAddressNormalization(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		want    string
+		wantRaw string
+	}{
+		{"enabled", []Option{WithAddressNormalization(AddressTitleCase), WithRawAddress(true)}, "12 High St", "  12  HIGH st "},
+		{"disabled", nil, "  12  HIGH st ", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bp := newTestProcessor(t, tt.opts...)
+			ctx := context.Background()
+			if _, err := bp.ProcessBatch(ctx, []Company{{Name: "Acme", Address: "  12  HIGH st "}}, BatchOptions{}); err != nil {
+				t.Fatalf("ProcessBatch failed: %v", err)
+			}
+			company, err := bp.GetCompany(ctx, "Acme")
+			if err != nil {
+				t.Fatalf("GetCompany failed: %v", err)
+			}
+			if company.Address != tt.want || company.AddressRaw != tt.wantRaw {
+				t.Errorf("address = %q, raw %q; want %q, raw %q", company.Address, company.AddressRaw, tt.want, tt.wantRaw)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// actorKey is the context key for the identity performing a request
+type actorKey struct{}
+
+// anonymousActor is recorded when a change is made without credentials
+const anonymousActor = "anonymous"
+
+// WithActor returns a context recording who performs the operations run
+// with it
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFrom returns the actor recorded in ctx
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return anonymousActor
+}
+
+// AuditEntry records a change made to a company. Tenant is empty for the
+// default tenant.
+type AuditEntry struct {
+	Company   string    `bson:"company" json:"company"`
+	Tenant    string    `bson:"tenant,omitempty" json:"tenant,omitempty"`
+	Action    string    `bson:"action" json:"action"`
+	Actor     string    `bson:"actor" json:"actor"`
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+}
+
+// ensureAuditIndexes creates the index used to read a company's history.
+// History is looked up by name as companies are, so the index carries the
+// name collation; a collated index gets a name of its own so it can sit next
+// to an uncollated one built before the collation was configured.
+func ensureAuditIndexes(ctx context.Context, audit *mongo.Collection, collation *options.Collation) error {
+	opts := options.Index()
+	if collation != nil {
+		opts.SetName("company_1_timestamp_-1_collated").SetCollation(collation)
+	}
+	_, err := audit.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "company", Value: 1}, {Key: "timestamp", Value: -1}},
+		Options: opts,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create audit index: %v", err)
+	}
+	return nil
+}
+
+// recordAudit writes an audit entry for a change to a company, recorded under
+// the company's stored name. The change has already been made, so a failure
+// is logged rather than returned.
+func (bp *BatchProcessor) recordAudit(ctx context.Context, company, action string) {
+	entry := AuditEntry{
+		Company:   company,
+		Tenant:    tenantFrom(ctx),
+		Action:    action,
+		Actor:     actorFrom(ctx),
+		Timestamp: time.Now().UTC(),
+	}
+	if _, err := bp.audit.InsertOne(ctx, entry); err != nil {
+		slog.Error("Failed to record audit entry", "company", company, "action", action, "error", err)
+	}
+}
+
+// CompanyAudit returns a company's audit history, newest first
+func (bp *BatchProcessor) CompanyAudit(ctx context.Context, company string) (_ []AuditEntry, err error) {
+	defer recoverPanic("CompanyAudit", &err)
+	return bp.companyAudit(ctx, company, 0)
+}
+
+// GetCompanyWithHistory retrieves a company by name together with its limit
+// most recent audit entries, newest first. A missing company fails with
+// ErrCompanyNotFound and its history is not read.
+func (bp *BatchProcessor) GetCompanyWithHistory(ctx context.Context, name string, limit int) (_ *Company, _ []AuditEntry, err error) {
+	defer recoverPanic("GetCompanyWithHistory", &err)
+	company, err := bp.GetCompany(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	history, err := bp.companyAudit(ctx, name, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return company, history, nil
+}
+
+// companyAudit returns up to limit of the audit entries of a company of ctx's
+// tenant, newest first; limit 0 returns them all
+func (bp *BatchProcessor) companyAudit(ctx context.Context, company string, limit int) ([]AuditEntry, error) {
+	opts := findOptions(ctx).SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	opts.SetCollation(bp.nameCollation)
+	cursor, err := bp.audit.Find(ctx, bson.M{"company": company, "tenant": tenantFilter(ctx)}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch audit history: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode audit history: %v", err)
+	}
+	return entries, nil
+}
+
+// renameAudit moves a company's audit history to its new name so it is not
+// orphaned by a rename
+func (bp *BatchProcessor) renameAudit(ctx context.Context, oldName, newName string) {
+	_, err := bp.audit.UpdateMany(ctx,
+		bson.M{"company": oldName, "tenant": tenantFilter(ctx)},
+		bson.M{"$set": bson.M{"company": newName}},
+		options.Update().SetCollation(bp.nameCollation))
+	if err != nil {
+		slog.Error("Failed to move audit history to renamed company", "from", oldName, "to", newName, "error", err)
+	}
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestActorFrom(t *testing.T) {
+	if got := actorFrom(context.Background()); got != anonymousActor {
+		t.Errorf("actorFrom without an actor = %q, want %q", got, anonymousActor)
+	}
+	if got := actorFrom(WithActor(context.Background(), "importer")); got != "importer" {
+		t.Errorf("actorFrom = %q, want importer", got)
+	}
+}
+
+func TestCompanyAudit(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := WithActor(context.Background(), "importer")
+	seedCompanies(t, bp, Company{Name: "Acme"})
+
+	for _, treated := range []bool{true, true, false} {
+		if err := bp.SetTreated(ctx, "Acme", treated); err != nil {
+			t.Fatalf("SetTreated(%v) failed: %v", treated, err)
+		}
+	}
+
+	entries, err := bp.CompanyAudit(ctx, "Acme")
+	if err != nil {
+		t.Fatalf("CompanyAudit failed: %v", err)
+	}
+	// Setting the value the company already has is not a change
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2: %+v", len(entries), entries)
+	}
+	if entries[0].Action != "untreated" || entries[1].Action != "treated" {
+		t.Errorf("actions = %s, %s; want untreated, treated (newest first)", entries[0].Action, entries[1].Action)
+	}
+	if entries[0].Actor != "importer" {
+		t.Errorf("actor = %q, want importer", entries[0].Actor)
+	}
+}
+
+func TestGetCompanyWithHistory(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"})
+	for _, treated := range []bool{true, false, true} {
+		if err := bp.SetTreated(ctx, "Acme", treated); err != nil {
+			t.Fatalf("SetTreated(%v) failed: %v", treated, err)
+		}
+	}
+
+	company, history, err := bp.GetCompanyWithHistory(ctx, "Acme", 2)
+	if err != nil {
+		t.Fatalf("GetCompanyWithHistory failed: %v", err)
+	}
+	if company.Name != "Acme" || !company.Treated {
+		t.Errorf("company = %+v, want treated Acme", company)
+	}
+	if len(history) != 2 || history[0].Action != "treated" || history[1].Action != "untreated" {
+		t.Errorf("history = %+v, want the 2 newest entries, newest first", history)
+	}
+
+	if _, _, err := bp.GetCompanyWithHistory(ctx, "Globex", 2); !errors.Is(err, ErrCompanyNotFound) {
+		t.Errorf("GetCompanyWithHistory of an unknown company = %v, want ErrCompanyNotFound", err)
+	}
+}
+
+func TestCompanyAuditStoredName(t *testing.T) {
+	bp := newTestProcessor(t, WithNameCollation("en", 2))
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"})
+
+	if err := bp.SetTreated(ctx, "ACME", true); err != nil {
+		t.Fatalf("SetTreated failed: %v", err)
+	}
+	if _, err := bp.PatchCompany(ctx, "acme", MergePatch{Set: map[string]interface{}{"industry": "Tools"}}); err != nil {
+		t.Fatalf("PatchCompany failed: %v", err)
+	}
+
+	entries, err := bp.CompanyAudit(ctx, "aCmE")
+	if err != nil {
+		t.Fatalf("CompanyAudit failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2: %+v", len(entries), entries)
+	}
+	for _, entry := range entries {
+		if entry.Company != "Acme" {
+			t.Errorf("entry recorded under %q, want the stored name Acme", entry.Company)
+		}
+	}
+
+	// History follows the company through a rename
+	if err := bp.RenameCompany(ctx, "acme", "Acme Corp"); err != nil {
+		t.Fatalf("RenameCompany failed: %v", err)
+	}
+	entries, err = bp.CompanyAudit(ctx, "Acme Corp")
+	if err != nil {
+		t.Fatalf("CompanyAudit after rename failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %d audit entries after rename, want 2: %+v", len(entries), entries)
+	}
+}
@@ -1,43 +1,146 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"sort"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 // Company represents the company structure
+//
+// Metadata carries importer-specific fields (industry, phone, source, ...).
+// Upserts merge it key by key: each incoming key overwrites that key only,
+// and keys absent from the upload are left untouched, so several sources can
+// contribute to the same company without clobbering each other.
 type Company struct {
-	Name    string `bson:"name" json:"name"`
-	Address string `bson:"address" json:"address"`
-	Treated bool   `bson:"treated" json:"treated"`
+	ID       primitive.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`
+	Name     string                 `bson:"name" json:"name"`
+	Address  string                 `bson:"address" json:"address"`
+	Treated  bool                   `bson:"treated" json:"treated"`
+	Metadata map[string]interface{} `bson:"metadata,omitempty" json:"metadata,omitempty"`
+	// CreatedAt and UpdatedAt are maintained by the server; UpdatedAt only
+	// moves when a write actually changes the company
+	CreatedAt time.Time `bson:"createdAt,omitempty" json:"created_at"`
+	UpdatedAt time.Time `bson:"updatedAt,omitempty" json:"updated_at"`
+	// TreatedAt is when the company was last marked treated; it is cleared
+	// when the company is untreated
+	TreatedAt time.Time `bson:"treatedAt,omitempty" json:"treated_at"`
+	// Source names the pipeline that last wrote the company; uploads set it
+	// per company or for the whole batch with X-Import-Source
+	Source string `bson:"source,omitempty" json:"source,omitempty"`
+	// Seen counts the uploads that have included the company
+	Seen int `bson:"seen,omitempty" json:"seen"`
+	// AddressRaw is the address as received, stored alongside the
+	// normalized Address when the processor keeps raw addresses
+	AddressRaw string `bson:"addressRaw,omitempty" json:"address_raw,omitempty"`
 }
 
+// Validate checks that the company can be stored, returning a
+// *ValidationError listing every invalid field. A name is required. Metadata
+// keys are written as dotted paths, so they must be non-empty and free of '.'
+// and a leading '$'.
+func (c Company) Validate() error {
+	invalid := &ValidationError{Company: c.Name}
+	if c.Name == "" {
+		invalid.add("name", "is required")
+	}
+	keys := make([]string, 0, len(c.Metadata))
+	for key := range c.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !validMetadataKey(key) {
+			invalid.add("metadata."+key, "invalid metadata key %q", key)
+		}
+	}
+	return invalid.err()
+}
+
+// UnmarshalJSON decodes a company, keeping numbers in metadata as json.Number
+// rather than float64 so large integers survive exactly. The BSON encoder
+// stores a json.Number as an int64 when it is an integer.
+func (c *Company) UnmarshalJSON(data []byte) error {
+	// company has Company's fields but not this method, avoiding recursion
+	type company Company
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode((*company)(c))
+}
+
+// nameIndex is the name MongoDB assigns to the unique index on name
+const nameIndex = "name_1"
+
+// expectedIndexes lists the indexes the service relies on for correctness
+var expectedIndexes = []string{nameIndex}
+
 // BatchProcessor handles operations related to batch processing
 type BatchProcessor struct {
 	client     *mongo.Client
 	collection *mongo.Collection
+	imports    *mongo.Collection
+	importFeed *importFeed
+	audit      *mongo.Collection
 	batchSize  int
 	workers    int
+	fields     fieldSet
+	countSeen  bool
+	cache      *listCache
+	work       workCounters
+	indexBuild indexBuild
+	tenants    *tenantCollections
+	// importNames holds the names each import wrote, keyed by import id
+	importNames *mongo.Collection
+	// nameCollation is applied to the name index and to every lookup by
+	// name, so that lookups can use the index
+	nameCollation *options.Collation
+	// batchLogLevel is the level of the per-chunk "Processed companies" log
+	batchLogLevel slog.Level
+	// transientRetries is how often a transient failure is retried
+	transientRetries int
+	// addressNormalization is applied to addresses before they are written
+	addressNormalization AddressNormalization
+	// rawAddress also stores each address as received
+	rawAddress bool
 }
 
-// NewBatchProcessor creates a new BatchProcessor
-func NewBatchProcessor(uri, dbName, collName string, batchSize, numWorkers int) (*BatchProcessor, error) {
+// NewBatchProcessor creates a new BatchProcessor. batchSize and numWorkers
+// must be positive.
+func NewBatchProcessor(uri, dbName, collName string, batchSize, numWorkers int, opts ...Option) (*BatchProcessor, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive, got %d", batchSize)
+	}
+	if numWorkers <= 0 {
+		return nil, fmt.Errorf("number of workers must be positive, got %d", numWorkers)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Configure MongoDB client with proper options
-	clientOptions := options.Client().
-		ApplyURI(uri).
-		SetConnectTimeout(5 * time.Second).
-		SetServerSelectionTimeout(5 * time.Second).
-		SetMaxPoolSize(uint64(numWorkers * 2))
+	settings := defaultProcessorOptions()
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	fields, err := newFieldSet(settings.settableFields)
+	if err != nil {
+		return nil, err
+	}
+	if c := settings.nameCollation; c != nil && (c.Locale == "" || c.Strength < 1 || c.Strength > 5) {
+		return nil, fmt.Errorf("name collation needs a locale and a strength from 1 to 5, got %q and %d", c.Locale, c.Strength)
+	}
+	clientOptions := newClientOptions(uri, numWorkers, settings)
 
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
@@ -51,48 +154,401 @@ func NewBatchProcessor(uri, dbName, collName string, batchSize, numWorkers int)
 
 	collection := client.Database(dbName).Collection(collName)
 
-	// Create index on name field for faster lookups
-	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys: bson.D{{Key: "name", Value: 1}},
-		Options: options.Index().
-			SetUnique(true).
-			SetBackground(true),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create index: %v", err)
+	build := indexBuild{
+		mode:        settings.indexBuildMode,
+		raceRetries: settings.indexRaceRetries,
+		collation:   settings.nameCollation,
+	}
+	if err := ensureIndexes(ctx, collection, build); err != nil {
+		return nil, err
+	}
+
+	audit := client.Database(dbName).Collection(collName + "_audit")
+	if err := ensureAuditIndexes(ctx, audit, settings.nameCollation); err != nil {
+		return nil, err
+	}
+
+	importNames := client.Database(dbName).Collection(collName + "_import_names")
+	if err := ensureImportIndexes(ctx, importNames); err != nil {
+		return nil, err
 	}
 
 	return &BatchProcessor{
-		client:     client,
-		collection: collection,
-		batchSize:  batchSize,
-		workers:    numWorkers,
+		client:               client,
+		collection:           collection,
+		imports:              client.Database(dbName).Collection(collName + "_imports"),
+		importNames:          importNames,
+		importFeed:           newImportFeed(),
+		audit:                audit,
+		batchSize:            batchSize,
+		workers:              numWorkers,
+		fields:               fields,
+		countSeen:            settings.countSeen,
+		cache:                &listCache{ttl: settings.listCacheTTL, compress: settings.compressListCache},
+		indexBuild:           build,
+		tenants:              &tenantCollections{entries: make(map[string]*tenantCollection)},
+		nameCollation:        settings.nameCollation,
+		batchLogLevel:        settings.batchLogLevel,
+		transientRetries:     settings.transientRetries,
+		addressNormalization: settings.addressNormalization,
+		rawAddress:           settings.rawAddress,
 	}, nil
 }
 
 // HealthCheck performs a health check on the MongoDB connection
-func (bp *BatchProcessor) HealthCheck(ctx context.Context) error {
+func (bp *BatchProcessor) HealthCheck(ctx context.Context) (err error) {
+	defer recoverPanic("HealthCheck", &err)
 	return bp.client.Ping(ctx, readpref.Primary())
 }
 
-// ProcessBatch processes and stores a batch of companies
-func (bp *BatchProcessor) ProcessBatch(ctx context.Context, companies []Company) (int, error) {
+// MissingIndexes lists the collection's indexes and returns the names of any
+// expected indexes that are not present
+func (bp *BatchProcessor) MissingIndexes(ctx context.Context) (_ []string, err error) {
+	defer recoverPanic("MissingIndexes", &err)
+	cursor, err := bp.collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var indexes []struct {
+		Name string `bson:"name"`
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, fmt.Errorf("failed to decode indexes: %v", err)
+	}
+
+	present := make(map[string]bool, len(indexes))
+	for _, index := range indexes {
+		present[index.Name] = true
+	}
+
+	var missing []string
+	for _, name := range expectedIndexes {
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// BatchCanceledError is returned when a batch stops early because its
+// context was canceled or timed out between or during chunk writes
+type BatchCanceledError struct {
+	CompletedChunks int
+	TotalChunks     int
+	Err             error
+}
+
+func (e *BatchCanceledError) Error() string {
+	return fmt.Sprintf("batch aborted after %d of %d chunks: %v", e.CompletedChunks, e.TotalChunks, e.Err)
+}
+
+func (e *BatchCanceledError) Unwrap() error {
+	return e.Err
+}
+
+// ProgressFunc receives the number of companies written so far and the
+// total size of the batch after each chunk completes
+type ProgressFunc func(processed, total int)
+
+// BatchOptions controls how ProcessBatch writes a batch
+type BatchOptions struct {
+	// ConflictStrategy resolves name collisions; defaults to ConflictOverwrite
+	ConflictStrategy ConflictStrategy
+	// Progress, if set, is called after each chunk is written
+	Progress ProgressFunc
+	// Timeout bounds the processing of the batch independently of any
+	// deadline already on the context; 0 applies no extra limit
+	Timeout time.Duration
+	// Mode selects upserts (the default) or plain inserts. Insert mode
+	// reports every existing or repeated name as a write error, so
+	// ConflictStrategy does not apply.
+	Mode WriteMode
+	// KeepAddress leaves a stored address in place when the incoming address
+	// is empty, for writers that only mean to update other fields
+	KeepAddress bool
+	// Fields restricts the write to these fields besides the name, within
+	// those the processor allows; empty writes all of them. Fields left out
+	// are not touched on existing companies, such as treated for a pipeline
+	// that only knows addresses, while new companies start untreated.
+	Fields []string
+	// FullSync treats the batch as the complete set of companies: in one
+	// transaction it is written and every stored company missing from it is
+	// deleted. Only ProcessBatch supports it.
+	FullSync bool
+	// SoftDelete makes a full sync mark missing companies deleted, for
+	// PurgeDeleted to remove later, instead of deleting them outright. Reads
+	// no longer return them. Uploading one again under ConflictOverwrite
+	// restores it; ConflictSkip leaves it deleted and in insert mode its name
+	// stays taken.
+	SoftDelete bool
+}
+
+// BatchResult summarizes a processed batch. Processed counts companies that
+// were inserted or modified; re-uploads of identical data are Unchanged, which
+// requires the seen counter to be off as bumping it modifies every company.
+// Deleted counts the companies a full sync removed.
+type BatchResult struct {
+	Processed   int          `json:"processed_count"`
+	Inserted    int          `json:"inserted_count"`
+	Modified    int          `json:"modified_count"`
+	Unchanged   int          `json:"unchanged_count"`
+	Skipped     int          `json:"skipped_count"`
+	Overwritten int          `json:"overwritten_count"`
+	Deleted     int          `json:"deleted_count,omitempty"`
+	Errors      []WriteError `json:"errors,omitempty"`
+	ImportID    string       `json:"import_id,omitempty"`
+	Timing      BatchTiming  `json:"timing"`
+	// Locations lists the URL paths of created companies; the HTTP layer
+	// fills it in when asked to
+	Locations []string `json:"locations,omitempty"`
+
+	// affected holds the names this batch wrote, for the import log
+	affected []string
+	// created holds the names this batch inserted
+	created []string
+}
+
+// Created returns the names of the companies the batch inserted
+func (r BatchResult) Created() []string {
+	return r.created
+}
+
+// BatchTiming breaks down where a batch upload spent its time, in
+// milliseconds. ProcessBatch fills in WriteMS, ChunkCount and its own TotalMS;
+// the HTTP handler adds ValidationMS and widens TotalMS to the whole request.
+type BatchTiming struct {
+	ValidationMS float64 `json:"validation_ms"`
+	WriteMS      float64 `json:"write_ms"`
+	TotalMS      float64 `json:"total_ms"`
+	ChunkCount   int     `json:"chunk_count"`
+}
+
+// Milliseconds converts d to fractional milliseconds for BatchTiming
+func Milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// WriteError describes a company that failed to write while the rest of its
+// batch succeeded. Index refers to the company's position in the input (in
+// the list named by Op, for mixed bulk requests). Code
+// is the MongoDB error code, or 413 for a document rejected before writing for
+// exceeding the 16MB limit.
+type WriteError struct {
+	// Op is set on mixed bulk requests to "upsert" or "delete"
+	Op      string `json:"op,omitempty"`
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// DuplicateKeyCode is MongoDB's error code for a unique index violation, as
+// reported by inserts of an existing name
+const DuplicateKeyCode = 11000
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("company %q: %s", e.Name, e.Message)
+}
+
+// ProcessBatch stores a batch of companies in chunks of batchSize and records
+// the import in the import log
+func (bp *BatchProcessor) ProcessBatch(ctx context.Context, companies []Company, opts BatchOptions) (_ BatchResult, err error) {
+	defer recoverPanic("ProcessBatch", &err)
+	start := time.Now()
+	defer bp.cache.invalidate()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	write := bp.write
+	if opts.FullSync {
+		write = bp.syncAll
+	}
+	result, err := write(ctx, companies, opts)
+	if err != nil {
+		return result, err
+	}
+
+	// The companies are already written, so a logging failure is not fatal
+	importID, err := bp.recordImport(ctx, result)
+	if err != nil {
+		slog.Error("Failed to record import", "error", err)
+	}
+	result.ImportID = importID
+	result.Timing.TotalMS = Milliseconds(time.Since(start))
+
+	return result, nil
+}
+
+// write is the path shared by ProcessBatch and UpsertCompany: it writes
+// companies to the request's collection under opts
+func (bp *BatchProcessor) write(ctx context.Context, companies []Company, opts BatchOptions) (BatchResult, error) {
+	coll, err := bp.writeCollection(ctx)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	return bp.processInto(ctx, coll, companies, opts)
+}
+
+// processInto upserts companies into collection in chunks of batchSize
+func (bp *BatchProcessor) processInto(ctx context.Context, collection *mongo.Collection, companies []Company, opts BatchOptions) (BatchResult, error) {
+	var result BatchResult
 	if len(companies) == 0 {
-		return 0, nil
+		return result, nil
+	}
+	defer bp.work.startBatch()()
+
+	strategy := opts.ConflictStrategy
+	if strategy == "" {
+		strategy = ConflictOverwrite
+	}
+
+	var inputIndexes []int
+	if opts.Mode == ModeInsert {
+		// Inserts report repeated names as duplicate key errors instead
+		inputIndexes = make([]int, len(companies))
+		for i := range inputIndexes {
+			inputIndexes[i] = i
+		}
+	} else {
+		var dropped int
+		var err error
+		companies, inputIndexes, dropped, err = resolveBatchConflicts(companies, strategy, bp.nameCollation)
+		if err != nil {
+			return result, err
+		}
+		if strategy == ConflictSkip {
+			result.Skipped += dropped
+		} else {
+			result.Overwritten += dropped
+		}
+
+		if strategy == ConflictError {
+			if err := checkExistingConflicts(ctx, collection, companies, bp.nameCollation); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	settings := bp.writeSettings(strategy, opts.Mode)
+	settings.keepAddress = opts.KeepAddress
+	settings.fields = settings.fields.restrict(opts.Fields)
+
+	chunkSize := bp.batchSize
+	totalChunks := (len(companies) + chunkSize - 1) / chunkSize
+	completedChunks := 0
+	canceled := func(err error) error {
+		return &BatchCanceledError{
+			CompletedChunks: completedChunks,
+			TotalChunks:     totalChunks,
+			Err:             err,
+		}
+	}
+
+	for start := 0; start < len(companies); start += chunkSize {
+		// Stop dispatching chunks as soon as the caller gives up
+		if err := ctx.Err(); err != nil {
+			return result, canceled(err)
+		}
+
+		end := min(start+chunkSize, len(companies))
+
+		writeStart := time.Now()
+		done := bp.work.startChunk()
+		chunk, err := writeChunk(ctx, collection, companies[start:end], settings)
+		done()
+		result.Timing.WriteMS += Milliseconds(time.Since(writeStart))
+		result.Timing.ChunkCount++
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return result, canceled(ctxErr)
+			}
+			return result, err
+		}
+		bp.logChunk(ctx, chunk)
+		failed := make(map[int]bool, len(chunk.errors))
+		for _, writeError := range chunk.errors {
+			failed[writeError.Index] = true
+			// Map the position within the chunk back to the caller's input
+			writeError.Index = inputIndexes[start+writeError.Index]
+			result.Errors = append(result.Errors, writeError)
+		}
+		for i, company := range companies[start:end] {
+			// Skipped companies that already existed were left untouched
+			if !failed[i] && (strategy != ConflictSkip || chunk.inserted[i]) {
+				result.affected = append(result.affected, company.Name)
+			}
+			if !failed[i] && chunk.inserted[i] {
+				result.created = append(result.created, company.Name)
+			}
+		}
+		result.Processed += chunk.modified + chunk.upserted
+		result.Inserted += chunk.upserted
+		result.Modified += chunk.modified
+		// Matched documents already existed: skip left them alone,
+		// overwrite and error (which found none up front) replaced them
+		if strategy == ConflictSkip {
+			result.Skipped += chunk.matched
+		} else {
+			result.Overwritten += chunk.matched
+			result.Unchanged += chunk.matched - chunk.modified
+		}
+		completedChunks++
+
+		if opts.Progress != nil {
+			opts.Progress(end, len(companies))
+		}
 	}
 
+	return result, nil
+}
+
+// maxDocumentSize is MongoDB's limit on the size of a single BSON document
+const maxDocumentSize = 16 * 1024 * 1024
+
+// chunkResult summarizes one chunk's BulkWrite. Positions in inserted and
+// errors refer to the company's index within the chunk.
+type chunkResult struct {
+	matched  int
+	modified int
+	upserted int
+	inserted map[int]bool
+	errors   []WriteError
+}
+
+// writeChunk upserts a single chunk of companies with one unordered BulkWrite.
+// Individual write failures, including documents over MongoDB's size limit,
+// are reported per company; only failures affecting the whole chunk are
+// returned as err.
+func writeChunk(ctx context.Context, collection *mongo.Collection, companies []Company, settings writeSettings) (*chunkResult, error) {
+	chunk := &chunkResult{inserted: make(map[int]bool)}
 	var operations []mongo.WriteModel
-	for _, company := range companies {
-		operation := mongo.NewUpdateOneModel().
-			SetFilter(bson.M{"name": company.Name}).
-			SetUpdate(bson.M{"$set": bson.M{
-				"name":    company.Name,
-				"address": company.Address,
-				"treated": company.Treated,
-			}}).
-			SetUpsert(true)
-		
+	// positions maps each operation back to its company's index in the chunk
+	var positions []int
+	for i, company := range companies {
+		var operation mongo.WriteModel
+		var writeError *WriteError
+		if settings.mode == ModeInsert {
+			operation, writeError = insertModel(company, settings)
+		} else {
+			operation, writeError = upsertModel(company, settings)
+		}
+		if writeError != nil {
+			writeError.Index = i
+			chunk.errors = append(chunk.errors, *writeError)
+			continue
+		}
+
 		operations = append(operations, operation)
+		positions = append(positions, i)
+	}
+
+	if len(operations) == 0 {
+		return chunk, nil
 	}
 
 	// Configure bulk write options
@@ -100,60 +556,448 @@ func (bp *BatchProcessor) ProcessBatch(ctx context.Context, companies []Company)
 		SetOrdered(false)
 
 	// Execute bulk write
-	result, err := bp.collection.BulkWrite(ctx, operations, opts)
+	var result *mongo.BulkWriteResult
+	err := retryTransient(ctx, settings.retries, "BulkWrite", settings.retryable(), func() error {
+		var err error
+		result, err = collection.BulkWrite(ctx, operations, opts)
+		return err
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to process batch: %v", err)
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+			return nil, databaseError("failed to process batch", err)
+		}
+		for _, we := range bulkErr.WriteErrors {
+			position := positions[we.Index]
+			chunk.errors = append(chunk.errors, WriteError{
+				Index:   position,
+				Name:    companies[position].Name,
+				Code:    we.Code,
+				Message: we.Message,
+			})
+		}
+	}
+
+	chunk.matched = int(result.MatchedCount)
+	chunk.modified = int(result.ModifiedCount)
+	// Inserts count as upserts that created their document
+	chunk.upserted = int(result.UpsertedCount + result.InsertedCount)
+	for index := range result.UpsertedIDs {
+		chunk.inserted[positions[index]] = true
+	}
+	if settings.mode == ModeInsert {
+		failed := make(map[int]bool, len(chunk.errors))
+		for _, writeError := range chunk.errors {
+			failed[writeError.Index] = true
+		}
+		for _, position := range positions {
+			chunk.inserted[position] = !failed[position]
+		}
+	}
+
+	return chunk, nil
+}
+
+// logChunk logs the outcome of a written chunk at the configured batch log
+// level, so per-chunk lines can be kept out of production logs
+func (bp *BatchProcessor) logChunk(ctx context.Context, chunk *chunkResult) {
+	slog.Log(ctx, bp.batchLogLevel, "Processed companies",
+		"count", chunk.modified+chunk.upserted,
+		"modified", chunk.modified,
+		"upserted", chunk.upserted,
+		"failed", len(chunk.errors))
+}
+
+// writeSettings controls how a company is turned into a write
+type writeSettings struct {
+	strategy ConflictStrategy
+	mode     WriteMode
+	// fields are written besides the name
+	fields fieldSet
+	// countSeen bumps the company's seen counter on every upsert
+	countSeen bool
+	// collation, if set, is applied to the upsert's name filter
+	collation *options.Collation
+	// keepAddress omits an empty address from the write
+	keepAddress bool
+	// retries is how often a chunk failing with a transient error is retried
+	retries int
+	// addressNormalization cleans up addresses; rawAddress also stores them
+	// as received
+	addressNormalization AddressNormalization
+	rawAddress           bool
+}
+
+// writeSettings returns the processor's write settings for strategy and mode
+func (bp *BatchProcessor) writeSettings(strategy ConflictStrategy, mode WriteMode) writeSettings {
+	return writeSettings{
+		strategy:             strategy,
+		mode:                 mode,
+		fields:               bp.fields,
+		countSeen:            bp.countSeen,
+		collation:            bp.nameCollation,
+		retries:              bp.transientRetries,
+		addressNormalization: bp.addressNormalization,
+		rawAddress:           bp.rawAddress,
+	}
+}
+
+// upsertModel builds the upsert for one company, writing the name and the
+// configured fields. Under ConflictSkip the fields are only written when the
+// upsert inserts, though the seen counter is still bumped. Documents that
+// cannot be stored are rejected up front with a WriteError: the driver would
+// otherwise fail the whole BulkWrite without saying which company was at
+// fault.
+func upsertModel(company Company, settings writeSettings) (mongo.WriteModel, *WriteError) {
+	// Only fields in the allowlist are written; the rest of the input is
+	// ignored so clients cannot assign fields they do not own
+	set := bson.M{"name": company.Name}
+	if settings.fields["address"] {
+		setAddress(set, company, settings)
+	}
+	if settings.fields["treated"] {
+		set["treated"] = company.Treated
+	}
+	// A writer that names no source leaves the previous one in place
+	if settings.fields["source"] && company.Source != "" {
+		set["source"] = company.Source
+	}
+	if settings.fields["metadata"] {
+		// Merge metadata per key rather than replacing the whole map
+		for key, value := range company.Metadata {
+			set["metadata."+key] = value
+		}
+	}
+
+	var update interface{}
+	if settings.strategy == ConflictSkip {
+		now := time.Now().UTC()
+		set["createdAt"] = now
+		set["updatedAt"] = now
+		if treated, ok := set["treated"].(bool); !ok {
+			set["treated"] = false
+		} else if treated {
+			set["treatedAt"] = now
+		}
+		skip := bson.M{"$setOnInsert": set}
+		if settings.countSeen {
+			skip["$inc"] = bson.M{"seen": 1}
+		}
+		update = skip
+	} else {
+		// Uploading a soft-deleted company restores it
+		pipeline := timestampedUpdate(set, softDeleted...)
+		if !settings.fields["treated"] {
+			// Leave treated alone, but give new companies an explicit false
+			pipeline = append(pipeline, bson.D{{Key: "$set", Value: bson.M{
+				"treated": bson.M{"$ifNull": bson.A{"$treated", false}},
+			}}})
+		}
+		if settings.countSeen {
+			pipeline = append(pipeline, bson.D{{Key: "$set", Value: bson.M{
+				"seen": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$seen", 0}}, 1}},
+			}}})
+		}
+		update = pipeline
 	}
 
-	totalModified := int(result.ModifiedCount + result.UpsertedCount)
-	log.Printf("Processed %d companies (Modified: %d, Upserted: %d)",
-		totalModified, result.ModifiedCount, result.UpsertedCount)
+	if writeError := checkDocumentSize(update); writeError != nil {
+		writeError.Name = company.Name
+		return nil, writeError
+	}
 
-	return totalModified, nil
+	model := mongo.NewUpdateOneModel().
+		SetFilter(bson.M{"name": company.Name}).
+		SetUpdate(update).
+		SetUpsert(true)
+	if settings.collation != nil {
+		model.SetCollation(settings.collation)
+	}
+	return model, nil
 }
 
-// UpdateTreatedField updates the 'treated' field of a company by name
+// timestampedUpdate builds an update pipeline that applies set, removes the
+// unset paths and maintains createdAt and updatedAt. updatedAt only changes
+// when one of the set fields differs from the stored value or an unset field
+// is present, so identical re-uploads remain no-ops and are reported as
+// unchanged. When set includes treated, treatedAt records when the company
+// became treated; it is removed when the company is untreated or treated is
+// unset.
+func timestampedUpdate(set bson.M, unset ...string) mongo.Pipeline {
+	unchanged := bson.A{}
+	values := bson.M{}
+	for field, value := range set {
+		// $literal keeps string values starting with '$' from being read as
+		// field paths
+		literal := bson.M{"$literal": value}
+		unchanged = append(unchanged, bson.M{"$eq": bson.A{"$" + field, literal}})
+		values[field] = literal
+	}
+	for _, field := range unset {
+		unchanged = append(unchanged, bson.M{"$eq": bson.A{bson.M{"$type": "$" + field}, "missing"}})
+	}
+
+	timestamps := bson.M{
+		"updatedAt": bson.M{"$cond": bson.M{
+			"if":   bson.M{"$and": unchanged},
+			"then": "$updatedAt",
+			"else": "$$NOW",
+		}},
+		"createdAt": bson.M{"$ifNull": bson.A{"$createdAt", "$$NOW"}},
+	}
+	if treated, ok := set["treated"].(bool); ok {
+		if treated {
+			timestamps["treatedAt"] = bson.M{"$cond": bson.M{
+				"if":   bson.M{"$eq": bson.A{"$treated", true}},
+				"then": "$treatedAt",
+				"else": "$$NOW",
+			}}
+		} else {
+			timestamps["treatedAt"] = "$$REMOVE"
+		}
+	}
+	for _, field := range unset {
+		if field == "treated" {
+			timestamps["treatedAt"] = "$$REMOVE"
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: timestamps}},
+	}
+	if len(values) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: values}})
+	}
+	if len(unset) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$unset", Value: unset}})
+	}
+	return pipeline
+}
+
+// checkDocumentSize returns a WriteError if doc cannot be encoded or exceeds
+// MongoDB's document size limit. doc may be an update pipeline, which is an
+// array and so is measured as a field of a document, as the update command
+// sends it.
+func checkDocumentSize(doc interface{}) *WriteError {
+	data, err := bson.Marshal(bson.D{{Key: "u", Value: doc}})
+	if err != nil {
+		return &WriteError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("document cannot be encoded: %v", err),
+		}
+	}
+	if len(data) > maxDocumentSize {
+		return &WriteError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("document is %d bytes, over the %d byte limit", len(data), maxDocumentSize),
+		}
+	}
+	return nil
+}
+
+// ErrCompanyNotFound is returned when no company has the given name
+var ErrCompanyNotFound = errors.New("company not found")
+
+// ErrCompanyExists is returned when a company name is already taken
+var ErrCompanyExists = errors.New("company already exists")
+
+// UpdateTreatedField marks a company as treated by name. It only fails if the
+// company does not exist; a company that is already treated is left as is and
+// reported as success.
 func (bp *BatchProcessor) UpdateTreatedField(ctx context.Context, companyName string) error {
-	filter := bson.M{"name": companyName}
-	update := bson.M{"$set": bson.M{"treated": true}}
+	return bp.SetTreated(ctx, companyName, true)
+}
 
-	result, err := bp.collection.UpdateOne(ctx, filter, update)
+// SetTreated sets the 'treated' field of a company by name. Setting the value
+// the company already has is a successful no-op, so retries are idempotent.
+func (bp *BatchProcessor) SetTreated(ctx context.Context, companyName string, treated bool) (err error) {
+	defer recoverPanic("SetTreated", &err)
+	defer bp.cache.invalidate()
+	filter := live(bson.M{"name": companyName})
+	update := timestampedUpdate(bson.M{"treated": treated})
+
+	coll, err := bp.writeCollection(ctx)
+	if err != nil {
+		return err
+	}
+	// The previous state tells whether anything changed, and the stored name
+	// to record in the audit trail
+	var before bson.M
+	err = coll.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().
+			SetProjection(bson.M{"name": 1, "treated": 1}).
+			SetCollation(bp.nameCollation),
+	).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w: %s", ErrCompanyNotFound, companyName)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update treated field: %v", err)
 	}
 
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("company not found: %s", companyName)
+	// Already in the requested state: succeed so that client retries are idempotent
+	if before["treated"] == treated {
+		slog.Debug("Company treated field already set", "name", companyName, "treated", treated)
+		return nil
 	}
 
-	if result.ModifiedCount == 0 {
-		return fmt.Errorf("company found but no update performed: %s", companyName)
+	action := "treated"
+	if !treated {
+		action = "untreated"
 	}
+	name, _ := before["name"].(string)
+	bp.recordAudit(ctx, name, action)
 
-	log.Printf("Updated treated field for company: %s", companyName)
+	slog.Info("Updated treated field for company", "name", companyName, "treated", treated)
 	return nil
 }
 
-// FetchAllCompanies retrieves all companies from the database
-func (bp *BatchProcessor) FetchAllCompanies(ctx context.Context) ([]Company, error) {
-	opts := options.Find().
-		SetSort(bson.D{{Key: "name", Value: 1}})
+// CompanyExists reports whether a company with the given name is stored,
+// without fetching the document
+func (bp *BatchProcessor) CompanyExists(ctx context.Context, name string) (_ bool, err error) {
+	defer recoverPanic("CompanyExists", &err)
+	count, err := bp.readCollection(ctx).CountDocuments(ctx, live(bson.M{"name": name}),
+		options.Count().SetLimit(1).SetCollation(bp.nameCollation))
+	if err != nil {
+		return false, fmt.Errorf("failed to check company: %v", err)
+	}
+	return count > 0, nil
+}
+
+// UpsertCompany writes a single company through the same path as batch
+// uploads, so opts' conflict strategy and write mode behave exactly as they
+// do for a batch of one. Whether the company was created, updated or skipped
+// is reported in the result; a company that cannot be written is returned as
+// a *WriteError. Unlike ProcessBatch it is not recorded in the import log.
+//
+// The write is a single atomic upsert, so concurrent calls for the same new
+// name resolve to one insert and one update. The server can still fail the
+// losing upsert with a duplicate key error when both try to insert; that
+// write is retried once, when it finds the company and updates it. In insert
+// mode a duplicate key is the expected outcome and is not retried.
+func (bp *BatchProcessor) UpsertCompany(ctx context.Context, company Company, opts BatchOptions) (_ BatchResult, err error) {
+	defer recoverPanic("UpsertCompany", &err)
+	defer bp.cache.invalidate()
 
-	cursor, err := bp.collection.Find(ctx, bson.M{}, opts)
+	result, err := bp.write(ctx, []Company{company}, opts)
+	if err == nil && opts.Mode != ModeInsert && len(result.Errors) > 0 && result.Errors[0].Code == DuplicateKeyCode {
+		slog.Info("Retrying upsert that raced a concurrent insert", "name", company.Name)
+		result, err = bp.write(ctx, []Company{company}, opts)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch companies: %v", err)
+		return result, err
 	}
-	defer cursor.Close(ctx)
+	if len(result.Errors) > 0 {
+		return result, &result.Errors[0]
+	}
+	return result, nil
+}
 
-	var companies []Company
-	if err = cursor.All(ctx, &companies); err != nil {
-		return nil, fmt.Errorf("failed to decode companies: %v", err)
+// GetCompany retrieves a company by name
+func (bp *BatchProcessor) GetCompany(ctx context.Context, name string) (_ *Company, err error) {
+	defer recoverPanic("GetCompany", &err)
+
+	var company Company
+	err = retryTransient(ctx, bp.transientRetries, "GetCompany", isTransient, func() error {
+		opts := options.FindOne().SetCollation(bp.nameCollation)
+		return bp.readCollection(ctx).FindOne(ctx, live(bson.M{"name": name}), opts).Decode(&company)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrCompanyNotFound, name)
+	}
+	if err != nil {
+		return nil, databaseError("failed to fetch company", err)
+	}
+	return &company, nil
+}
+
+// RenameCompany changes a company's name. The unique index on name is the
+// final arbiter, so a rename racing with another write still fails cleanly
+// with ErrCompanyExists.
+func (bp *BatchProcessor) RenameCompany(ctx context.Context, oldName, newName string) (err error) {
+	defer recoverPanic("RenameCompany", &err)
+	defer bp.cache.invalidate()
+	if oldName == newName {
+		return nil
 	}
 
+	taken, err := bp.CompanyExists(ctx, newName)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("%w: %s", ErrCompanyExists, newName)
+	}
+
+	coll, err := bp.writeCollection(ctx)
+	if err != nil {
+		return err
+	}
+	var before struct {
+		Name string `bson:"name"`
+	}
+	err = coll.FindOneAndUpdate(ctx,
+		live(bson.M{"name": oldName}),
+		bson.M{
+			"$set":         bson.M{"name": newName},
+			"$currentDate": bson.M{"updatedAt": true},
+		},
+		options.FindOneAndUpdate().
+			SetProjection(bson.M{"name": 1}).
+			SetCollation(bp.nameCollation),
+	).Decode(&before)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrCompanyExists, newName)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w: %s", ErrCompanyNotFound, oldName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rename company: %v", err)
+	}
+	bp.renameAudit(ctx, before.Name, newName)
+
+	slog.Info("Renamed company", "from", oldName, "to", newName)
+	return nil
+}
+
+// FetchAllCompanies retrieves all companies from the database. Results are
+// served from the list cache, and concurrent calls share one query; requests
+// with their own read concern or preference always query directly. The
+// returned slice must not be modified.
+func (bp *BatchProcessor) FetchAllCompanies(ctx context.Context) ([]Company, error) {
+	// The cache holds the default collection as read by default
+	if readOptionsFrom(ctx) != (readOptions{}) || tenantFrom(ctx) != "" {
+		return bp.findAllCompanies(ctx)
+	}
+	return bp.cache.get(ctx, bp.findAllCompanies)
+}
+
+// findAllCompanies queries every company in name order
+func (bp *BatchProcessor) findAllCompanies(ctx context.Context) (_ []Company, err error) {
+	defer recoverPanic("findAllCompanies", &err)
+	opts := findOptions(ctx).
+		SetSort(bson.D{{Key: "name", Value: 1}}).
+		SetCollation(bp.nameCollation)
+
+	var companies []Company
+	err = retryTransient(ctx, bp.transientRetries, "findAllCompanies", isTransient, func() error {
+		cursor, err := bp.readCollection(ctx).Find(ctx, live(bson.M{}), opts)
+		if err != nil {
+			return databaseError("failed to fetch companies", err)
+		}
+		defer cursor.Close(ctx)
+		companies, err = decodeCompanies(ctx, cursor, "findAllCompanies")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 	return companies, nil
 }
 
 // Close closes the MongoDB connection
-func (bp *BatchProcessor) Close(ctx context.Context) error {
+func (bp *BatchProcessor) Close(ctx context.Context) (err error) {
+	defer recoverPanic("Close", &err)
 	return bp.client.Disconnect(ctx)
 }
\ No newline at end of file
@@ -0,0 +1,687 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestProcessBatchSeenCounter(t *testing.T) {
+	bp := newTestProcessor(t, WithSeenCounter(true))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St"})
+	}
+	company, err := bp.GetCompany(ctx, "Acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if company.Seen != 3 {
+		t.Errorf("Seen = %d, want 3", company.Seen)
+	}
+}
+
+func TestProcessBatchUnchangedWithoutSeenCounter(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	batch := []Company{{Name: "Acme", Address: "1 Main St"}, {Name: "Globex"}}
+	seedCompanies(t, bp, batch...)
+
+	result, err := bp.ProcessBatch(ctx, batch, BatchOptions{})
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	if result.Unchanged != 2 || result.Modified != 0 || result.Inserted != 0 {
+		t.Errorf("got unchanged %d, modified %d, inserted %d; want 2, 0, 0",
+			result.Unchanged, result.Modified, result.Inserted)
+	}
+	company, err := bp.GetCompany(ctx, "Acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if company.Seen != 0 {
+		t.Errorf("Seen = %d, want 0 with the counter off", company.Seen)
+	}
+}
+
+func TestCheckDocumentSize(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  interface{}
+		want int
+	}{
+		{"document", bson.M{"$set": bson.M{"name": "Acme"}}, 0},
+		{"pipeline", timestampedUpdate(bson.M{"name": "Acme", "treated": true}), 0},
+		{"oversized pipeline", timestampedUpdate(bson.M{"name": strings.Repeat("x", maxDocumentSize)}), http.StatusRequestEntityTooLarge},
+		{"unencodable", bson.M{"$set": bson.M{"name": make(chan int)}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := 0
+			if writeError := checkDocumentSize(tt.doc); writeError != nil {
+				got = writeError.Code
+			}
+			if got != tt.want {
+				t.Errorf("checkDocumentSize code = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpsertModelCollation(t *testing.T) {
+	collation := &options.Collation{Locale: "en", Strength: 2}
+	tests := []struct {
+		name      string
+		collation *options.Collation
+	}{
+		{"with collation", collation},
+		{"without collation", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := writeSettings{
+				strategy:  ConflictOverwrite,
+				mode:      ModeUpsert,
+				fields:    fieldSet{"address": true, "treated": true},
+				collation: tt.collation,
+			}
+			model, writeError := upsertModel(Company{Name: "Acme"}, settings)
+			if writeError != nil {
+				t.Fatalf("upsertModel failed: %v", writeError)
+			}
+			update, ok := model.(*mongo.UpdateOneModel)
+			if !ok {
+				t.Fatalf("upsertModel returned %T, want *mongo.UpdateOneModel", model)
+			}
+			if update.Collation != tt.collation {
+				t.Errorf("collation = %+v, want %+v", update.Collation, tt.collation)
+			}
+		})
+	}
+}
+
+func TestNameCollationLookups(t *testing.T) {
+	bp := newTestProcessor(t, WithNameCollation("en", 2))
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St"})
+
+	result, err := bp.ProcessBatch(ctx, []Company{{Name: "ACME", Address: "2 Main St"}}, BatchOptions{})
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	if result.Inserted != 0 || result.Modified != 1 {
+		t.Errorf("got inserted %d, modified %d; want the upload to update Acme", result.Inserted, result.Modified)
+	}
+
+	company, err := bp.GetCompany(ctx, "acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if company.Address != "2 Main St" {
+		t.Errorf("address = %q, want \"2 Main St\"", company.Address)
+	}
+	if exists, err := bp.CompanyExists(ctx, "aCmE"); err != nil || !exists {
+		t.Errorf("CompanyExists = %v, %v; want true", exists, err)
+	}
+	if err := bp.SetTreated(ctx, "ACME", true); err != nil {
+		t.Errorf("SetTreated failed: %v", err)
+	}
+	if err := bp.RenameCompany(ctx, "acme", "Acme Corp"); err != nil {
+		t.Errorf("RenameCompany failed: %v", err)
+	}
+	if _, err := bp.GetCompany(ctx, "ACME CORP"); err != nil {
+		t.Errorf("GetCompany after rename failed: %v", err)
+	}
+}
+
+func TestProcessBatchAddressOnlyKeepsTreated(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St", Treated: true})
+
+	opts := BatchOptions{Fields: []string{"name", "address"}}
+	batch := []Company{{Name: "Acme", Address: "2 Main St"}, {Name: "Globex", Address: "3 Main St", Treated: true}}
+	if _, err := bp.ProcessBatch(ctx, batch, opts); err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+
+	acme, err := bp.GetCompany(ctx, "Acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if acme.Address != "2 Main St" || !acme.Treated {
+		t.Errorf("Acme = %+v, want the new address and still treated", acme)
+	}
+	globex, err := bp.GetCompany(ctx, "Globex")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if globex.Treated {
+		t.Error("a new company written without treated should start untreated")
+	}
+}
+
+func TestProcessBatchProgress(t *testing.T) {
+	bp := newTestProcessor(t)
+	companies := make([]Company, 250)
+	for i := range companies {
+		companies[i] = Company{Name: fmt.Sprintf("Company %d", i)}
+	}
+
+	var processed []int
+	opts := BatchOptions{Progress: func(done, total int) {
+		if total != len(companies) {
+			t.Errorf("progress total = %d, want %d", total, len(companies))
+		}
+		processed = append(processed, done)
+	}}
+	if _, err := bp.ProcessBatch(context.Background(), companies, opts); err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	// One call per chunk of the processor's batch size of 100
+	want := []int{100, 200, 250}
+	if fmt.Sprint(processed) != fmt.Sprint(want) {
+		t.Errorf("progress = %v, want %v", processed, want)
+	}
+}
+
+func TestCompanyValidateMetadataKeys(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"industry", true},
+		{"phone_number", true},
+		{"", false},
+		{"address.city", false},
+		{"$where", false},
+	}
+	for _, tt := range tests {
+		company := Company{Name: "Acme", Metadata: map[string]interface{}{tt.key: "x"}}
+		if err := company.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate with metadata key %q: error = %v, want valid %v", tt.key, err, tt.valid)
+		}
+	}
+}
+
+func TestProcessBatchMergesMetadata(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme", Metadata: map[string]interface{}{
+		"industry": "anvils",
+		"phone":    "555-0100",
+	}})
+	seedCompanies(t, bp, Company{Name: "Acme", Metadata: map[string]interface{}{
+		"phone": "555-0199",
+	}})
+
+	company, err := bp.GetCompany(ctx, "Acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if company.Metadata["industry"] != "anvils" || company.Metadata["phone"] != "555-0199" {
+		t.Errorf("metadata = %v, want industry kept and phone replaced", company.Metadata)
+	}
+}
+
+func TestCompanyUnmarshalJSONNumbers(t *testing.T) {
+	var company Company
+	if err := json.Unmarshal([]byte(`{"name":"Acme","treated":true,"metadata":{"id":9007199254740993,"ratio":0.5}}`), &company); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if company.Name != "Acme" || !company.Treated {
+		t.Errorf("company = %+v, want the plain fields decoded", company)
+	}
+	if id := company.Metadata["id"]; id != json.Number("9007199254740993") {
+		t.Errorf("metadata id = %#v, want the exact json.Number", id)
+	}
+
+	bp := newTestProcessor(t)
+	seedCompanies(t, bp, company)
+	stored, err := bp.GetCompany(context.Background(), "Acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if id := stored.Metadata["id"]; id != int64(9007199254740993) {
+		t.Errorf("stored metadata id = %#v, want int64 9007199254740993", id)
+	}
+}
+
+func TestUpdateTreatedFieldIdempotent(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"})
+
+	for i := 0; i < 2; i++ {
+		if err := bp.UpdateTreatedField(ctx, "Acme"); err != nil {
+			t.Fatalf("UpdateTreatedField call %d failed: %v", i+1, err)
+		}
+	}
+	company, err := bp.GetCompany(ctx, "Acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if !company.Treated {
+		t.Error("Acme should be treated")
+	}
+
+	if err := bp.UpdateTreatedField(ctx, "Globex"); !errors.Is(err, ErrCompanyNotFound) {
+		t.Errorf("UpdateTreatedField on a missing company = %v, want ErrCompanyNotFound", err)
+	}
+}
+
+func TestProcessBatchCanceledBetweenChunks(t *testing.T) {
+	bp := newTestProcessor(t)
+	companies := make([]Company, 250)
+	for i := range companies {
+		companies[i] = Company{Name: fmt.Sprintf("Company %d", i)}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Give up once the first chunk of 100 is written
+	opts := BatchOptions{Progress: func(processed, total int) { cancel() }}
+	result, err := bp.ProcessBatch(ctx, companies, opts)
+
+	var canceled *BatchCanceledError
+	if !errors.As(err, &canceled) {
+		t.Fatalf("ProcessBatch error = %v, want a BatchCanceledError", err)
+	}
+	if canceled.CompletedChunks != 1 || canceled.TotalChunks != 3 {
+		t.Errorf("completed %d of %d chunks, want 1 of 3", canceled.CompletedChunks, canceled.TotalChunks)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v should wrap context.Canceled", err)
+	}
+	if result.Processed != 100 {
+		t.Errorf("Processed = %d, want 100", result.Processed)
+	}
+}
+
+func TestProcessBatchReportsWriteErrors(t *testing.T) {
+	bp := newTestProcessor(t)
+	seedCompanies(t, bp, Company{Name: "Acme"})
+
+	batch := []Company{{Name: "Globex"}, {Name: "Acme"}, {Name: "Initech"}}
+	result, err := bp.ProcessBatch(context.Background(), batch, BatchOptions{Mode: ModeInsert})
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	if result.Processed != 2 {
+		t.Errorf("Processed = %d, want 2", result.Processed)
+	}
+	if len(result.Errors) != 1 {
+		t.Fatalf("got %d write errors, want 1: %+v", len(result.Errors), result.Errors)
+	}
+	got := result.Errors[0]
+	if got.Index != 1 || got.Name != "Acme" || got.Code != DuplicateKeyCode {
+		t.Errorf("write error = %+v, want index 1, Acme, code %d", got, DuplicateKeyCode)
+	}
+}
+
+func TestProcessBatchTallies(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St"}, Company{Name: "Globex", Address: "2 Main St"})
+
+	batch := []Company{
+		{Name: "Acme", Address: "1 Main St"},
+		{Name: "Globex", Address: "3 Main St"},
+		{Name: "Initech", Address: "4 Main St"},
+	}
+	result, err := bp.ProcessBatch(ctx, batch, BatchOptions{})
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	if result.Inserted != 1 || result.Modified != 1 || result.Unchanged != 1 || result.Processed != 2 {
+		t.Errorf("got inserted %d, modified %d, unchanged %d, processed %d; want 1, 1, 1, 2",
+			result.Inserted, result.Modified, result.Unchanged, result.Processed)
+	}
+
+	entry, err := bp.GetImport(ctx, result.ImportID)
+	if err != nil {
+		t.Fatalf("GetImport failed: %v", err)
+	}
+	if entry.Inserted != 1 || entry.Modified != 1 || entry.Unchanged != 1 {
+		t.Errorf("import log = %+v, want the same tallies", entry)
+	}
+}
+
+func TestProcessBatchTimeout(t *testing.T) {
+	bp := newTestProcessor(t)
+	_, err := bp.ProcessBatch(context.Background(), []Company{{Name: "Acme"}}, BatchOptions{Timeout: time.Nanosecond})
+	var canceled *BatchCanceledError
+	if !errors.As(err, &canceled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ProcessBatch error = %v, want a BatchCanceledError for the deadline", err)
+	}
+}
+
+func TestProcessBatchRejectsOversizedCompany(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+
+	batch := []Company{{Name: "Acme"}, oversizedCompany("Globex"), {Name: "Initech"}}
+	result, err := bp.ProcessBatch(ctx, batch, BatchOptions{})
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	if len(result.Errors) != 1 {
+		t.Fatalf("got %d write errors, want 1: %+v", len(result.Errors), result.Errors)
+	}
+	got := result.Errors[0]
+	if got.Index != 1 || got.Name != "Globex" || got.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("write error = %+v, want index 1, Globex, code 413", got)
+	}
+	if result.Inserted != 2 {
+		t.Errorf("Inserted = %d, want the other 2 companies written", result.Inserted)
+	}
+	if exists, err := bp.CompanyExists(ctx, "Globex"); err != nil || exists {
+		t.Errorf("Globex exists = %v (%v), want false", exists, err)
+	}
+}
+
+func TestRenameCompany(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St"}, Company{Name: "Globex"})
+
+	tests := []struct {
+		from, to string
+		want     error
+	}{
+		{"Acme", "Acme Corp", nil},
+		{"Acme", "Acme Inc", ErrCompanyNotFound},
+		{"Acme Corp", "Globex", ErrCompanyExists},
+		{"Globex", "Globex", nil},
+	}
+	for _, tt := range tests {
+		if err := bp.RenameCompany(ctx, tt.from, tt.to); !errors.Is(err, tt.want) {
+			t.Errorf("RenameCompany(%q, %q) = %v, want %v", tt.from, tt.to, err, tt.want)
+		}
+	}
+
+	company, err := bp.GetCompany(ctx, "Acme Corp")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if company.Address != "1 Main St" {
+		t.Errorf("address = %q after rename, want it kept", company.Address)
+	}
+}
+
+func TestCompanyExists(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"})
+
+	for name, want := range map[string]bool{"Acme": true, "Globex": false} {
+		got, err := bp.CompanyExists(ctx, name)
+		if err != nil {
+			t.Fatalf("CompanyExists(%q) failed: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("CompanyExists(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestNewBatchProcessorRejectsBadSizes(t *testing.T) {
+	tests := []struct {
+		batchSize, workers int
+		want               string
+	}{
+		{0, 2, "batch size"},
+		{-1, 2, "batch size"},
+		{100, 0, "workers"},
+	}
+	for _, tt := range tests {
+		_, err := NewBatchProcessor("mongodb://localhost:27017", "db", "companies", tt.batchSize, tt.workers)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("NewBatchProcessor(%d, %d) error = %v, want %s rejected", tt.batchSize, tt.workers, err, tt.want)
+		}
+	}
+}
+
+func TestNewBatchProcessorRejectsUnsettableField(t *testing.T) {
+	_, err := NewBatchProcessor("mongodb://localhost:27017", "db", "companies", 100, 2, WithSettableFields("address", "createdAt"))
+	if err == nil || !strings.Contains(err.Error(), "createdAt") {
+		t.Errorf("NewBatchProcessor error = %v, want createdAt rejected", err)
+	}
+}
+
+func TestProcessBatchSettableFields(t *testing.T) {
+	bp := newTestProcessor(t, WithSettableFields("address"))
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{
+		Name:     "Acme",
+		Address:  "1 Main St",
+		Treated:  true,
+		Metadata: map[string]interface{}{"industry": "anvils"},
+	})
+
+	company, err := bp.GetCompany(ctx, "Acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if company.Address != "1 Main St" {
+		t.Errorf("address = %q, want it written", company.Address)
+	}
+	if company.Treated || len(company.Metadata) != 0 {
+		t.Errorf("treated %v, metadata %v; want fields outside the allowlist ignored", company.Treated, company.Metadata)
+	}
+}
+
+func TestMilliseconds(t *testing.T) {
+	if got := Milliseconds(1500 * time.Microsecond); got != 1.5 {
+		t.Errorf("Milliseconds(1.5ms) = %v, want 1.5", got)
+	}
+}
+
+func TestProcessBatchTiming(t *testing.T) {
+	bp := newTestProcessor(t)
+	companies := make([]Company, 250)
+	for i := range companies {
+		companies[i] = Company{Name: fmt.Sprintf("Company %d", i)}
+	}
+
+	result, err := bp.ProcessBatch(context.Background(), companies, BatchOptions{})
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	timing := result.Timing
+	if timing.ChunkCount != 3 {
+		t.Errorf("ChunkCount = %d, want 3", timing.ChunkCount)
+	}
+	if timing.WriteMS <= 0 || timing.TotalMS < timing.WriteMS {
+		t.Errorf("timing = %+v, want positive write time within the total", timing)
+	}
+}
+
+func TestLogChunkLevel(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	chunk := &chunkResult{modified: 1, upserted: 2}
+	(&BatchProcessor{batchLogLevel: slog.LevelDebug}).logChunk(context.Background(), chunk)
+	if buf.Len() != 0 {
+		t.Errorf("chunk logged below the logger's level: %s", buf.String())
+	}
+	(&BatchProcessor{batchLogLevel: slog.LevelInfo}).logChunk(context.Background(), chunk)
+	if !strings.Contains(buf.String(), "count=3") {
+		t.Errorf("chunk log = %q, want count=3", buf.String())
+	}
+}
+
+func TestProcessBatchTreatedAt(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	treatedAt := func() time.Time {
+		t.Helper()
+		company, err := bp.GetCompany(ctx, "Acme")
+		if err != nil {
+			t.Fatalf("GetCompany failed: %v", err)
+		}
+		return company.TreatedAt
+	}
+
+	seedCompanies(t, bp, Company{Name: "Acme"})
+	if got := treatedAt(); !got.IsZero() {
+		t.Errorf("treatedAt = %v for an untreated company, want unset", got)
+	}
+	seedCompanies(t, bp, Company{Name: "Acme", Treated: true})
+	first := treatedAt()
+	if first.IsZero() {
+		t.Fatal("treatedAt should be set when the company is treated")
+	}
+	time.Sleep(5 * time.Millisecond)
+	seedCompanies(t, bp, Company{Name: "Acme", Treated: true})
+	if got := treatedAt(); !got.Equal(first) {
+		t.Errorf("treatedAt = %v after treating again, want %v kept", got, first)
+	}
+	seedCompanies(t, bp, Company{Name: "Acme"})
+	if got := treatedAt(); !got.IsZero() {
+		t.Errorf("treatedAt = %v after untreating, want it removed", got)
+	}
+}
+
+func TestUpsertCompany(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+
+	result, err := bp.UpsertCompany(ctx, Company{Name: "Acme"}, BatchOptions{})
+	if err != nil {
+		t.Fatalf("UpsertCompany failed: %v", err)
+	}
+	if fmt.Sprint(result.Created()) != "[Acme]" {
+		t.Errorf("Created = %v, want [Acme]", result.Created())
+	}
+	result, err = bp.UpsertCompany(ctx, Company{Name: "Acme", Address: "1 Main St"}, BatchOptions{})
+	if err != nil {
+		t.Fatalf("UpsertCompany failed: %v", err)
+	}
+	if len(result.Created()) != 0 {
+		t.Errorf("Created = %v for an update, want none", result.Created())
+	}
+	result, err = bp.UpsertCompany(ctx, Company{Name: "Acme", Address: "2 Main St"}, BatchOptions{ConflictStrategy: ConflictSkip})
+	if err != nil || result.Skipped != 1 {
+		t.Errorf("UpsertCompany with ConflictSkip = %+v, %v; want the company skipped", result, err)
+	}
+	if _, err := bp.GetCompany(ctx, "Globex"); !errors.Is(err, ErrCompanyNotFound) {
+		t.Errorf("GetCompany of a missing company = %v, want ErrCompanyNotFound", err)
+	}
+}
+
+func TestProcessBatchSource(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme", Source: "crm"})
+	seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St"})
+
+	company, err := bp.GetCompany(ctx, "Acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if company.Source != "crm" {
+		t.Errorf("source = %q, want crm kept by a write without one", company.Source)
+	}
+	seedCompanies(t, bp, Company{Name: "Acme", Source: "manual"})
+	if company, err := bp.GetCompany(ctx, "Acme"); err != nil || company.Source != "manual" {
+		t.Errorf("GetCompany = %+v, %v; want source manual", company, err)
+	}
+}
+
+func TestUpsertCompanyConcurrent(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+
+	const callers = 8
+	created := make(chan int, callers)
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			result, err := bp.UpsertCompany(ctx, Company{Name: "Acme"}, BatchOptions{})
+			created <- len(result.Created())
+			errs <- err
+		}()
+	}
+	total := 0
+	for i := 0; i < callers; i++ {
+		total += <-created
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent UpsertCompany failed: %v", err)
+		}
+	}
+	if total != 1 {
+		t.Errorf("%d callers reported creating Acme, want 1", total)
+	}
+
+	_, err := bp.UpsertCompany(ctx, Company{Name: "Acme"}, BatchOptions{Mode: ModeInsert})
+	var writeErr *WriteError
+	if !errors.As(err, &writeErr) || writeErr.Code != DuplicateKeyCode {
+		t.Errorf("inserting an existing company = %v, want a duplicate key *WriteError", err)
+	}
+}
+
+func TestProcessBatchKeepAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		keepAddress bool
+		want        string
+	}{
+		{"keep", true, "1 Main St"},
+		{"overwrite", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bp := newTestProcessor(t)
+			ctx := context.Background()
+			seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St"})
+
+			opts := BatchOptions{KeepAddress: tt.keepAddress}
+			if _, err := bp.ProcessBatch(ctx, []Company{{Name: "Acme", Treated: true}}, opts); err != nil {
+				t.Fatalf("ProcessBatch failed: %v", err)
+			}
+			company, err := bp.GetCompany(ctx, "Acme")
+			if err != nil {
+				t.Fatalf("GetCompany failed: %v", err)
+			}
+			if company.Address != tt.want || !company.Treated {
+				t.Errorf("company = %+v, want address %q and treated", company, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportStreamKeepAddress(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St"})
+
+	source := sliceSource([]Company{{Name: "Acme"}, {Name: "Globex", Address: "2 Side St"}}, -1, nil)
+	if _, err := bp.ImportStream(ctx, source, BatchOptions{KeepAddress: true}); err != nil {
+		t.Fatalf("ImportStream failed: %v", err)
+	}
+	for name, want := range map[string]string{"Acme": "1 Main St", "Globex": "2 Side St"} {
+		company, err := bp.GetCompany(ctx, name)
+		if err != nil {
+			t.Fatalf("GetCompany(%q) failed: %v", name, err)
+		}
+		if company.Address != want {
+			t.Errorf("%s address = %q, want %q", name, company.Address, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BulkResult summarizes a mixed upsert/delete request
+type BulkResult struct {
+	Inserted int          `json:"inserted_count"`
+	Modified int          `json:"modified_count"`
+	Matched  int          `json:"matched_count"`
+	Deleted  int          `json:"deleted_count"`
+	Errors   []WriteError `json:"errors,omitempty"`
+}
+
+// ApplyBulk upserts companies and deletes the named companies in a single
+// BulkWrite. Unordered writes continue past individual failures; ordered
+// writes stop at the first one, including an upsert rejected before the
+// write, in which case nothing after it is sent. Failures are reported per
+// operation.
+func (bp *BatchProcessor) ApplyBulk(ctx context.Context, upserts []Company, deletes []string, ordered bool) (_ BulkResult, err error) {
+	defer recoverPanic("ApplyBulk", &err)
+	defer bp.cache.invalidate()
+	var result BulkResult
+
+	type position struct {
+		op    string
+		index int
+		name  string
+	}
+	var operations []mongo.WriteModel
+	var positions []position
+
+	settings := bp.writeSettings(ConflictOverwrite, ModeUpsert)
+	rejected := false
+	for i, company := range upserts {
+		operation, writeError := upsertModel(company, settings)
+		if writeError != nil {
+			writeError.Op = "upsert"
+			writeError.Index = i
+			result.Errors = append(result.Errors, *writeError)
+			if ordered {
+				rejected = true
+				break
+			}
+			continue
+		}
+		operations = append(operations, operation)
+		positions = append(positions, position{"upsert", i, company.Name})
+	}
+	if !rejected {
+		for i, name := range deletes {
+			operation := mongo.NewDeleteOneModel().SetFilter(bson.M{"name": name})
+			if settings.collation != nil {
+				operation.SetCollation(settings.collation)
+			}
+			operations = append(operations, operation)
+			positions = append(positions, position{"delete", i, name})
+		}
+	}
+
+	if len(operations) == 0 {
+		return result, nil
+	}
+
+	opts := options.BulkWrite().SetOrdered(ordered)
+	coll, err := bp.writeCollection(ctx)
+	if err != nil {
+		return result, err
+	}
+	var res *mongo.BulkWriteResult
+	err = retryTransient(ctx, settings.retries, "ApplyBulk", settings.retryable(), func() error {
+		var err error
+		res, err = coll.BulkWrite(ctx, operations, opts)
+		return err
+	})
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+			return result, databaseError("failed to apply bulk operations", err)
+		}
+		for _, we := range bulkErr.WriteErrors {
+			pos := positions[we.Index]
+			result.Errors = append(result.Errors, WriteError{
+				Op:      pos.op,
+				Index:   pos.index,
+				Name:    pos.name,
+				Code:    we.Code,
+				Message: we.Message,
+			})
+		}
+	}
+
+	result.Inserted = int(res.UpsertedCount)
+	result.Modified = int(res.ModifiedCount)
+	result.Matched = int(res.MatchedCount)
+	result.Deleted = int(res.DeletedCount)
+
+	slog.Info("Applied bulk operations",
+		"upserts", len(upserts),
+		"deletes", len(deletes),
+		"deleted", result.Deleted,
+		"failed", len(result.Errors))
+
+	return result, nil
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestApplyBulkMixed(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"}, Company{Name: "Globex"})
+
+	result, err := bp.ApplyBulk(ctx, []Company{
+		{Name: "Initech", Address: "1 Main St"},
+		{Name: "Acme", Address: "2 Main St"},
+	}, []string{"Globex", "Umbrella"}, false)
+	if err != nil {
+		t.Fatalf("ApplyBulk failed: %v", err)
+	}
+	if result.Inserted != 1 || result.Modified != 1 || result.Deleted != 1 {
+		t.Errorf("got inserted %d, modified %d, deleted %d; want 1, 1, 1",
+			result.Inserted, result.Modified, result.Deleted)
+	}
+	if exists, _ := bp.CompanyExists(ctx, "Globex"); exists {
+		t.Error("Globex should have been deleted")
+	}
+}
+
+func TestApplyBulkOrderedStopsAtRejectedUpsert(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Globex"})
+
+	result, err := bp.ApplyBulk(ctx, []Company{
+		{Name: "Acme"},
+		oversizedCompany("Huge"),
+		{Name: "Initech"},
+	}, []string{"Globex"}, true)
+	if err != nil {
+		t.Fatalf("ApplyBulk failed: %v", err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Index != 1 || result.Errors[0].Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected upsert 1 to be rejected as too large, got %+v", result.Errors)
+	}
+	if result.Inserted != 1 || result.Deleted != 0 {
+		t.Errorf("got inserted %d, deleted %d; want only the upsert before the rejection", result.Inserted, result.Deleted)
+	}
+	for name, want := range map[string]bool{"Acme": true, "Initech": false, "Globex": true} {
+		if exists, _ := bp.CompanyExists(ctx, name); exists != want {
+			t.Errorf("%s exists = %v, want %v", name, exists, want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// listLoadTimeout bounds a shared full-list query, which runs detached from
+// the request that started it so other waiters are not failed by its
+// cancellation
+const listLoadTimeout = 30 * time.Second
+
+// ErrCacheDisabled is returned when warming the list cache while caching is
+// off
+var ErrCacheDisabled = errors.New("list cache is disabled")
+
+// CacheWarmResult reports what WarmListCache loaded
+type CacheWarmResult struct {
+	// Entries is the number of cached lists populated
+	Entries int `json:"entries"`
+	// Companies is the number of companies in them
+	Companies  int     `json:"companies"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// WarmListCache loads the full company list into the list cache, replacing
+// any cached copy, so that the first FetchAllCompanies after a deploy is
+// served from memory. The full list for the default collection is the only
+// cached query; tenant and read-option requests always query directly.
+func (bp *BatchProcessor) WarmListCache(ctx context.Context) (_ CacheWarmResult, err error) {
+	defer recoverPanic("WarmListCache", &err)
+	if bp.cache.ttl <= 0 {
+		return CacheWarmResult{}, ErrCacheDisabled
+	}
+
+	start := time.Now()
+	companies, cached, err := bp.cache.refresh(ctx, bp.findAllCompanies)
+	if err != nil {
+		return CacheWarmResult{}, err
+	}
+
+	result := CacheWarmResult{
+		Companies:  len(companies),
+		DurationMS: Milliseconds(time.Since(start)),
+	}
+	if cached {
+		result.Entries = 1
+	}
+	return result, nil
+}
+
+// listCache caches the full company list for ttl, and makes concurrent
+// requests that miss the cache share a single query instead of each scanning
+// the collection. Writes through the BatchProcessor invalidate it.
+type listCache struct {
+	ttl   time.Duration
+	group singleflight.Group
+	// compress keeps the list gzipped in memory, decoding it on every hit
+	compress bool
+
+	mu        sync.Mutex
+	loaded    bool
+	companies []Company
+	// packed and count hold the list instead of companies when compressing
+	packed  []byte
+	count   int
+	expires time.Time
+	// generation is bumped by invalidate; loads started before a write
+	// neither populate the cache nor are shared with requests after it
+	generation uint64
+}
+
+// get returns the cached list, or loads it, sharing the load with concurrent
+// callers. The returned slice may be shared and must not be modified.
+func (c *listCache) get(ctx context.Context, load func(context.Context) ([]Company, error)) ([]Company, error) {
+	c.mu.Lock()
+	hit := c.loaded && time.Now().Before(c.expires)
+	companies, packed, count := c.companies, c.packed, c.count
+	generation := c.generation
+	c.mu.Unlock()
+
+	if hit {
+		if packed == nil {
+			return companies, nil
+		}
+		unpacked, err := unpackCompanies(packed, count)
+		if err == nil {
+			return unpacked, nil
+		}
+		// Reload rather than fail the request
+		slog.Error("Failed to decode cached company list", "error", err)
+	}
+
+	results := c.group.DoChan(strconv.FormatUint(generation, 10), func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), listLoadTimeout)
+		defer cancel()
+
+		companies, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		c.store(companies, generation)
+		return companies, nil
+	})
+
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.([]Company), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// refresh loads the list and caches it, replacing any cached copy, unless a
+// write invalidates the cache while it loads. It reports whether the result
+// was cached.
+func (c *listCache) refresh(ctx context.Context, load func(context.Context) ([]Company, error)) ([]Company, bool, error) {
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+
+	companies, err := load(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return companies, c.store(companies, generation), nil
+}
+
+// store caches companies, compressed if configured, unless the cache was
+// invalidated since generation was read. It reports whether it did.
+func (c *listCache) store(companies []Company, generation uint64) bool {
+	if c.ttl <= 0 {
+		return false
+	}
+	var packed []byte
+	if c.compress {
+		var err error
+		if packed, err = packCompanies(companies); err != nil {
+			slog.Error("Failed to compress company list for caching", "error", err)
+			return false
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return false
+	}
+	c.loaded = true
+	if packed != nil {
+		c.companies, c.packed, c.count = nil, packed, len(companies)
+	} else {
+		c.companies, c.packed, c.count = companies, nil, 0
+	}
+	c.expires = time.Now().Add(c.ttl)
+	return true
+}
+
+// invalidate drops the cached list after a write
+func (c *listCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.loaded = false
+	c.companies = nil
+	c.packed = nil
+}
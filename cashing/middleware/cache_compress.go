@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// packCompanies serializes companies as consecutive BSON documents and gzips
+// the result. BSON round-trips a company exactly as it was read from MongoDB.
+func packCompanies(companies []Company) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for _, company := range companies {
+		doc, err := bson.Marshal(company)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode company %q: %v", company.Name, err)
+		}
+		if _, err := gz.Write(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unpackCompanies reverses packCompanies. Each BSON document starts with its
+// own length, so no framing beyond the documents themselves is needed.
+func unpackCompanies(packed []byte, count int) ([]Company, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	r := bufio.NewReader(gz)
+
+	companies := make([]Company, 0, count)
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err == io.EOF {
+			return companies, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		doc := make([]byte, binary.LittleEndian.Uint32(size[:]))
+		if len(doc) < len(size) {
+			return nil, fmt.Errorf("invalid document length %d", len(doc))
+		}
+		copy(doc, size[:])
+		if _, err := io.ReadFull(r, doc[len(size):]); err != nil {
+			return nil, err
+		}
+
+		var company Company
+		if err := bson.Unmarshal(doc, &company); err != nil {
+			return nil, err
+		}
+		companies = append(companies, company)
+	}
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPackCompaniesRoundTrip(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	companies := []Company{
+		{
+			ID:        primitive.NewObjectID(),
+			Name:      "Acme",
+			Address:   "1 Main St",
+			Treated:   true,
+			Metadata:  map[string]interface{}{"tier": "gold", "employees": int32(12)},
+			CreatedAt: created,
+			UpdatedAt: created.Add(time.Hour),
+			TreatedAt: created.Add(time.Hour),
+			Source:    "crm",
+			Seen:      3,
+		},
+		{Name: "Globex"},
+	}
+	for i := 0; i < 500; i++ {
+		companies = append(companies, Company{Name: fmt.Sprintf("Company %03d", i), Address: "2 Side St"})
+	}
+
+	packed, err := packCompanies(companies)
+	if err != nil {
+		t.Fatalf("packCompanies failed: %v", err)
+	}
+	got, err := unpackCompanies(packed, len(companies))
+	if err != nil {
+		t.Fatalf("unpackCompanies failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, companies) {
+		t.Errorf("round trip changed the list: got %+v, want %+v", got[:2], companies[:2])
+	}
+
+	empty, err := packCompanies(nil)
+	if err != nil {
+		t.Fatalf("packCompanies(nil) failed: %v", err)
+	}
+	if got, err := unpackCompanies(empty, 0); err != nil || len(got) != 0 {
+		t.Errorf("unpackCompanies of an empty list = %v, %v", got, err)
+	}
+}
+
+func TestUnpackCompaniesCorrupt(t *testing.T) {
+	packed, err := packCompanies([]Company{{Name: "Acme"}})
+	if err != nil {
+		t.Fatalf("packCompanies failed: %v", err)
+	}
+	if _, err := unpackCompanies(packed[:len(packed)/2], 1); err == nil {
+		t.Error("unpackCompanies of a truncated payload should fail")
+	}
+}
+
+func TestListCacheCompressed(t *testing.T) {
+	cache := &listCache{ttl: time.Minute, compress: true}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	close(release)
+	load := countingLoad(&calls, release)
+
+	first, err := cache.get(context.Background(), load)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if cache.packed == nil || cache.companies != nil {
+		t.Fatal("cache holds the decoded list, want it compressed")
+	}
+
+	second, err := cache.get(context.Background(), load)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("ran %d loads, want the second get served from the cache", got)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("cached list = %+v, want %+v", second, first)
+	}
+
+	// Each hit decodes its own copy, so callers cannot see each other's changes
+	second[0].Name = "Changed"
+	if third, _ := cache.get(context.Background(), load); third[0].Name != "Acme" {
+		t.Errorf("cached name = %q after a caller changed its copy, want Acme", third[0].Name)
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingLoad returns a load function that counts its calls, blocking each
+// until release is closed
+func countingLoad(calls *atomic.Int32, release <-chan struct{}) func(context.Context) ([]Company, error) {
+	return func(context.Context) ([]Company, error) {
+		calls.Add(1)
+		<-release
+		return []Company{{Name: "Acme"}}, nil
+	}
+}
+
+func TestListCacheSharesLoads(t *testing.T) {
+	cache := &listCache{}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := countingLoad(&calls, release)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if companies, err := cache.get(context.Background(), load); err != nil || len(companies) != 1 {
+				t.Errorf("get = %v, %v", companies, err)
+			}
+		}()
+	}
+	// Give every caller time to join the load before it finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("concurrent gets ran %d loads, want 1", got)
+	}
+	cache.get(context.Background(), load)
+	if got := calls.Load(); got != 2 {
+		t.Errorf("get without a TTL ran %d loads in total, want 2", got)
+	}
+}
+
+func TestListCacheTTL(t *testing.T) {
+	cache := &listCache{ttl: time.Minute}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	close(release)
+	load := countingLoad(&calls, release)
+
+	cache.get(context.Background(), load)
+	cache.get(context.Background(), load)
+	if got := calls.Load(); got != 1 {
+		t.Errorf("cached gets ran %d loads, want 1", got)
+	}
+
+	cache.invalidate()
+	cache.get(context.Background(), load)
+	if got := calls.Load(); got != 2 {
+		t.Errorf("get after invalidate ran %d loads in total, want 2", got)
+	}
+}
+
+func TestListCacheDropsStaleLoads(t *testing.T) {
+	cache := &listCache{ttl: time.Minute}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := countingLoad(&calls, release)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.get(context.Background(), load)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// A write lands while the load is in flight
+	cache.invalidate()
+	close(release)
+	<-done
+
+	cache.get(context.Background(), load)
+	if got := calls.Load(); got != 2 {
+		t.Errorf("ran %d loads, want the load started before the write not cached", got)
+	}
+}
+
+func TestListCacheGetCanceled(t *testing.T) {
+	cache := &listCache{}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.get(ctx, countingLoad(&calls, release)); err != context.Canceled {
+		t.Errorf("get with a canceled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestFetchAllCompaniesCached(t *testing.T) {
+	bp := newTestProcessor(t, WithListCacheTTL(time.Minute))
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"})
+
+	if companies, err := bp.FetchAllCompanies(ctx); err != nil || len(companies) != 1 {
+		t.Fatalf("FetchAllCompanies = %v, %v", companies, err)
+	}
+	// Writes by other clients are not seen until the cache expires
+	if _, err := bp.collection.InsertOne(ctx, Company{Name: "Globex"}); err != nil {
+		t.Fatalf("InsertOne failed: %v", err)
+	}
+	if companies, _ := bp.FetchAllCompanies(ctx); len(companies) != 1 {
+		t.Errorf("got %d companies, want the cached list of 1", len(companies))
+	}
+	// Writes through the processor are
+	seedCompanies(t, bp, Company{Name: "Initech"})
+	if companies, _ := bp.FetchAllCompanies(ctx); len(companies) != 3 {
+		t.Errorf("got %d companies after a batch, want 3", len(companies))
+	}
+}
+
+func TestWarmListCacheDisabled(t *testing.T) {
+	bp := &BatchProcessor{cache: &listCache{}}
+	if _, err := bp.WarmListCache(context.Background()); err != ErrCacheDisabled {
+		t.Errorf("WarmListCache without a TTL = %v, want ErrCacheDisabled", err)
+	}
+}
+
+func TestWarmListCache(t *testing.T) {
+	bp := newTestProcessor(t, WithListCacheTTL(time.Minute))
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"}, Company{Name: "Globex"})
+
+	result, err := bp.WarmListCache(ctx)
+	if err != nil {
+		t.Fatalf("WarmListCache failed: %v", err)
+	}
+	if result.Entries != 1 || result.Companies != 2 {
+		t.Errorf("result = %+v, want 1 entry of 2 companies", result)
+	}
+	// Served from the cache, so a write by another client is not seen
+	if _, err := bp.collection.InsertOne(ctx, Company{Name: "Initech"}); err != nil {
+		t.Fatalf("InsertOne failed: %v", err)
+	}
+	if companies, _ := bp.FetchAllCompanies(ctx); len(companies) != 2 {
+		t.Errorf("got %d companies, want the warmed list of 2", len(companies))
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ClaimNextUntreatedBatch marks up to n untreated companies treated and
+// returns them as updated, oldest first. Fewer than n are returned once no
+// untreated companies remain.
+//
+// MongoDB has no multi-document findAndModify, so each company is claimed by
+// its own findOneAndUpdate. Every single claim is atomic: the filter requires
+// the company to still be untreated, so no company is ever handed to two
+// callers. The batch as a whole is not: concurrent callers interleave, each
+// receiving some of the untreated companies, and if ctx ends or a claim fails
+// partway the companies claimed so far stay treated and are returned along
+// with the error.
+func (bp *BatchProcessor) ClaimNextUntreatedBatch(ctx context.Context, n int) (_ []Company, err error) {
+	defer recoverPanic("ClaimNextUntreatedBatch", &err)
+	defer bp.cache.invalidate()
+	if n <= 0 {
+		return nil, fmt.Errorf("claim size must be positive, got %d", n)
+	}
+
+	coll, err := bp.writeCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := live(bson.M{"treated": bson.M{"$ne": true}})
+	update := timestampedUpdate(bson.M{"treated": true})
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	claimed := make([]Company, 0, n)
+	for len(claimed) < n {
+		var company Company
+		err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&company)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return claimed, fmt.Errorf("failed to claim company %d of %d: %v", len(claimed)+1, n, err)
+		}
+		claimed = append(claimed, company)
+		bp.recordAudit(ctx, company.Name, "treated")
+	}
+
+	slog.Info("Claimed untreated companies", "requested", n, "claimed", len(claimed))
+	return claimed, nil
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClaimNextUntreatedBatch(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	for _, company := range []Company{{Name: "Acme"}, {Name: "Globex", Treated: true}, {Name: "Initech"}, {Name: "Umbrella"}} {
+		seedCompanies(t, bp, company)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	claimed, err := bp.ClaimNextUntreatedBatch(ctx, 2)
+	if err != nil {
+		t.Fatalf("ClaimNextUntreatedBatch failed: %v", err)
+	}
+	if got := companyNames(claimed); fmt.Sprint(got) != "[Acme Initech]" {
+		t.Errorf("claimed %v, want the oldest untreated [Acme Initech]", got)
+	}
+	for _, company := range claimed {
+		if !company.Treated {
+			t.Errorf("%s returned untreated, want the updated document", company.Name)
+		}
+	}
+
+	claimed, err = bp.ClaimNextUntreatedBatch(ctx, 5)
+	if err != nil || fmt.Sprint(companyNames(claimed)) != "[Umbrella]" {
+		t.Errorf("second claim = %v, %v; want the remaining [Umbrella]", companyNames(claimed), err)
+	}
+	if claimed, err := bp.ClaimNextUntreatedBatch(ctx, 1); err != nil || len(claimed) != 0 {
+		t.Errorf("claim with no backlog = %v, %v; want none", companyNames(claimed), err)
+	}
+	if _, err := bp.ClaimNextUntreatedBatch(ctx, 0); err == nil {
+		t.Error("ClaimNextUntreatedBatch should reject a size of 0")
+	}
+}
+
+func TestClaimNextUntreatedBatchConcurrent(t *testing.T) {
+	bp := newTestProcessor(t)
+	var batch []Company
+	for i := 0; i < 20; i++ {
+		batch = append(batch, Company{Name: fmt.Sprintf("Company %02d", i)})
+	}
+	seedCompanies(t, bp, batch...)
+
+	var (
+		mu     sync.Mutex
+		claims = map[string]int{}
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimed, err := bp.ClaimNextUntreatedBatch(context.Background(), 10)
+			if err != nil {
+				t.Errorf("ClaimNextUntreatedBatch failed: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, company := range claimed {
+				claims[company.Name]++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claims) != len(batch) {
+		t.Errorf("claimed %d distinct companies, want %d", len(claims), len(batch))
+	}
+	for name, count := range claims {
+		if count != 1 {
+			t.Errorf("%s was claimed %d times", name, count)
+		}
+	}
+}
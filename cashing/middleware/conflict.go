@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ConflictStrategy decides what happens when companies collide on name,
+// either within a batch or with an existing document. Both compare names as
+// the upsert filter does, under the name collation if one is set.
+type ConflictStrategy string
+
+const (
+	// ConflictOverwrite lets the last entry in the batch win and replaces
+	// existing documents
+	ConflictOverwrite ConflictStrategy = "overwrite"
+	// ConflictSkip keeps the first entry in the batch and leaves existing
+	// documents untouched
+	ConflictSkip ConflictStrategy = "skip"
+	// ConflictError rejects the whole batch if any collision is found
+	ConflictError ConflictStrategy = "error"
+)
+
+// ParseConflictStrategy validates a strategy name; an empty value selects
+// ConflictOverwrite
+func ParseConflictStrategy(value string) (ConflictStrategy, error) {
+	switch strategy := ConflictStrategy(strings.ToLower(value)); strategy {
+	case "":
+		return ConflictOverwrite, nil
+	case ConflictOverwrite, ConflictSkip, ConflictError:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown conflict strategy %q (want skip, overwrite or error)", value)
+	}
+}
+
+// NameConflictError is returned under ConflictError when companies collide
+type NameConflictError struct {
+	Names []string
+}
+
+func (e *NameConflictError) Error() string {
+	return fmt.Sprintf("conflicting company names: %s", strings.Join(e.Names, ", "))
+}
+
+// resolveBatchConflicts removes entries whose names collide within the batch
+// under collation, which may be nil for exact comparison. It returns the
+// remaining companies, the input index of each, and how many entries were
+// dropped.
+func resolveBatchConflicts(companies []Company, strategy ConflictStrategy, collation *options.Collation) ([]Company, []int, int, error) {
+	positions := make(map[string]int, len(companies))
+	resolved := make([]Company, 0, len(companies))
+	indexes := make([]int, 0, len(companies))
+	var conflicts []string
+
+	for i, company := range companies {
+		key := nameKey(company.Name, collation)
+		pos, seen := positions[key]
+		if !seen {
+			positions[key] = len(resolved)
+			resolved = append(resolved, company)
+			indexes = append(indexes, i)
+			continue
+		}
+
+		switch strategy {
+		case ConflictError:
+			conflicts = append(conflicts, company.Name)
+		case ConflictOverwrite:
+			resolved[pos] = company
+			indexes[pos] = i
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, nil, 0, &NameConflictError{Names: conflicts}
+	}
+	return resolved, indexes, len(companies) - len(resolved), nil
+}
+
+// nameKey returns a form of name that is equal for names the collation treats
+// as equal. Strengths 1 and 2 ignore case, so the name is case-folded; other
+// differences the collation ignores, such as accents at strength 1, are left
+// for the unique index to reject.
+func nameKey(name string, collation *options.Collation) string {
+	if collation == nil || collation.Strength == 0 || collation.Strength > 2 {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+// checkExistingConflicts returns a NameConflictError if any of the companies is
+// already stored, comparing names under collation if it is set
+func checkExistingConflicts(ctx context.Context, collection *mongo.Collection, companies []Company, collation *options.Collation) error {
+	names := make([]string, len(companies))
+	for i, company := range companies {
+		names[i] = company.Name
+	}
+
+	opts := findOptions(ctx).
+		SetProjection(bson.M{"_id": 0, "name": 1}).
+		SetCollation(collation)
+	cursor, err := collection.Find(ctx, live(bson.M{"name": bson.M{"$in": names}}), opts)
+	if err != nil {
+		return fmt.Errorf("failed to check existing companies: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var existing []Company
+	if err := cursor.All(ctx, &existing); err != nil {
+		return fmt.Errorf("failed to decode existing companies: %v", err)
+	}
+
+	if len(existing) > 0 {
+		conflicts := make([]string, len(existing))
+		for i, company := range existing {
+			conflicts[i] = company.Name
+		}
+		return &NameConflictError{Names: conflicts}
+	}
+	return nil
+}
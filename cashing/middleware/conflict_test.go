@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestParseConflictStrategy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ConflictStrategy
+		wantErr bool
+	}{
+		{"", ConflictOverwrite, false},
+		{"overwrite", ConflictOverwrite, false},
+		{"SKIP", ConflictSkip, false},
+		{"error", ConflictError, false},
+		{"merge", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseConflictStrategy(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseConflictStrategy(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveBatchConflicts(t *testing.T) {
+	batch := []Company{
+		{Name: "Acme", Address: "1 First St"},
+		{Name: "Globex", Address: "2 Second St"},
+		{Name: "Acme", Address: "3 Third St"},
+		{Name: "ACME", Address: "4 Fourth St"},
+	}
+
+	tests := []struct {
+		strategy     ConflictStrategy
+		wantAddress  []string
+		wantIndexes  []int
+		wantDropped  int
+		wantConflict []string
+	}{
+		{ConflictOverwrite, []string{"3 Third St", "2 Second St", "4 Fourth St"}, []int{2, 1, 3}, 1, nil},
+		{ConflictSkip, []string{"1 First St", "2 Second St", "4 Fourth St"}, []int{0, 1, 3}, 1, nil},
+		{ConflictError, nil, nil, 0, []string{"Acme"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			resolved, indexes, dropped, err := resolveBatchConflicts(batch, tt.strategy, nil)
+			if tt.wantConflict != nil {
+				var conflict *NameConflictError
+				if !errors.As(err, &conflict) {
+					t.Fatalf("expected a NameConflictError, got %v", err)
+				}
+				if !reflect.DeepEqual(conflict.Names, tt.wantConflict) {
+					t.Errorf("conflicting names = %v, want %v", conflict.Names, tt.wantConflict)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			addresses := make([]string, len(resolved))
+			for i, company := range resolved {
+				addresses[i] = company.Address
+			}
+			if !reflect.DeepEqual(addresses, tt.wantAddress) {
+				t.Errorf("addresses = %v, want %v", addresses, tt.wantAddress)
+			}
+			if !reflect.DeepEqual(indexes, tt.wantIndexes) {
+				t.Errorf("indexes = %v, want %v", indexes, tt.wantIndexes)
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestResolveBatchConflictsCollation(t *testing.T) {
+	batch := []Company{{Name: "Acme", Address: "1 First St"}, {Name: "ACME", Address: "2 Second St"}}
+
+	tests := []struct {
+		name      string
+		collation *options.Collation
+		want      int
+	}{
+		{"exact", nil, 2},
+		{"case-insensitive", &options.Collation{Locale: "en", Strength: 2}, 1},
+		{"case-sensitive", &options.Collation{Locale: "en", Strength: 3}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, _, _, err := resolveBatchConflicts(batch, ConflictOverwrite, tt.collation)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(resolved) != tt.want {
+				t.Errorf("resolved %d companies, want %d", len(resolved), tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessBatchCaseVariantConflict(t *testing.T) {
+	batch := []Company{{Name: "Acme", Address: "1 First St"}, {Name: "ACME", Address: "2 Second St"}}
+
+	t.Run("error", func(t *testing.T) {
+		bp := newTestProcessor(t, WithNameCollation("en", 2))
+		_, err := bp.ProcessBatch(context.Background(), batch, BatchOptions{ConflictStrategy: ConflictError})
+		var conflict *NameConflictError
+		if !errors.As(err, &conflict) || !reflect.DeepEqual(conflict.Names, []string{"ACME"}) {
+			t.Errorf("ProcessBatch = %v, want a conflict on ACME", err)
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		bp := newTestProcessor(t, WithNameCollation("en", 2))
+		ctx := context.Background()
+		result, err := bp.ProcessBatch(ctx, batch, BatchOptions{ConflictStrategy: ConflictOverwrite})
+		if err != nil {
+			t.Fatalf("ProcessBatch failed: %v", err)
+		}
+		if result.Overwritten != 1 {
+			t.Errorf("overwritten = %d, want 1", result.Overwritten)
+		}
+		company, err := bp.GetCompany(ctx, "acme")
+		if err != nil {
+			t.Fatalf("GetCompany failed: %v", err)
+		}
+		if company.Name != "ACME" || company.Address != "2 Second St" {
+			t.Errorf("company = %+v, want the last entry", company)
+		}
+	})
+}
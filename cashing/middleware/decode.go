@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// decodeCompanies reads every document from cur, skipping and logging any
+// that cannot be decoded as a Company (for example a treated flag stored as a
+// string) so that one bad record does not fail the whole read. op names the
+// read in the log. An error from the cursor itself is still returned.
+func decodeCompanies(ctx context.Context, cur *mongo.Cursor, op string) ([]Company, error) {
+	companies := []Company{}
+	_, err := decodeEach(ctx, cur, op, func(company Company) error {
+		companies = append(companies, company)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return companies, nil
+}
+
+// decodeEach calls fn with each document from cur, skipping and logging those
+// that cannot be decoded as decodeCompanies does, and returns how many were
+// skipped. An error from fn stops the read and is returned as is.
+func decodeEach(ctx context.Context, cur *mongo.Cursor, op string, fn func(Company) error) (int, error) {
+	skipped, decoded := 0, 0
+	for cur.Next(ctx) {
+		company, ok := decodeCurrent(cur, op)
+		if !ok {
+			skipped++
+			continue
+		}
+		decoded++
+		if err := fn(company); err != nil {
+			return skipped, err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return skipped, databaseError("failed to decode companies", err)
+	}
+
+	logSkipped(op, skipped, decoded)
+	return skipped, nil
+}
+
+// decodeCurrent decodes the document cur is positioned on, logging it and
+// reporting false if it cannot be decoded as a Company
+func decodeCurrent(cur *mongo.Cursor, op string) (Company, bool) {
+	var company Company
+	if err := cur.Decode(&company); err != nil {
+		slog.Warn("Skipping undecodable company",
+			"op", op,
+			"id", cur.Current.Lookup("_id").String(),
+			"error", err)
+		return Company{}, false
+	}
+	return company, true
+}
+
+// logSkipped summarizes the documents a read skipped, if any
+func logSkipped(op string, skipped, decoded int) {
+	if skipped > 0 {
+		slog.Warn("Skipped undecodable companies", "op", op, "skipped", skipped, "returned", decoded)
+	}
+}
+
+// decodePage reads a page of up to limit companies from cur, which was
+// queried for limit+1 documents so that a further page can be detected.
+// Undecodable documents are skipped but still count towards the page, so a
+// bad document does not end the listing early. cursorOf builds the cursor
+// from the sort key of the page's last document, decoded or not, so a page
+// on which nothing decodes is returned empty with a cursor past it.
+func decodePage(ctx context.Context, cur *mongo.Cursor, op string, limit int, cursorOf func(bson.Raw) (string, bool)) (*Page, error) {
+	companies := []Company{}
+	var last bson.Raw
+	seen, skipped := 0, 0
+	for cur.Next(ctx) {
+		seen++
+		if seen > limit {
+			// The extra document only tells that another page follows
+			break
+		}
+		last = append(last[:0], cur.Current...)
+		company, ok := decodeCurrent(cur, op)
+		if !ok {
+			skipped++
+			continue
+		}
+		companies = append(companies, company)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, databaseError("failed to decode companies", err)
+	}
+	logSkipped(op, skipped, len(companies))
+
+	page := &Page{Companies: companies}
+	if seen > limit {
+		next, ok := cursorOf(last)
+		if !ok {
+			return nil, fmt.Errorf("failed to decode companies: the last document on the page has no usable sort key")
+		}
+		page.HasMore = true
+		page.NextCursor = next
+	}
+	return page, nil
+}
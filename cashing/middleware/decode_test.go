@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// seedMalformed stores Acme and Initech around a document whose treated flag
+// is a string and so cannot be decoded as a Company
+func seedMalformed(t *testing.T, bp *BatchProcessor) {
+	t.Helper()
+	seedCompanies(t, bp, Company{Name: "Acme"}, Company{Name: "Initech"})
+	if _, err := bp.collection.InsertOne(context.Background(), bson.M{"name": "Broken", "treated": "yes"}); err != nil {
+		t.Fatalf("failed to insert malformed document: %v", err)
+	}
+}
+
+func companyNames(companies []Company) []string {
+	names := make([]string, len(companies))
+	for i, company := range companies {
+		names[i] = company.Name
+	}
+	return names
+}
+
+func TestReadsSkipMalformedDocuments(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedMalformed(t, bp)
+
+	all, err := bp.FetchAllCompanies(ctx)
+	if err != nil {
+		t.Fatalf("FetchAllCompanies failed: %v", err)
+	}
+	if got := companyNames(all); len(got) != 2 || got[0] != "Acme" || got[1] != "Initech" {
+		t.Errorf("FetchAllCompanies = %v, want [Acme Initech]", got)
+	}
+
+	var exported []string
+	if err := bp.EachCompany(ctx, func(company Company) error {
+		exported = append(exported, company.Name)
+		return nil
+	}); err != nil {
+		t.Fatalf("EachCompany failed: %v", err)
+	}
+	if len(exported) != 2 {
+		t.Errorf("EachCompany visited %v, want Acme and Initech", exported)
+	}
+
+	scanned, err := bp.ScanCompanies(ctx, 10, "")
+	if err != nil {
+		t.Fatalf("ScanCompanies failed: %v", err)
+	}
+	if len(scanned.Companies) != 2 || scanned.HasMore {
+		t.Errorf("ScanCompanies = %v (has more %v), want Acme and Initech only", companyNames(scanned.Companies), scanned.HasMore)
+	}
+}
+
+func TestPagesContinuePastMalformedDocument(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedMalformed(t, bp)
+
+	// In name order the malformed document sits between the two companies
+	var names []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		page, err := bp.FetchCompaniesPage(ctx, 1, cursor)
+		if err != nil {
+			t.Fatalf("FetchCompaniesPage failed: %v", err)
+		}
+		names = append(names, companyNames(page.Companies)...)
+		if !page.HasMore {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(names) != 2 || names[0] != "Acme" || names[1] != "Initech" {
+		t.Errorf("paged through %v, want [Acme Initech]", names)
+	}
+}
+
+func TestDecodePageAllUndecodable(t *testing.T) {
+	docs := []interface{}{
+		bson.M{"name": "Broken", "treated": "yes"},
+		bson.M{"name": "Bust", "treated": "no"},
+		bson.M{"name": "Initech"},
+	}
+	cur, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	if err != nil {
+		t.Fatalf("NewCursorFromDocuments failed: %v", err)
+	}
+	ctx := context.Background()
+	page, err := decodePage(ctx, cur, "test", 2, func(doc bson.Raw) (string, bool) {
+		return doc.Lookup("name").StringValueOK()
+	})
+	if err != nil {
+		t.Fatalf("decodePage failed: %v", err)
+	}
+	if len(page.Companies) != 0 || !page.HasMore || page.NextCursor != "Bust" {
+		t.Errorf("page = %+v, want an empty page continuing after Bust", page)
+	}
+}
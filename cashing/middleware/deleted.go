@@ -0,0 +1,19 @@
+package middleware
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// softDeleted are the fields a full sync with SoftDelete sets on the
+// companies it removes
+var softDeleted = []string{"deleted", "deletedAt"}
+
+// live restricts filter to companies that have not been soft-deleted. Every
+// read goes through it, so a soft-deleted company is gone for clients until
+// it is uploaded again or purged for good with PurgeDeleted.
+func live(filter bson.M) bson.M {
+	restricted := make(bson.M, len(filter)+1)
+	for key, value := range filter {
+		restricted[key] = value
+	}
+	restricted["deleted"] = bson.M{"$ne": true}
+	return restricted
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLive(t *testing.T) {
+	filter := bson.M{"name": "Acme"}
+	want := bson.M{"name": "Acme", "deleted": bson.M{"$ne": true}}
+	if got := live(filter); !reflect.DeepEqual(got, want) {
+		t.Errorf("live = %v, want %v", got, want)
+	}
+	if len(filter) != 1 {
+		t.Errorf("live modified its argument: %v", filter)
+	}
+}
+
+// softDelete marks the named company deleted as a soft full sync would
+func softDelete(t *testing.T, bp *BatchProcessor, name string) {
+	t.Helper()
+	_, err := bp.collection.UpdateOne(context.Background(), bson.M{"name": name},
+		bson.M{"$set": bson.M{"deleted": true, "deletedAt": time.Now()}})
+	if err != nil {
+		t.Fatalf("failed to soft-delete %s: %v", name, err)
+	}
+	bp.cache.invalidate()
+}
+
+func TestReadsExcludeSoftDeleted(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"}, Company{Name: "Globex"})
+	softDelete(t, bp, "Globex")
+
+	if _, err := bp.GetCompany(ctx, "Globex"); !errors.Is(err, ErrCompanyNotFound) {
+		t.Errorf("GetCompany = %v, want ErrCompanyNotFound", err)
+	}
+	if exists, err := bp.CompanyExists(ctx, "Globex"); err != nil || exists {
+		t.Errorf("CompanyExists = %v, %v; want false", exists, err)
+	}
+	if err := bp.SetTreated(ctx, "Globex", true); !errors.Is(err, ErrCompanyNotFound) {
+		t.Errorf("SetTreated = %v, want ErrCompanyNotFound", err)
+	}
+
+	all, err := bp.FetchAllCompanies(ctx)
+	if err != nil || len(all) != 1 {
+		t.Errorf("FetchAllCompanies = %v, %v; want Acme only", companyNames(all), err)
+	}
+	page, err := bp.FetchCompaniesPage(ctx, 10, "")
+	if err != nil || len(page.Companies) != 1 {
+		t.Errorf("FetchCompaniesPage = %+v, %v; want Acme only", page, err)
+	}
+	search, err := bp.SearchCompaniesByName(ctx, "glob", 10, "")
+	if err != nil || len(search.Companies) != 0 {
+		t.Errorf("SearchCompaniesByName = %+v, %v; want nothing", search, err)
+	}
+	if count, err := bp.CountCompanies(ctx, ""); err != nil || count != 1 {
+		t.Errorf("CountCompanies = %d, %v; want 1", count, err)
+	}
+	if byName, err := bp.GetCompaniesByNames(ctx, []string{"Acme", "Globex"}); err != nil || len(byName) != 1 {
+		t.Errorf("GetCompaniesByNames = %v, %v; want Acme only", companyNames(byName), err)
+	}
+	exported := 0
+	if err := bp.EachCompany(ctx, func(Company) error { exported++; return nil }); err != nil || exported != 1 {
+		t.Errorf("EachCompany visited %d companies (%v), want 1", exported, err)
+	}
+	claimed, err := bp.ClaimNextUntreatedBatch(ctx, 5)
+	if err != nil || len(claimed) != 1 || claimed[0].Name != "Acme" {
+		t.Errorf("ClaimNextUntreatedBatch = %v, %v; want Acme only", companyNames(claimed), err)
+	}
+}
+
+func TestUploadRestoresSoftDeleted(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Globex", Address: "1 Main St"})
+	softDelete(t, bp, "Globex")
+
+	seedCompanies(t, bp, Company{Name: "Globex", Address: "1 Main St"})
+	if _, err := bp.GetCompany(ctx, "Globex"); err != nil {
+		t.Errorf("GetCompany after re-upload failed: %v", err)
+	}
+	count, err := bp.collection.CountDocuments(ctx, bson.M{"deleted": bson.M{"$exists": true}})
+	if err != nil || count != 0 {
+		t.Errorf("%d documents still carry the deleted flag (%v), want 0", count, err)
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// CompanyChange names a company an import would change and the fields that
+// differ from the stored record
+type CompanyChange struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+// BatchDiff classifies the companies of a batch against the stored records
+type BatchDiff struct {
+	// New lists the companies that are not stored yet
+	New []string `json:"new"`
+	// Changed lists the companies an upsert would modify
+	Changed []CompanyChange `json:"changed"`
+	// Unchanged lists the companies an upsert would leave as they are
+	Unchanged []string `json:"unchanged"`
+}
+
+// GetCompaniesByNames retrieves the stored companies with the given names.
+// Names that are not stored are left out of the result.
+func (bp *BatchProcessor) GetCompaniesByNames(ctx context.Context, names []string) (_ []Company, err error) {
+	defer recoverPanic("GetCompaniesByNames", &err)
+	if len(names) == 0 {
+		return []Company{}, nil
+	}
+
+	opts := findOptions(ctx).SetCollation(bp.nameCollation)
+	cursor, err := bp.readCollection(ctx).Find(ctx, live(bson.M{"name": bson.M{"$in": names}}), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch companies: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	return decodeCompanies(ctx, cursor, "GetCompaniesByNames")
+}
+
+// DiffBatch reports, without writing anything, which companies of a batch
+// are new, which an upsert would change and which it would leave unchanged.
+// Stored records are fetched by name one chunk of the batch size at a time.
+// Only the fields an upsert writes are compared, following the same rules:
+// an empty source and metadata keys absent from the input leave the stored
+// value in place.
+func (bp *BatchProcessor) DiffBatch(ctx context.Context, companies []Company) (_ BatchDiff, err error) {
+	defer recoverPanic("DiffBatch", &err)
+	diff := BatchDiff{New: []string{}, Changed: []CompanyChange{}, Unchanged: []string{}}
+
+	for start := 0; start < len(companies); start += bp.batchSize {
+		end := min(start+bp.batchSize, len(companies))
+		chunk := companies[start:end]
+
+		names := make([]string, len(chunk))
+		for i, company := range chunk {
+			names[i] = company.Name
+		}
+		found, err := bp.GetCompaniesByNames(ctx, names)
+		if err != nil {
+			return BatchDiff{}, err
+		}
+		stored := make(map[string]Company, len(found))
+		for _, company := range found {
+			stored[company.Name] = company
+		}
+
+		for _, company := range chunk {
+			existing, ok := stored[company.Name]
+			if !ok {
+				diff.New = append(diff.New, company.Name)
+				continue
+			}
+			// Compare the address as an upsert would store it
+			company.Address = bp.addressNormalization.apply(company.Address)
+			if fields := bp.fields.changedFields(existing, company); len(fields) > 0 {
+				diff.Changed = append(diff.Changed, CompanyChange{Name: company.Name, Fields: fields})
+			} else {
+				diff.Unchanged = append(diff.Unchanged, company.Name)
+			}
+		}
+	}
+	return diff, nil
+}
+
+// changedFields lists the fields an upsert of incoming would change on
+// stored, mirroring what upsertModel writes
+func (fields fieldSet) changedFields(stored, incoming Company) []string {
+	var changed []string
+	if fields["address"] && stored.Address != incoming.Address {
+		changed = append(changed, "address")
+	}
+	if fields["treated"] && stored.Treated != incoming.Treated {
+		changed = append(changed, "treated")
+	}
+	if fields["source"] && incoming.Source != "" && stored.Source != incoming.Source {
+		changed = append(changed, "source")
+	}
+	if fields["metadata"] {
+		keys := make([]string, 0, len(incoming.Metadata))
+		for key := range incoming.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			current, ok := stored.Metadata[key]
+			if !ok || !sameStoredValue(current, incoming.Metadata[key]) {
+				changed = append(changed, "metadata."+key)
+			}
+		}
+	}
+	return changed
+}
+
+// sameStoredValue reports whether a and b are stored as the same BSON value.
+// Both are round-tripped through BSON so that, for example, a json.Number and
+// the int64 it was stored as compare equal, as do nested documents whose keys
+// are in a different order.
+func sameStoredValue(a, b interface{}) bool {
+	normalA, errA := storedValue(a)
+	normalB, errB := storedValue(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return reflect.DeepEqual(normalA, normalB)
+}
+
+// storedValue returns v as it decodes after being stored
+func storedValue(v interface{}) (interface{}, error) {
+	data, err := bson.Marshal(bson.M{"v": v})
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc["v"], nil
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestChangedFields(t *testing.T) {
+	stored := Company{
+		Name:     "Acme",
+		Address:  "1 Main St",
+		Treated:  true,
+		Source:   "crm",
+		Metadata: map[string]interface{}{"staff": int64(12), "region": "eu"},
+	}
+	all := fieldSet{"address": true, "treated": true, "source": true, "metadata": true}
+	tests := []struct {
+		name     string
+		fields   fieldSet
+		incoming Company
+		want     []string
+	}{
+		{"unchanged", all, Company{Name: "Acme", Address: "1 Main St", Treated: true, Metadata: map[string]interface{}{"staff": json.Number("12")}}, nil},
+		{"address and treated", all, Company{Name: "Acme", Address: "2 Main St", Source: "crm"}, []string{"address", "treated"}},
+		{"new source", all, Company{Name: "Acme", Address: "1 Main St", Treated: true, Source: "manual"}, []string{"source"}},
+		{"metadata keys", all, Company{Name: "Acme", Address: "1 Main St", Treated: true, Metadata: map[string]interface{}{"staff": 13, "phone": "555-0100"}},
+			[]string{"metadata.phone", "metadata.staff"}},
+		{"fields not written", fieldSet{"metadata": true}, Company{Name: "Acme"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fields.changedFields(stored, tt.incoming); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changedFields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameStoredValue(t *testing.T) {
+	tests := []struct {
+		a, b interface{}
+		want bool
+	}{
+		{json.Number("12"), int64(12), true},
+		{json.Number("12"), "12", false},
+		{map[string]interface{}{"a": 1, "b": "x"}, map[string]interface{}{"b": "x", "a": 1}, true},
+		{[]interface{}{1, 2}, []interface{}{2, 1}, false},
+	}
+	for _, tt := range tests {
+		if got := sameStoredValue(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameStoredValue(%#v, %#v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDiffBatch(t *testing.T) {
+	bp := newTestProcessor(t)
+	seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St"}, Company{Name: "Globex", Address: "2 Main St"})
+
+	diff, err := bp.DiffBatch(context.Background(), []Company{
+		{Name: "Acme", Address: "1 Main St"},
+		{Name: "Globex", Address: "3 Main St"},
+		{Name: "Initech"},
+	})
+	if err != nil {
+		t.Fatalf("DiffBatch failed: %v", err)
+	}
+	want := BatchDiff{
+		New:       []string{"Initech"},
+		Changed:   []CompanyChange{{Name: "Globex", Fields: []string{"address"}}},
+		Unchanged: []string{"Acme"},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff = %+v, want %+v", diff, want)
+	}
+
+	if company, err := bp.GetCompany(context.Background(), "Initech"); err == nil {
+		t.Errorf("DiffBatch wrote %+v", company)
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// EachCompany calls fn for every company in name order, decoding one document
+// at a time so memory stays flat however large the collection. Documents that
+// cannot be decoded are skipped and logged. It stops at the first error from
+// fn.
+func (bp *BatchProcessor) EachCompany(ctx context.Context, fn func(Company) error) (err error) {
+	defer recoverPanic("EachCompany", &err)
+	opts := findOptions(ctx).
+		SetSort(bson.D{{Key: "name", Value: 1}}).
+		SetCollation(bp.nameCollation)
+	cur, err := bp.readCollection(ctx).Find(ctx, live(bson.M{}), opts)
+	if err != nil {
+		return fmt.Errorf("failed to fetch companies: %v", err)
+	}
+	defer cur.Close(ctx)
+
+	_, err = decodeEach(ctx, cur, "EachCompany", fn)
+	return err
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestEachCompany(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Charlie"}, Company{Name: "Alpha"}, Company{Name: "Bravo"})
+
+	var names []string
+	err := bp.EachCompany(ctx, func(company Company) error {
+		names = append(names, company.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachCompany failed: %v", err)
+	}
+	if fmt.Sprint(names) != "[Alpha Bravo Charlie]" {
+		t.Errorf("names = %v, want [Alpha Bravo Charlie]", names)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = bp.EachCompany(ctx, func(Company) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("EachCompany = %v after %d calls, want the callback's error after 1", err, calls)
+	}
+}
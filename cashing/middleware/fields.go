@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FieldUse is something a request may do with a stored company field
+type FieldUse int
+
+const (
+	// FieldSettable fields may be written by uploads
+	FieldSettable FieldUse = iota
+	// FieldFilterable fields may appear in query filters
+	FieldFilterable
+	// FieldSortable fields may order results
+	FieldSortable
+	// FieldGroupable fields may be grouped on for counts
+	FieldGroupable
+)
+
+// String names the use in error messages
+func (u FieldUse) String() string {
+	switch u {
+	case FieldSettable:
+		return "settable"
+	case FieldFilterable:
+		return "filterable"
+	case FieldSortable:
+		return "sortable"
+	case FieldGroupable:
+		return "groupable"
+	default:
+		return fmt.Sprintf("FieldUse(%d)", int(u))
+	}
+}
+
+// companyFields is the single allowlist of stored company fields and what
+// each may be used for. Every field name that reaches a query, sort, group or
+// update comes from here, so adding a field is a one-line change and
+// request input can never name an arbitrary path.
+var companyFields = map[string][]FieldUse{
+	"name":      {FieldFilterable, FieldSortable},
+	"address":   {FieldSettable, FieldFilterable, FieldSortable, FieldGroupable},
+	"treated":   {FieldSettable, FieldFilterable, FieldSortable, FieldGroupable},
+	"metadata":  {FieldSettable},
+	"source":    {FieldSettable, FieldFilterable, FieldSortable, FieldGroupable},
+	"seen":      {FieldFilterable, FieldSortable},
+	"createdAt": {FieldFilterable, FieldSortable},
+	"updatedAt": {FieldFilterable, FieldSortable},
+	"treatedAt": {FieldFilterable, FieldSortable},
+}
+
+// FieldsFor returns the fields allowed for use, sorted by name
+func FieldsFor(use FieldUse) []string {
+	var fields []string
+	for field, uses := range companyFields {
+		for _, u := range uses {
+			if u == use {
+				fields = append(fields, field)
+				break
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// CheckField returns an error unless field is allowed for use
+func CheckField(field string, use FieldUse) error {
+	for _, u := range companyFields[field] {
+		if u == use {
+			return nil
+		}
+	}
+	return fmt.Errorf("field %q is not %s; expected one of %s", field, use, strings.Join(FieldsFor(use), ", "))
+}
+
+// SettableFields are the company fields an upsert may write. The name is
+// always written since it identifies the company; server-maintained fields
+// such as _id and the timestamps are never settable.
+var SettableFields = FieldsFor(FieldSettable)
+
+// fieldSet is the set of fields an upsert writes
+type fieldSet map[string]bool
+
+// newFieldSet builds a fieldSet from field names, rejecting any that are not
+// settable. An empty list allows every settable field.
+func newFieldSet(fields []string) (fieldSet, error) {
+	if len(fields) == 0 {
+		fields = SettableFields
+	}
+
+	set := make(fieldSet, len(fields))
+	for _, field := range fields {
+		if err := CheckField(field, FieldSettable); err != nil {
+			return nil, err
+		}
+		set[field] = true
+	}
+	return set, nil
+}
+
+// restrict returns the fields of set that are also listed in fields, for a
+// write limited to a subset of what the processor allows. An empty list
+// leaves set as it is.
+func (set fieldSet) restrict(fields []string) fieldSet {
+	if len(fields) == 0 {
+		return set
+	}
+	restricted := make(fieldSet, len(fields))
+	for _, field := range fields {
+		if set[field] {
+			restricted[field] = true
+		}
+	}
+	return restricted
+}
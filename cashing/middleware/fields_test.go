@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNewFieldSet(t *testing.T) {
+	all, err := newFieldSet(nil)
+	if err != nil {
+		t.Fatalf("newFieldSet(nil) failed: %v", err)
+	}
+	if len(all) != len(SettableFields) {
+		t.Errorf("newFieldSet(nil) = %v, want every settable field", all)
+	}
+	for _, field := range []string{"name", "createdAt", "seen", "bogus"} {
+		if _, err := newFieldSet([]string{field}); err == nil {
+			t.Errorf("newFieldSet accepted %q, which is not settable", field)
+		}
+	}
+}
+
+func TestFieldSetRestrict(t *testing.T) {
+	set := fieldSet{"address": true, "treated": true, "metadata": true}
+	tests := []struct {
+		fields []string
+		want   fieldSet
+	}{
+		{nil, set},
+		{[]string{"address"}, fieldSet{"address": true}},
+		{[]string{"name", "address"}, fieldSet{"address": true}},
+		{[]string{"name"}, fieldSet{}},
+		{[]string{"source"}, fieldSet{}},
+	}
+	for _, tt := range tests {
+		if got := set.restrict(tt.fields); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("restrict(%v) = %v, want %v", tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestFieldsFor(t *testing.T) {
+	tests := []struct {
+		use  FieldUse
+		want []string
+	}{
+		{FieldSettable, []string{"address", "metadata", "source", "treated"}},
+		{FieldGroupable, []string{"address", "source", "treated"}},
+	}
+	for _, tt := range tests {
+		if got := FieldsFor(tt.use); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FieldsFor(%s) = %v, want %v", tt.use, got, tt.want)
+		}
+	}
+	if !reflect.DeepEqual(SettableFields, FieldsFor(FieldSettable)) {
+		t.Errorf("SettableFields = %v, want the settable fields of the table", SettableFields)
+	}
+}
+
+func TestCheckField(t *testing.T) {
+	tests := []struct {
+		field string
+		use   FieldUse
+		ok    bool
+	}{
+		{"name", FieldSortable, true},
+		{"name", FieldSettable, false},
+		{"metadata", FieldSortable, false},
+		{"treatedAt", FieldFilterable, true},
+		{"$where", FieldFilterable, false},
+		{"metadata.industry", FieldFilterable, false},
+	}
+	for _, tt := range tests {
+		err := CheckField(tt.field, tt.use)
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckField(%q, %s) = %v, want allowed %v", tt.field, tt.use, err, tt.ok)
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.use.String()) {
+			t.Errorf("CheckField(%q, %s) error %q should name the use", tt.field, tt.use, err)
+		}
+	}
+}
+
+func TestFieldUseString(t *testing.T) {
+	if got := FieldUse(42).String(); got != "FieldUse(42)" {
+		t.Errorf("String of an unknown use = %q", got)
+	}
+}
+
+func TestFindLatestRejectsUnsortableField(t *testing.T) {
+	bp := &BatchProcessor{}
+	if _, err := bp.findLatest(context.Background(), "metadata", bson.M{}, 10); err == nil {
+		t.Error("findLatest should reject a field that is not sortable")
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// groupKeyMissing is the key under which CountGroupedBy counts companies
+// without the field
+const groupKeyMissing = "null"
+
+// CountGroupedBy counts companies by their value of field, which must be
+// groupable (see FieldsFor). Values are keyed by their string form, so a
+// treated flag yields "true" and "false"; companies without the field are
+// counted under "null".
+func (bp *BatchProcessor) CountGroupedBy(ctx context.Context, field string) (_ map[string]int64, err error) {
+	defer recoverPanic("CountGroupedBy", &err)
+	if err := CheckField(field, FieldGroupable); err != nil {
+		return nil, err
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": live(bson.M{})},
+		bson.M{"$group": bson.M{
+			"_id":   "$" + field,
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+	cursor, err := bp.readCollection(ctx).Aggregate(ctx, pipeline, aggregateOptions(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count companies by %s: %v", field, err)
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Value interface{} `bson:"_id"`
+		Count int64       `bson:"count"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode %s counts: %v", field, err)
+	}
+
+	// Values of different BSON types can share a string form, e.g. a
+	// treated flag stored as true and as "true", so counts are summed
+	counts := make(map[string]int64, len(groups))
+	for _, group := range groups {
+		key := groupKeyMissing
+		if group.Value != nil {
+			key = fmt.Sprint(group.Value)
+		}
+		counts[key] += group.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCountGroupedBy(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp,
+		Company{Name: "Acme", Treated: true, Source: "crm"},
+		Company{Name: "Globex", Treated: true},
+		Company{Name: "Initech", Source: "crm"},
+		Company{Name: "Umbrella", Source: "crm"})
+	softDelete(t, bp, "Umbrella")
+	// A treated flag stored as a string counts with the booleans
+	if _, err := bp.collection.InsertOne(ctx, bson.M{"name": "Hooli", "treated": "true"}); err != nil {
+		t.Fatalf("InsertOne failed: %v", err)
+	}
+
+	tests := []struct {
+		field string
+		want  map[string]int64
+	}{
+		{"treated", map[string]int64{"true": 3, "false": 1}},
+		{"source", map[string]int64{"crm": 2, "null": 2}},
+	}
+	for _, tt := range tests {
+		got, err := bp.CountGroupedBy(ctx, tt.field)
+		if err != nil {
+			t.Fatalf("CountGroupedBy(%q) failed: %v", tt.field, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CountGroupedBy(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+
+	if _, err := bp.CountGroupedBy(ctx, "name"); err == nil {
+		t.Error("CountGroupedBy should reject a field that is not groupable")
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestProcessor connects to the MongoDB server named by MONGO_TEST_URI,
+// skipping the test when it is unset, and returns a processor writing to a
+// database of its own that is dropped when the test ends. Tests of full syncs
+// need transactions, so the server must be a replica set.
+func newTestProcessor(t *testing.T, opts ...Option) *BatchProcessor {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	dbName := fmt.Sprintf("company_api_test_%d", time.Now().UnixNano())
+	bp, err := NewBatchProcessor(uri, dbName, "companies", 100, 2, opts...)
+	if err != nil {
+		t.Fatalf("failed to create batch processor: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := bp.collection.Database().Drop(ctx); err != nil {
+			t.Errorf("failed to drop test database: %v", err)
+		}
+		bp.Close(ctx)
+	})
+	return bp
+}
+
+// seedCompanies stores companies with a plain upsert batch
+func seedCompanies(t *testing.T, bp *BatchProcessor, companies ...Company) {
+	t.Helper()
+	if _, err := bp.ProcessBatch(context.Background(), companies, BatchOptions{}); err != nil {
+		t.Fatalf("failed to seed companies: %v", err)
+	}
+}
+
+// oversizedCompany returns a company too large to be stored
+func oversizedCompany(name string) Company {
+	return Company{Name: name, Metadata: map[string]interface{}{
+		"blob": strings.Repeat("x", maxDocumentSize),
+	}}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// importFeedBuffer is how many entries a subscriber may fall behind before
+// further entries are dropped for it
+const importFeedBuffer = 64
+
+// importFeed fans new import log entries out to in-process subscribers. It
+// only sees imports recorded by this instance; change streams would cover
+// every instance but need a replica set.
+// Each subscriber is mapped to the tenant whose entries it receives.
+type importFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan ImportLog]string
+}
+
+// newImportFeed returns a feed with no subscribers
+func newImportFeed() *importFeed {
+	return &importFeed{subscribers: make(map[chan ImportLog]string)}
+}
+
+// publish hands entry to every subscriber of its tenant without blocking the
+// import that recorded it; a subscriber whose buffer is full misses the entry
+func (f *importFeed) publish(entry ImportLog) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch, tenant := range f.subscribers {
+		if tenant != entry.Tenant {
+			continue
+		}
+		select {
+		case ch <- entry:
+		default:
+			slog.Warn("Dropped import log entry for slow subscriber", "import_id", entry.ID)
+		}
+	}
+}
+
+// SubscribeImports returns a channel that receives each import log entry of
+// ctx's tenant recorded by this instance from now on, and a function that
+// ends the subscription and closes the channel. Entries are dropped for a
+// subscriber that falls more than a few dozen behind.
+func (bp *BatchProcessor) SubscribeImports(ctx context.Context) (<-chan ImportLog, func()) {
+	ch := make(chan ImportLog, importFeedBuffer)
+	bp.importFeed.mu.Lock()
+	bp.importFeed.subscribers[ch] = tenantFrom(ctx)
+	bp.importFeed.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			bp.importFeed.mu.Lock()
+			delete(bp.importFeed.subscribers, ch)
+			bp.importFeed.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, unsubscribe
+}
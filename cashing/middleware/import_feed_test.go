@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+)
+
+func TestImportFeedDropsForSlowSubscriber(t *testing.T) {
+	bp := &BatchProcessor{importFeed: newImportFeed()}
+	entries, unsubscribe := bp.SubscribeImports(context.Background())
+	defer unsubscribe()
+
+	for i := 0; i < importFeedBuffer+10; i++ {
+		bp.importFeed.publish(ImportLog{ID: "x"})
+	}
+	if len(entries) != importFeedBuffer {
+		t.Errorf("subscriber holds %d entries, want %d", len(entries), importFeedBuffer)
+	}
+}
+
+func TestImportFeedUnsubscribe(t *testing.T) {
+	bp := &BatchProcessor{importFeed: newImportFeed()}
+	entries, unsubscribe := bp.SubscribeImports(context.Background())
+
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-entries; ok {
+		t.Error("channel still open after unsubscribe")
+	}
+	if len(bp.importFeed.subscribers) != 0 {
+		t.Errorf("%d subscribers left after unsubscribe", len(bp.importFeed.subscribers))
+	}
+	// Publishing after the subscriber left must not send on its closed channel
+	bp.importFeed.publish(ImportLog{ID: "1"})
+}
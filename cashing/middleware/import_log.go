@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrImportNotFound is returned when no import log entry has the given id
+var ErrImportNotFound = errors.New("import not found")
+
+// ImportLog records what a single batch import did. Tenant is empty for the
+// default tenant.
+type ImportLog struct {
+	ID          string    `bson:"_id" json:"id"`
+	Tenant      string    `bson:"tenant,omitempty" json:"tenant,omitempty"`
+	Timestamp   time.Time `bson:"timestamp" json:"timestamp"`
+	Processed   int       `bson:"processed" json:"processed_count"`
+	Inserted    int       `bson:"inserted" json:"inserted_count"`
+	Modified    int       `bson:"modified" json:"modified_count"`
+	Unchanged   int       `bson:"unchanged" json:"unchanged_count"`
+	Skipped     int       `bson:"skipped" json:"skipped_count"`
+	Overwritten int       `bson:"overwritten" json:"overwritten_count"`
+	Failed      int       `bson:"failed" json:"failed_count"`
+	// Deleted counts the companies removed by a full sync
+	Deleted int `bson:"deleted,omitempty" json:"deleted_count,omitempty"`
+	// Names lists the companies the import wrote, including unchanged ones.
+	// They are stored apart from the entry, see ImportNames, and filled in
+	// only on entries published to SubscribeImports.
+	Names []string `bson:"-" json:"names"`
+}
+
+// ImportNamesPage is a page of the company names an import wrote, in the
+// order they were written
+type ImportNamesPage struct {
+	Names      []string `json:"names"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+	HasMore    bool     `json:"has_more"`
+}
+
+// importName records one company name an import wrote. Names are stored one
+// document each, keyed by import id, so an import of any size stays within
+// MongoDB's document size limit.
+type importName struct {
+	ID     primitive.ObjectID `bson:"_id"`
+	Import string             `bson:"import"`
+	Name   string             `bson:"name"`
+}
+
+// importNamesChunk is how many names are inserted per InsertMany
+const importNamesChunk = 1000
+
+// ensureImportIndexes creates the index used to page through an import's
+// names
+func ensureImportIndexes(ctx context.Context, names *mongo.Collection) error {
+	_, err := names.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "import", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create import names index: %v", err)
+	}
+	return nil
+}
+
+// recordImport stores an import log entry for a processed batch and returns
+// its id
+func (bp *BatchProcessor) recordImport(ctx context.Context, result BatchResult) (string, error) {
+	entry := ImportLog{
+		ID:          primitive.NewObjectID().Hex(),
+		Tenant:      tenantFrom(ctx),
+		Timestamp:   time.Now().UTC(),
+		Processed:   result.Processed,
+		Inserted:    result.Inserted,
+		Modified:    result.Modified,
+		Unchanged:   result.Unchanged,
+		Skipped:     result.Skipped,
+		Overwritten: result.Overwritten,
+		Failed:      len(result.Errors),
+		Deleted:     result.Deleted,
+		Names:       result.affected,
+	}
+	if entry.Names == nil {
+		entry.Names = []string{}
+	}
+
+	// The names go first, so an entry that can be read has all of its names
+	if err := bp.recordImportNames(ctx, entry.ID, entry.Names); err != nil {
+		return "", err
+	}
+	if _, err := bp.imports.InsertOne(ctx, entry); err != nil {
+		return "", fmt.Errorf("failed to record import: %v", err)
+	}
+	bp.importFeed.publish(entry)
+	return entry.ID, nil
+}
+
+// recordImportNames stores the names an import wrote, in order
+func (bp *BatchProcessor) recordImportNames(ctx context.Context, id string, names []string) error {
+	for start := 0; start < len(names); start += importNamesChunk {
+		chunk := names[start:min(start+importNamesChunk, len(names))]
+		docs := make([]interface{}, len(chunk))
+		for i, name := range chunk {
+			docs[i] = importName{ID: primitive.NewObjectID(), Import: id, Name: name}
+		}
+		if _, err := bp.importNames.InsertMany(ctx, docs); err != nil {
+			return fmt.Errorf("failed to record import names: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetImport retrieves an import log entry by id. Imports of another tenant
+// are not found.
+func (bp *BatchProcessor) GetImport(ctx context.Context, id string) (_ *ImportLog, err error) {
+	defer recoverPanic("GetImport", &err)
+	var entry ImportLog
+	err = bp.imports.FindOne(ctx, bson.M{"_id": id, "tenant": tenantFilter(ctx)}).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrImportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch import: %v", err)
+	}
+	return &entry, nil
+}
+
+// ImportNames returns a page of up to limit names written by the import with
+// the given id, starting after cursor (empty for the first page). Imports of
+// another tenant are not found.
+func (bp *BatchProcessor) ImportNames(ctx context.Context, id string, limit int, cursor string) (_ *ImportNamesPage, err error) {
+	defer recoverPanic("ImportNames", &err)
+	if _, err := bp.GetImport(ctx, id); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"import": id}
+	if cursor != "" {
+		after, err := primitive.ObjectIDFromHex(cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		filter["_id"] = bson.M{"$gt": after}
+	}
+	opts := findOptions(ctx).
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit) + 1)
+
+	cur, err := bp.importNames.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch import names: %v", err)
+	}
+	defer cur.Close(ctx)
+
+	var names []importName
+	if err := cur.All(ctx, &names); err != nil {
+		return nil, fmt.Errorf("failed to decode import names: %v", err)
+	}
+
+	page := &ImportNamesPage{Names: []string{}}
+	if len(names) > limit {
+		names = names[:limit]
+		page.HasMore = true
+		page.NextCursor = names[limit-1].ID.Hex()
+	}
+	for _, name := range names {
+		page.Names = append(page.Names, name.Name)
+	}
+	return page, nil
+}
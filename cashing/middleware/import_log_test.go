@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestGetImport(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+
+	result, err := bp.ProcessBatch(ctx, []Company{{Name: "Acme"}, {Name: "Globex"}}, BatchOptions{})
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	if result.ImportID == "" {
+		t.Fatal("ProcessBatch returned no import id")
+	}
+
+	entry, err := bp.GetImport(ctx, result.ImportID)
+	if err != nil {
+		t.Fatalf("GetImport failed: %v", err)
+	}
+	if entry.Processed != 2 {
+		t.Errorf("import = %+v, want 2 processed", entry)
+	}
+	names, err := bp.ImportNames(ctx, result.ImportID, 10, "")
+	if err != nil {
+		t.Fatalf("ImportNames failed: %v", err)
+	}
+	if len(names.Names) != 2 || names.HasMore {
+		t.Errorf("import names = %+v, want 2 names on one page", names)
+	}
+
+	if _, err := bp.GetImport(ctx, "unknown"); !errors.Is(err, ErrImportNotFound) {
+		t.Errorf("GetImport of an unknown id = %v, want ErrImportNotFound", err)
+	}
+}
+
+func TestImportNamesPages(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+
+	// More names than one insert chunk, so they span several InsertMany calls
+	companies := make([]Company, importNamesChunk+5)
+	for i := range companies {
+		companies[i] = Company{Name: fmt.Sprintf("Company %04d", i)}
+	}
+	result, err := bp.ProcessBatch(ctx, companies, BatchOptions{})
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(companies) {
+			t.Fatal("ImportNames never reported the last page")
+		}
+		page, err := bp.ImportNames(ctx, result.ImportID, 300, cursor)
+		if err != nil {
+			t.Fatalf("ImportNames failed: %v", err)
+		}
+		for _, name := range page.Names {
+			if seen[name] {
+				t.Errorf("name %q returned twice", name)
+			}
+			seen[name] = true
+		}
+		if !page.HasMore {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(seen) != len(companies) {
+		t.Errorf("paged through %d names, want %d", len(seen), len(companies))
+	}
+
+	if _, err := bp.ImportNames(ctx, result.ImportID, 10, "not-an-id"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("ImportNames with a bad cursor = %v, want ErrInvalidCursor", err)
+	}
+	if _, err := bp.ImportNames(tenantContext(t, "acme"), result.ImportID, 10, ""); !errors.Is(err, ErrImportNotFound) {
+		t.Errorf("ImportNames of another tenant's import = %v, want ErrImportNotFound", err)
+	}
+}
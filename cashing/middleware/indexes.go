@@ -0,0 +1,289 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexBuildMode selects how ensureIndexes asks the server to build indexes
+type IndexBuildMode string
+
+const (
+	// IndexBuildBackground requests background builds, which do not block
+	// other operations on servers before 4.2
+	IndexBuildBackground IndexBuildMode = "background"
+	// IndexBuildForeground requests the server's default build. Servers before
+	// 4.2 build in the foreground, locking the collection until done.
+	IndexBuildForeground IndexBuildMode = "foreground"
+)
+
+// ParseIndexBuildMode validates a mode name; an empty value selects
+// IndexBuildBackground
+func ParseIndexBuildMode(value string) (IndexBuildMode, error) {
+	switch mode := IndexBuildMode(strings.ToLower(value)); mode {
+	case "":
+		return IndexBuildBackground, nil
+	case IndexBuildBackground, IndexBuildForeground:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown index build mode %q (want background or foreground)", value)
+	}
+}
+
+// indexSpec describes one index the service relies on. A collated index is
+// built with the name collation, if one is configured.
+type indexSpec struct {
+	name     string
+	keys     bson.D
+	unique   bool
+	collated bool
+}
+
+// companyIndexes are the indexes created on the companies collection
+var companyIndexes = []indexSpec{
+	// Unique names, and faster lookups by name
+	{name: "name", keys: bson.D{{Key: "name", Value: 1}}, unique: true, collated: true},
+	// Supports queries for companies changed within a time window
+	{name: "updatedAt", keys: bson.D{{Key: "updatedAt", Value: 1}}},
+	// Supports listing the most recently created companies
+	{name: "createdAt", keys: bson.D{{Key: "createdAt", Value: -1}}},
+	// Supports listing the most recently treated companies
+	{name: "treatedAt", keys: bson.D{{Key: "treatedAt", Value: -1}}},
+}
+
+// indexOptions returns the options for spec under build. The background flag
+// is deprecated and ignored from MongoDB 4.2, where every build holds an
+// exclusive lock only at its start and end; it is still sent in background
+// mode so older servers do not block, and omitted in foreground mode so they
+// do. Either way createIndexes returns once the build has finished.
+func (spec indexSpec) indexOptions(build indexBuild) *options.IndexOptions {
+	opts := options.Index()
+	if spec.unique {
+		opts.SetUnique(true)
+	}
+	if spec.collated && build.collation != nil {
+		opts.SetCollation(build.collation)
+	}
+	if build.mode == IndexBuildBackground {
+		opts.SetBackground(true)
+	}
+	return opts
+}
+
+// indexRaceBackoff is the delay before the first retry of an index build
+// that raced another; each further retry waits one more step
+const indexRaceBackoff = 250 * time.Millisecond
+
+// indexRaceCodes are the server errors a createIndexes can fail with when
+// another instance creates the same collection or index at the same time
+var indexRaceCodes = []int{
+	48,  // NamespaceExists: the collection was created concurrently
+	68,  // IndexAlreadyExists
+	117, // ConflictingOperationInProgress
+	276, // IndexBuildAlreadyInProgress
+}
+
+// indexBuild holds the settings ensureIndexes builds indexes with
+type indexBuild struct {
+	mode IndexBuildMode
+	// raceRetries is how many times a build that raced another instance's is
+	// retried before checking whether the index ended up present anyway
+	raceRetries int
+	// collation is the name collation collated indexes are built with
+	collation *options.Collation
+}
+
+// isIndexRace reports whether err is a transient conflict with a concurrent
+// build of the same collection or index
+func isIndexRace(err error) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	for _, code := range indexRaceCodes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureIndexes creates the indexes the service relies on, logging the start
+// and completion of each build
+func ensureIndexes(ctx context.Context, collection *mongo.Collection, build indexBuild) error {
+	for _, spec := range companyIndexes {
+		start := time.Now()
+		slog.Info("Building index",
+			"collection", collection.Name(),
+			"index", spec.name,
+			"mode", build.mode)
+
+		if err := spec.create(ctx, collection, build); err != nil {
+			return fmt.Errorf("failed to create %s index: %v", spec.name, err)
+		}
+
+		slog.Info("Built index",
+			"collection", collection.Name(),
+			"index", spec.name,
+			"mode", build.mode,
+			"duration", time.Since(start))
+	}
+	return nil
+}
+
+// create builds the index. When several replicas start against a fresh
+// collection at once, their builds can conflict; such a failure is retried,
+// since createIndexes succeeds without change once an identical index exists,
+// and if the retries run out the build still counts as done when the index is
+// present.
+func (spec indexSpec) create(ctx context.Context, collection *mongo.Collection, build indexBuild) error {
+	model := mongo.IndexModel{
+		Keys:    spec.keys,
+		Options: spec.indexOptions(build),
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		if _, err = collection.Indexes().CreateOne(ctx, model); err == nil || !isIndexRace(err) {
+			return err
+		}
+		if attempt >= build.raceRetries {
+			break
+		}
+		slog.Warn("Index build conflicted with a concurrent build, retrying",
+			"collection", collection.Name(),
+			"index", spec.name,
+			"attempt", attempt+1,
+			"error", err)
+		select {
+		case <-time.After(time.Duration(attempt+1) * indexRaceBackoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	present, listErr := spec.present(ctx, collection)
+	if listErr != nil {
+		return fmt.Errorf("%v (and failed to list indexes: %v)", err, listErr)
+	}
+	if !present {
+		return err
+	}
+	slog.Warn("Index build conflicted with a concurrent build, but the index is present",
+		"collection", collection.Name(),
+		"index", spec.name,
+		"error", err)
+	return nil
+}
+
+// present reports whether the collection has an index on spec's keys
+func (spec indexSpec) present(ctx context.Context, collection *mongo.Collection) (bool, error) {
+	specs, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return false, err
+	}
+	want, err := bson.Marshal(spec.keys)
+	if err != nil {
+		return false, err
+	}
+	for _, existing := range specs {
+		if bytes.Equal(existing.KeysDocument, want) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IndexInfo describes an index on the companies collection and, where the
+// server reports it, how often it has been used
+type IndexInfo struct {
+	Name   string     `json:"name"`
+	Keys   []IndexKey `json:"keys"`
+	Unique bool       `json:"unique,omitempty"`
+	// Accesses counts the operations that used the index since Since; both
+	// are absent when usage statistics are unavailable
+	Accesses *int64     `json:"accesses,omitempty"`
+	Since    *time.Time `json:"since,omitempty"`
+}
+
+// IndexKey is one field of an index key, in index order. Order is 1 or -1
+// for ascending or descending, or a string such as "text" for special
+// indexes.
+type IndexKey struct {
+	Field string      `json:"field"`
+	Order interface{} `json:"order"`
+}
+
+// ListIndexes returns the indexes of the request's companies collection with
+// their usage counts from $indexStats. Usage is per server and resets when it
+// restarts. Statistics are optional: if $indexStats fails, for instance for
+// lack of the privilege, the indexes are listed without them.
+func (bp *BatchProcessor) ListIndexes(ctx context.Context) (_ []IndexInfo, err error) {
+	defer recoverPanic("ListIndexes", &err)
+	coll := bp.baseCollection(ctx)
+
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %v", err)
+	}
+	var indexes []struct {
+		Name   string `bson:"name"`
+		Key    bson.D `bson:"key"`
+		Unique bool   `bson:"unique"`
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, fmt.Errorf("failed to decode indexes: %v", err)
+	}
+
+	usage, err := indexUsage(ctx, coll)
+	if err != nil {
+		slog.Warn("Index usage statistics unavailable", "collection", coll.Name(), "error", err)
+	}
+
+	infos := make([]IndexInfo, len(indexes))
+	for i, index := range indexes {
+		infos[i] = IndexInfo{Name: index.Name, Keys: make([]IndexKey, len(index.Key)), Unique: index.Unique}
+		for j, key := range index.Key {
+			infos[i].Keys[j] = IndexKey{Field: key.Key, Order: key.Value}
+		}
+		if stats, ok := usage[index.Name]; ok {
+			infos[i].Accesses = &stats.Accesses.Ops
+			infos[i].Since = &stats.Accesses.Since
+		}
+	}
+	return infos, nil
+}
+
+// indexStats is one $indexStats result
+type indexStats struct {
+	Name     string `bson:"name"`
+	Accesses struct {
+		Ops   int64     `bson:"ops"`
+		Since time.Time `bson:"since"`
+	} `bson:"accesses"`
+}
+
+// indexUsage returns the $indexStats of collection's indexes by name
+func indexUsage(ctx context.Context, collection *mongo.Collection) (map[string]indexStats, error) {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{{{Key: "$indexStats", Value: bson.M{}}}}, aggregateOptions(ctx))
+	if err != nil {
+		return nil, err
+	}
+	var stats []indexStats
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, err
+	}
+	usage := make(map[string]indexStats, len(stats))
+	for _, s := range stats {
+		usage[s.Name] = s
+	}
+	return usage, nil
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestIndexOptionsCollation(t *testing.T) {
+	collation := &options.Collation{Locale: "en", Strength: 2}
+	build := indexBuild{mode: IndexBuildForeground, collation: collation}
+
+	for _, spec := range companyIndexes {
+		opts := spec.indexOptions(build)
+		if spec.name == "name" {
+			if opts.Collation != collation || opts.Unique == nil || !*opts.Unique {
+				t.Errorf("name index options = %+v, want unique with the name collation", opts)
+			}
+			continue
+		}
+		if opts.Collation != nil {
+			t.Errorf("%s index has collation %+v, want none", spec.name, opts.Collation)
+		}
+	}
+
+	if opts := companyIndexes[0].indexOptions(indexBuild{mode: IndexBuildBackground}); opts.Collation != nil || opts.Background == nil {
+		t.Errorf("name index options without a collation = %+v, want a plain background build", opts)
+	}
+}
+
+func TestParseIndexBuildMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    IndexBuildMode
+		wantErr bool
+	}{
+		{"", IndexBuildBackground, false},
+		{"background", IndexBuildBackground, false},
+		{"Foreground", IndexBuildForeground, false},
+		{"hybrid", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseIndexBuildMode(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseIndexBuildMode(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestIndexOptionsBuildMode(t *testing.T) {
+	for _, spec := range companyIndexes {
+		if opts := spec.indexOptions(indexBuild{mode: IndexBuildBackground}); opts.Background == nil || !*opts.Background {
+			t.Errorf("%s index in background mode = %+v, want the background flag", spec.name, opts)
+		}
+		if opts := spec.indexOptions(indexBuild{mode: IndexBuildForeground}); opts.Background != nil {
+			t.Errorf("%s index in foreground mode = %+v, want no background flag", spec.name, opts)
+		}
+	}
+}
+
+func TestEnsureIndexesForeground(t *testing.T) {
+	bp := newTestProcessor(t, WithIndexBuildMode(IndexBuildForeground))
+	for _, spec := range companyIndexes {
+		present, err := spec.present(context.Background(), bp.collection)
+		if err != nil {
+			t.Fatalf("failed to list indexes: %v", err)
+		}
+		if !present {
+			t.Errorf("%s index missing after a foreground build", spec.name)
+		}
+	}
+}
+
+func TestIsIndexRace(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"namespace exists", mongo.CommandError{Code: 48, Message: "collection already exists"}, true},
+		{"build in progress", fmt.Errorf("create: %w", mongo.CommandError{Code: 276, Message: "index build already in progress"}), true},
+		{"conflicting options", mongo.CommandError{Code: 85, Message: "index options conflict"}, false},
+		{"not a server error", errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isIndexRace(tt.err); got != tt.want {
+			t.Errorf("%s: isIndexRace = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnsureIndexesConcurrently(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	// A fresh collection, as when several replicas start at once
+	coll := bp.collection.Database().Collection("companies_race")
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- ensureIndexes(ctx, coll, indexBuild{mode: IndexBuildBackground, raceRetries: 3})
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent ensureIndexes failed: %v", err)
+		}
+	}
+	for _, spec := range companyIndexes {
+		if present, err := spec.present(ctx, coll); err != nil || !present {
+			t.Errorf("%s index present = %v, %v; want present", spec.name, present, err)
+		}
+	}
+}
+
+func TestMissingIndexes(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+
+	missing, err := bp.MissingIndexes(ctx)
+	if err != nil {
+		t.Fatalf("MissingIndexes failed: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("missing = %v after startup, want none", missing)
+	}
+
+	if _, err := bp.collection.Indexes().DropOne(ctx, nameIndex); err != nil {
+		t.Fatalf("failed to drop the name index: %v", err)
+	}
+	missing, err = bp.MissingIndexes(ctx)
+	if err != nil {
+		t.Fatalf("MissingIndexes failed: %v", err)
+	}
+	if len(missing) != 1 || missing[0] != nameIndex {
+		t.Errorf("missing = %v, want [%s]", missing, nameIndex)
+	}
+}
+
+func TestListIndexes(t *testing.T) {
+	bp := newTestProcessor(t)
+	seedCompanies(t, bp, Company{Name: "Acme"})
+	if _, err := bp.GetCompany(context.Background(), "Acme"); err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+
+	indexes, err := bp.ListIndexes(context.Background())
+	if err != nil {
+		t.Fatalf("ListIndexes failed: %v", err)
+	}
+	var found bool
+	for _, index := range indexes {
+		if len(index.Keys) != 1 || index.Keys[0].Field != "name" {
+			continue
+		}
+		found = true
+		if !index.Unique {
+			t.Errorf("name index %q is not unique", index.Name)
+		}
+		if index.Accesses != nil && *index.Accesses == 0 {
+			t.Errorf("name index %q reports no use after a lookup by name", index.Name)
+		}
+	}
+	if !found {
+		t.Errorf("indexes = %+v, want one on name", indexes)
+	}
+}
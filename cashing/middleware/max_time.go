@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxTimeGrace is added to the time left on a request when setting an
+// operation's maxTimeMS, so the request's own deadline fires first and is
+// reported as a timeout, while the server still stops shortly after
+const maxTimeGrace = 100 * time.Millisecond
+
+// maxTime returns the server-side time limit for a query run under ctx, or 0
+// if ctx has no deadline. Cancelling ctx only abandons the operation on the
+// client; without maxTimeMS the server keeps running it, holding resources
+// for a result nobody will read.
+func maxTime(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	return max(time.Until(deadline), 0) + maxTimeGrace
+}
+
+// findOptions returns Find options limited to ctx's remaining time
+func findOptions(ctx context.Context) *options.FindOptions {
+	opts := options.Find()
+	if d := maxTime(ctx); d > 0 {
+		opts.SetMaxTime(d)
+	}
+	return opts
+}
+
+// aggregateOptions returns Aggregate options limited to ctx's remaining time
+func aggregateOptions(ctx context.Context) *options.AggregateOptions {
+	opts := options.Aggregate()
+	if d := maxTime(ctx); d > 0 {
+		opts.SetMaxTime(d)
+	}
+	return opts
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMaxTime(t *testing.T) {
+	if got := maxTime(context.Background()); got != 0 {
+		t.Errorf("maxTime without a deadline = %v, want 0", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if got := maxTime(ctx); got <= 4*time.Second || got > 5*time.Second+maxTimeGrace {
+		t.Errorf("maxTime with 5s left = %v, want about 5s plus the grace", got)
+	}
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	if got := maxTime(expired); got != maxTimeGrace {
+		t.Errorf("maxTime past the deadline = %v, want %v", got, maxTimeGrace)
+	}
+}
+
+func TestQueryOptionsMaxTime(t *testing.T) {
+	if opts := aggregateOptions(context.Background()); opts.MaxTime != nil {
+		t.Errorf("aggregate MaxTime without a deadline = %v, want unset", *opts.MaxTime)
+	}
+	if opts := findOptions(context.Background()); opts.MaxTime != nil {
+		t.Errorf("find MaxTime without a deadline = %v, want unset", *opts.MaxTime)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if opts := aggregateOptions(ctx); opts.MaxTime == nil || *opts.MaxTime <= time.Second || *opts.MaxTime > 2*time.Second+maxTimeGrace {
+		t.Errorf("aggregate MaxTime = %v, want the 2s left on the request", opts.MaxTime)
+	}
+	if opts := findOptions(ctx); opts.MaxTime == nil || *opts.MaxTime <= time.Second || *opts.MaxTime > 2*time.Second+maxTimeGrace {
+		t.Errorf("find MaxTime = %v, want the 2s left on the request", opts.MaxTime)
+	}
+}
+
+func TestAggregateWithDeadline(t *testing.T) {
+	bp := newTestProcessor(t)
+	seedCompanies(t, bp, Company{Name: "Acme", Treated: true}, Company{Name: "Globex"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	counts, err := bp.CountGroupedBy(ctx, "treated")
+	if err != nil {
+		t.Fatalf("CountGroupedBy with a deadline failed: %v", err)
+	}
+	if len(counts) != 2 {
+		t.Errorf("counts = %v, want one group per treated value", counts)
+	}
+}
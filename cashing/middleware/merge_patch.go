@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidPatch is returned when a merge patch body is not a JSON object
+var ErrInvalidPatch = errors.New("invalid merge patch")
+
+// MergePatch is an RFC 7386 JSON Merge Patch translated into field updates.
+// Set maps field paths, such as "address" or "metadata.region", to their new
+// values; Unset lists the paths an explicit null removes. Fields the patch
+// omits appear in neither and are left as they are.
+type MergePatch struct {
+	Set   bson.M
+	Unset []string
+}
+
+// ParseMergePatch translates a JSON Merge Patch document. Top-level members
+// must be settable fields (see FieldsFor). metadata is merged key by key,
+// recursively for nested objects, so a patch only touches the metadata keys
+// it names. name cannot be patched; rename the company instead. A body that
+// is not a JSON object fails with ErrInvalidPatch; invalid members are all
+// reported together in a *ValidationError.
+func ParseMergePatch(data []byte) (MergePatch, error) {
+	patch := MergePatch{Set: bson.M{}}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return patch, fmt.Errorf("%w: body must be a JSON object: %v", ErrInvalidPatch, err)
+	}
+
+	invalid := &ValidationError{}
+	for _, field := range sortedKeys(members) {
+		raw := members[field]
+		if err := CheckField(field, FieldSettable); err != nil {
+			invalid.add(field, "is not a settable field")
+			continue
+		}
+		if isJSONNull(raw) {
+			patch.Unset = append(patch.Unset, field)
+			continue
+		}
+
+		switch field {
+		case "metadata":
+			patch.mergeObject("metadata", raw, invalid)
+		case "treated":
+			var treated bool
+			if err := json.Unmarshal(raw, &treated); err != nil {
+				invalid.add(field, "must be a boolean or null")
+				continue
+			}
+			patch.Set[field] = treated
+		default:
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				invalid.add(field, "must be a string or null")
+				continue
+			}
+			patch.Set[field] = value
+		}
+	}
+	return patch, invalid.err()
+}
+
+// mergeObject adds the members of the JSON object raw under path: nulls are
+// unset, objects are merged recursively and other values replace what is
+// stored. Invalid keys are recorded in invalid.
+func (patch *MergePatch) mergeObject(path string, raw json.RawMessage, invalid *ValidationError) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		invalid.add(path, "must be an object or null")
+		return
+	}
+
+	for _, key := range sortedKeys(members) {
+		value := members[key]
+		keyPath := path + "." + key
+		if !validMetadataKey(key) {
+			invalid.add(keyPath, "invalid metadata key %q", key)
+			continue
+		}
+
+		switch {
+		case isJSONNull(value):
+			patch.Unset = append(patch.Unset, keyPath)
+		case bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")):
+			patch.mergeObject(keyPath, value, invalid)
+		default:
+			// Numbers stay json.Number, as in Company.UnmarshalJSON
+			dec := json.NewDecoder(bytes.NewReader(value))
+			dec.UseNumber()
+			var decoded interface{}
+			if err := dec.Decode(&decoded); err != nil {
+				invalid.add(keyPath, "%v", err)
+				continue
+			}
+			patch.Set[keyPath] = decoded
+		}
+	}
+}
+
+// sortedKeys returns the keys of members in order, so that errors and updates
+// are reported deterministically
+func sortedKeys(members map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isJSONNull reports whether raw is the JSON literal null
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// withAddress returns patch with the address it sets normalized under mode.
+// With raw set, addressRaw follows the address: it is set to the address as
+// received, and removed along with the address. patch itself is not changed.
+func (patch MergePatch) withAddress(mode AddressNormalization, raw bool) MergePatch {
+	if address, ok := patch.Set["address"].(string); ok {
+		set := make(bson.M, len(patch.Set)+1)
+		for key, value := range patch.Set {
+			set[key] = value
+		}
+		set["address"] = mode.apply(address)
+		if raw {
+			set["addressRaw"] = address
+		}
+		patch.Set = set
+	}
+	if raw && slices.Contains(patch.Unset, "address") {
+		patch.Unset = append(slices.Clip(patch.Unset), "addressRaw")
+	}
+	return patch
+}
+
+// PatchCompany applies a merge patch to the named company and returns it as
+// updated. updatedAt only changes if the patch changes something. A patched
+// address is normalized as upserts normalize it.
+func (bp *BatchProcessor) PatchCompany(ctx context.Context, name string, patch MergePatch) (_ *Company, err error) {
+	defer recoverPanic("PatchCompany", &err)
+	defer bp.cache.invalidate()
+
+	coll, err := bp.writeCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	patch = patch.withAddress(bp.addressNormalization, bp.rawAddress)
+	var company Company
+	err = coll.FindOneAndUpdate(ctx,
+		live(bson.M{"name": name}),
+		timestampedUpdate(patch.Set, patch.Unset...),
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetCollation(bp.nameCollation),
+	).Decode(&company)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrCompanyNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch company: %v", err)
+	}
+
+	bp.recordAudit(ctx, company.Name, "patched")
+	slog.Info("Patched company", "name", name, "set", len(patch.Set), "unset", len(patch.Unset))
+	return &company, nil
+}
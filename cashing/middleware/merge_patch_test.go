@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseMergePatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantSet   bson.M
+		wantUnset []string
+	}{
+		{"set", `{"address":"1 Main St","treated":true}`, bson.M{"address": "1 Main St", "treated": true}, nil},
+		{"unset", `{"address":null,"source":null}`, bson.M{}, []string{"address", "source"}},
+		{"metadata merged by key", `{"metadata":{"region":"eu","phone":null,"hq":{"city":"Paris"},"staff":12}}`,
+			bson.M{"metadata.region": "eu", "metadata.hq.city": "Paris", "metadata.staff": json.Number("12")},
+			[]string{"metadata.phone"}},
+		{"metadata removed", `{"metadata":null}`, bson.M{}, []string{"metadata"}},
+		{"empty", `{}`, bson.M{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := ParseMergePatch([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("ParseMergePatch failed: %v", err)
+			}
+			if !reflect.DeepEqual(patch.Set, tt.wantSet) {
+				t.Errorf("Set = %v, want %v", patch.Set, tt.wantSet)
+			}
+			if !reflect.DeepEqual(patch.Unset, tt.wantUnset) {
+				t.Errorf("Unset = %v, want %v", patch.Unset, tt.wantUnset)
+			}
+		})
+	}
+}
+
+func TestParseMergePatchInvalid(t *testing.T) {
+	if _, err := ParseMergePatch([]byte(`["address"]`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("array body = %v, want ErrInvalidPatch", err)
+	}
+
+	_, err := ParseMergePatch([]byte(`{"name":"Globex","treated":"yes","address":7,"metadata":{"a.b":1}}`))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("error = %v, want a *ValidationError", err)
+	}
+	var fields []string
+	for _, field := range invalid.Fields {
+		fields = append(fields, field.Field)
+	}
+	if want := []string{"address", "metadata.a.b", "name", "treated"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("invalid fields = %v, want %v", fields, want)
+	}
+}
+
+func TestPatchCompany(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{
+		Name:     "Acme",
+		Address:  "1 Main St",
+		Source:   "crm",
+		Metadata: map[string]interface{}{"region": "us", "phone": "555-0100"},
+	})
+
+	patch, err := ParseMergePatch([]byte(`{"address":"2 Main St","source":null,"metadata":{"phone":null,"staff":12}}`))
+	if err != nil {
+		t.Fatalf("ParseMergePatch failed: %v", err)
+	}
+	company, err := bp.PatchCompany(ctx, "Acme", patch)
+	if err != nil {
+		t.Fatalf("PatchCompany failed: %v", err)
+	}
+	if company.Address != "2 Main St" || company.Source != "" {
+		t.Errorf("company = %+v, want address replaced and source removed", company)
+	}
+	want := map[string]interface{}{"region": "us", "staff": int64(12)}
+	if !reflect.DeepEqual(company.Metadata, want) {
+		t.Errorf("metadata = %#v, want %#v", company.Metadata, want)
+	}
+
+	if _, err := bp.PatchCompany(ctx, "Globex", patch); !errors.Is(err, ErrCompanyNotFound) {
+		t.Errorf("patching a missing company = %v, want ErrCompanyNotFound", err)
+	}
+}
+
+func TestMergePatchWithAddress(t *testing.T) {
+	patch := MergePatch{Set: bson.M{"address": "  12 HIGH st ", "treated": true}}
+	got := patch.withAddress(AddressTitleCase, true)
+	want := bson.M{"address": "12 High St", "addressRaw": "  12 HIGH st ", "treated": true}
+	if !reflect.DeepEqual(got.Set, want) {
+		t.Errorf("Set = %v, want %v", got.Set, want)
+	}
+	if patch.Set["address"] != "  12 HIGH st " {
+		t.Errorf("withAddress changed the original patch: %v", patch.Set)
+	}
+
+	if got := patch.withAddress(AddressWhitespace, false); !reflect.DeepEqual(got.Set, bson.M{"address": "12 HIGH st", "treated": true}) {
+		t.Errorf("Set without raw addresses = %v, want only the normalized address", got.Set)
+	}
+
+	removal := MergePatch{Set: bson.M{}, Unset: []string{"address"}}
+	if got := removal.withAddress(AddressWhitespace, true); !reflect.DeepEqual(got.Unset, []string{"address", "addressRaw"}) {
+		t.Errorf("Unset = %v, want the raw address removed with the address", got.Unset)
+	}
+	if got := removal.withAddress(AddressWhitespace, false); !reflect.DeepEqual(got.Unset, []string{"address"}) {
+		t.Errorf("Unset without raw addresses = %v, want [address]", got.Unset)
+	}
+}
+
+func TestPatchCompanyNormalizesAddress(t *testing.T) {
+	bp := newTestProcessor(t, WithAddressNormalization(AddressTitleCase), WithRawAddress(true))
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St"})
+
+	company, err := bp.PatchCompany(ctx, "Acme", MergePatch{Set: bson.M{"address": "2  main ST"}})
+	if err != nil {
+		t.Fatalf("PatchCompany failed: %v", err)
+	}
+	if company.Address != "2 Main St" || company.AddressRaw != "2  main ST" {
+		t.Errorf("address = %q, raw %q; want normalized 2 Main St and the raw address", company.Address, company.AddressRaw)
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// CompaniesByNameLength returns up to limit companies whose name is between
+// minLength and maxLength characters long, inclusive, for spotting
+// truncated or run-together names. maxLength 0 means no upper bound. Length counts Unicode code
+// points ($strLenCP), not bytes. Companies are sorted by name length,
+// shortest first or, with longest, longest first, then by name. The length
+// is computed per document, so every query scans the whole collection.
+func (bp *BatchProcessor) CompaniesByNameLength(ctx context.Context, minLength, maxLength int, longest bool, limit int) (_ []Company, err error) {
+	defer recoverPanic("CompaniesByNameLength", &err)
+	if minLength < 0 || maxLength < 0 || (maxLength > 0 && minLength > maxLength) {
+		return nil, fmt.Errorf("invalid name length range %d to %d", minLength, maxLength)
+	}
+
+	length := bson.M{"$gte": minLength}
+	if maxLength > 0 {
+		length["$lte"] = maxLength
+	}
+	order := 1
+	if longest {
+		order = -1
+	}
+	pipeline := bson.A{
+		bson.M{"$addFields": bson.M{"nameLength": bson.M{"$strLenCP": "$name"}}},
+		bson.M{"$match": live(bson.M{"nameLength": length})},
+		bson.M{"$sort": bson.D{{Key: "nameLength", Value: order}, {Key: "name", Value: 1}}},
+		bson.M{"$limit": limit},
+		bson.M{"$project": bson.M{"nameLength": 0}},
+	}
+	cursor, err := bp.readCollection(ctx).Aggregate(ctx, pipeline, aggregateOptions(ctx).SetCollation(bp.nameCollation))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch companies by name length: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	return decodeCompanies(ctx, cursor, "CompaniesByNameLength")
+}
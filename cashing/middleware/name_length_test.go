@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestCompaniesByNameLength(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp,
+		Company{Name: "X"},
+		Company{Name: "IB"},
+		Company{Name: "Açé"},
+		Company{Name: "Acme"},
+		Company{Name: "Globex Corporation"},
+		Company{Name: "Ab"},
+	)
+	softDelete(t, bp, "Ab")
+
+	tests := []struct {
+		name     string
+		min, max int
+		longest  bool
+		limit    int
+		want     []string
+	}{
+		{"short names", 1, 2, false, 10, []string{"X", "IB"}},
+		{"code points, not bytes", 3, 3, false, 10, []string{"Açé"}},
+		{"no upper bound", 4, 0, false, 10, []string{"Acme", "Globex Corporation"}},
+		{"longest first", 0, 0, true, 2, []string{"Globex Corporation", "Acme"}},
+		{"nothing in range", 5, 10, false, 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			companies, err := bp.CompaniesByNameLength(ctx, tt.min, tt.max, tt.longest, tt.limit)
+			if err != nil {
+				t.Fatalf("CompaniesByNameLength failed: %v", err)
+			}
+			if got := companyNames(companies); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("CompaniesByNameLength(%d, %d) = %v, want %v", tt.min, tt.max, got, tt.want)
+			}
+		})
+	}
+
+	for _, bounds := range [][2]int{{-1, 2}, {0, -1}, {3, 2}} {
+		if _, err := bp.CompaniesByNameLength(ctx, bounds[0], bounds[1], false, 10); err == nil {
+			t.Errorf("CompaniesByNameLength(%d, %d) should fail", bounds[0], bounds[1])
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Option customizes how NewBatchProcessor configures the MongoDB client
+type Option func(*processorOptions)
+
+// processorOptions collects the settings applied by Options
+type processorOptions struct {
+	retryWrites bool
+	retryReads  bool
+	appName     string
+	// settableFields restricts what upserts write; empty means all
+	settableFields []string
+	batchLogLevel  slog.Level
+	countSeen      bool
+	listCacheTTL   time.Duration
+	// compressListCache stores the cached list gzipped
+	compressListCache bool
+	indexBuildMode    IndexBuildMode
+	// indexRaceRetries is how often a conflicting index build is retried
+	indexRaceRetries int
+	nameCollation    *options.Collation
+	// transientRetries is how often a write or read failing with a
+	// transient error is retried
+	transientRetries int
+	// addressNormalization and rawAddress control how addresses are stored
+	addressNormalization AddressNormalization
+	rawAddress           bool
+}
+
+// defaultProcessorOptions returns the settings used when no Option is given
+func defaultProcessorOptions() processorOptions {
+	return processorOptions{
+		retryWrites:          true,
+		retryReads:           true,
+		appName:              "company-api",
+		batchLogLevel:        slog.LevelInfo,
+		indexBuildMode:       IndexBuildBackground,
+		indexRaceRetries:     3,
+		transientRetries:     2,
+		addressNormalization: AddressVerbatim,
+	}
+}
+
+// WithRetryableWrites enables or disables the driver's retryable writes
+// (default on). The driver retries a write once after a network error or
+// failover, and the server recognises the retry so the write is applied at
+// most once. Application-level retries layered on top have no such guarantee
+// and must be limited to idempotent operations such as our name-keyed upserts.
+func WithRetryableWrites(enabled bool) Option {
+	return func(o *processorOptions) {
+		o.retryWrites = enabled
+	}
+}
+
+// WithRetryableReads enables or disables the driver's retryable reads
+// (default on)
+func WithRetryableReads(enabled bool) Option {
+	return func(o *processorOptions) {
+		o.retryReads = enabled
+	}
+}
+
+// WithAppName sets the application name the client reports to the server, so
+// our operations can be identified in currentOp and the server logs
+// (default "company-api")
+func WithAppName(name string) Option {
+	return func(o *processorOptions) {
+		o.appName = name
+	}
+}
+
+// WithSettableFields restricts batch and bulk upserts to writing the name and
+// the given fields from SettableFields; any other input is ignored.
+// NewBatchProcessor fails if a field is not settable.
+func WithSettableFields(fields ...string) Option {
+	return func(o *processorOptions) {
+		o.settableFields = fields
+	}
+}
+
+// WithBatchLogLevel sets the level of the log line written for every chunk of
+// a batch (default info). Raising the logger's level above it silences the
+// line; batch results are still returned and recorded in the import log.
+func WithBatchLogLevel(level slog.Level) Option {
+	return func(o *processorOptions) {
+		o.batchLogLevel = level
+	}
+}
+
+// WithSeenCounter enables or disables bumping each company's seen counter on
+// every upsert (default off). With it on, re-uploading identical data still
+// modifies the document, so BatchResult.Unchanged stays zero.
+func WithSeenCounter(enabled bool) Option {
+	return func(o *processorOptions) {
+		o.countSeen = enabled
+	}
+}
+
+// WithListCacheTTL caches the full company list for ttl (default 0, no
+// caching). Writes through the BatchProcessor invalidate the cache, but
+// writes by other instances or clients are only seen once it expires.
+func WithListCacheTTL(ttl time.Duration) Option {
+	return func(o *processorOptions) {
+		o.listCacheTTL = ttl
+	}
+}
+
+// WithListCacheCompression keeps the cached company list gzipped in memory
+// instead of as decoded companies (default off). This trades CPU on every
+// cache hit, which decodes a fresh copy, for a much smaller footprint when the
+// list is large; small deployments are better off without it.
+func WithListCacheCompression(enabled bool) Option {
+	return func(o *processorOptions) {
+		o.compressListCache = enabled
+	}
+}
+
+// WithIndexBuildMode sets how indexes are built at startup (default
+// IndexBuildBackground). Foreground builds suit CI, where a deterministic,
+// fully built index matters more than blocking a small collection.
+func WithIndexBuildMode(mode IndexBuildMode) Option {
+	return func(o *processorOptions) {
+		o.indexBuildMode = mode
+	}
+}
+
+// WithIndexRaceRetries sets how many times an index build that conflicts with
+// a concurrent build of the same index, as when several replicas start against
+// a fresh collection, is retried (default 3). Once the retries run out the
+// build is accepted if the index is present. 0 skips straight to that check.
+func WithIndexRaceRetries(retries int) Option {
+	return func(o *processorOptions) {
+		o.indexRaceRetries = retries
+	}
+}
+
+// WithTransientRetries sets how many times a chunk write or company read
+// that fails with a transient error, such as "connection pool was cleared"
+// during a failover, is retried (default 2) on top of the driver's own single
+// retry. Only pool errors, which mean the operation was never sent, are
+// retried in insert mode, where a repeated insert is not idempotent.
+func WithTransientRetries(retries int) Option {
+	return func(o *processorOptions) {
+		o.transientRetries = retries
+	}
+}
+
+// WithAddressNormalization normalizes addresses before upserts write them
+// (default AddressVerbatim, which stores them as received). Re-uploading an
+// address that differs only in spacing or case then leaves the stored
+// address unchanged.
+func WithAddressNormalization(mode AddressNormalization) Option {
+	return func(o *processorOptions) {
+		o.addressNormalization = mode
+	}
+}
+
+// WithRawAddress also stores each written address as received, in
+// addressRaw, so normalization can be audited or undone (default off)
+func WithRawAddress(enabled bool) Option {
+	return func(o *processorOptions) {
+		o.rawAddress = enabled
+	}
+}
+
+// WithNameCollation builds the unique name index with a collation of the
+// given locale and strength (1-5; 2 compares case-insensitively) and applies
+// it to every upsert and lookup by name. MongoDB only uses an index for a
+// query whose collation matches the index's, so the two must agree or each
+// lookup silently falls back to a collection scan. Matching and uniqueness
+// follow the collation: at strength 2, uploading "ACME" updates a stored
+// "acme". An existing name index built without the collation must be
+// dropped first, or the index build fails at startup. Without this option
+// names use simple binary comparison.
+func WithNameCollation(locale string, strength int) Option {
+	return func(o *processorOptions) {
+		o.nameCollation = &options.Collation{Locale: locale, Strength: strength}
+	}
+}
+
+// MaxPoolSize is the connection pool size of a processor with numWorkers
+// workers
+func MaxPoolSize(numWorkers int) int {
+	return numWorkers * 2
+}
+
+// newClientOptions builds the MongoDB client configuration
+func newClientOptions(uri string, numWorkers int, settings processorOptions) *options.ClientOptions {
+	// Configure MongoDB client with proper options
+	return options.Client().
+		ApplyURI(uri).
+		SetConnectTimeout(5 * time.Second).
+		SetServerSelectionTimeout(5 * time.Second).
+		SetMaxPoolSize(uint64(MaxPoolSize(numWorkers))).
+		SetRetryWrites(settings.retryWrites).
+		SetRetryReads(settings.retryReads).
+		SetAppName(settings.appName)
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import "testing"
+
+func TestNewClientOptionsRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []Option
+		writes, reads bool
+	}{
+		{"defaults", nil, true, true},
+		{"writes off", []Option{WithRetryableWrites(false)}, false, true},
+		{"both off", []Option{WithRetryableWrites(false), WithRetryableReads(false)}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := defaultProcessorOptions()
+			for _, opt := range tt.opts {
+				opt(&settings)
+			}
+			client := newClientOptions("mongodb://localhost:27017", 4, settings)
+			if client.RetryWrites == nil || *client.RetryWrites != tt.writes {
+				t.Errorf("RetryWrites = %v, want %v", client.RetryWrites, tt.writes)
+			}
+			if client.RetryReads == nil || *client.RetryReads != tt.reads {
+				t.Errorf("RetryReads = %v, want %v", client.RetryReads, tt.reads)
+			}
+		})
+	}
+}
+
+func TestNewClientOptionsAppName(t *testing.T) {
+	settings := defaultProcessorOptions()
+	if client := newClientOptions("mongodb://localhost:27017", 4, settings); client.AppName == nil || *client.AppName != "company-api" {
+		t.Errorf("default AppName = %v, want company-api", client.AppName)
+	}
+	WithAppName("importer-eu")(&settings)
+	if client := newClientOptions("mongodb://localhost:27017", 4, settings); client.AppName == nil || *client.AppName != "importer-eu" {
+		t.Errorf("AppName = %v, want importer-eu", client.AppName)
+	}
+}
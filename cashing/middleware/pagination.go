@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is one page of companies in name order. NextCursor, when HasMore is
+// set, fetches the following page.
+type Page struct {
+	Companies  []Company `json:"companies"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	HasMore    bool      `json:"has_more"`
+}
+
+// encodeCursor turns the last name on a page into an opaque cursor
+func encodeCursor(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+// decodeCursor recovers the name a cursor was built from
+func decodeCursor(cursor string) (string, error) {
+	name, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return string(name), nil
+}
+
+// FetchCompaniesPage returns up to limit companies, sorted by name, starting
+// after the given cursor (empty for the first page)
+func (bp *BatchProcessor) FetchCompaniesPage(ctx context.Context, limit int, cursor string) (*Page, error) {
+	return bp.findPage(ctx, bson.M{}, limit, cursor)
+}
+
+// SearchCompaniesByName returns a page of companies whose name contains query,
+// case-insensitively, paginated like FetchCompaniesPage
+func (bp *BatchProcessor) SearchCompaniesByName(ctx context.Context, query string, limit int, cursor string) (*Page, error) {
+	return bp.findPage(ctx, nameSearchFilter(query), limit, cursor)
+}
+
+// CompaniesChangedBetween returns a page of companies whose updatedAt falls
+// within [from, to], paginated by name like FetchCompaniesPage
+func (bp *BatchProcessor) CompaniesChangedBetween(ctx context.Context, from, to time.Time, limit int, after string) (*Page, error) {
+	if from.After(to) {
+		return nil, fmt.Errorf("from (%s) is after to (%s)", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	filter := bson.M{"updatedAt": bson.M{"$gte": from, "$lte": to}}
+	return bp.findPage(ctx, filter, limit, after)
+}
+
+// CompaniesCreatedBefore returns a page of companies created before cutoff,
+// paginated by name like FetchCompaniesPage, for archival jobs. Companies
+// without a createdAt are not included.
+func (bp *BatchProcessor) CompaniesCreatedBefore(ctx context.Context, cutoff time.Time, limit int, after string) (*Page, error) {
+	filter := bson.M{"createdAt": bson.M{"$lt": cutoff}}
+	return bp.findPage(ctx, filter, limit, after)
+}
+
+// CompaniesMissingAddress returns a page of companies whose address is empty,
+// null or absent, paginated by name like FetchCompaniesPage
+func (bp *BatchProcessor) CompaniesMissingAddress(ctx context.Context, limit int, after string) (*Page, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"address": ""},
+		// Also matches documents without the field
+		bson.M{"address": nil},
+	}}
+	return bp.findPage(ctx, filter, limit, after)
+}
+
+// RecentCompanies returns the limit most recently created companies, newest
+// first
+func (bp *BatchProcessor) RecentCompanies(ctx context.Context, limit int) ([]Company, error) {
+	return bp.findLatest(ctx, "createdAt", bson.M{"createdAt": bson.M{"$exists": true}}, limit)
+}
+
+// RecentlyTreatedCompanies returns the limit treated companies that were most
+// recently marked treated, newest first
+func (bp *BatchProcessor) RecentlyTreatedCompanies(ctx context.Context, limit int) ([]Company, error) {
+	filter := bson.M{"treated": true, "treatedAt": bson.M{"$exists": true}}
+	return bp.findLatest(ctx, "treatedAt", filter, limit)
+}
+
+// findLatest returns up to limit companies matching filter, sorted by the
+// timestamp field newest first
+func (bp *BatchProcessor) findLatest(ctx context.Context, field string, filter bson.M, limit int) (_ []Company, err error) {
+	defer recoverPanic("findLatest", &err)
+	if err := CheckField(field, FieldSortable); err != nil {
+		return nil, err
+	}
+
+	opts := findOptions(ctx).
+		SetSort(bson.D{{Key: field, Value: -1}, {Key: "name", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetCollation(bp.nameCollation)
+
+	cur, err := bp.readCollection(ctx).Find(ctx, live(filter), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch recent companies: %v", err)
+	}
+	defer cur.Close(ctx)
+
+	return decodeCompanies(ctx, cur, "findLatest")
+}
+
+// CompaniesByNamePrefix returns up to limit companies whose name starts with
+// prefix, in name order, for autocomplete. Names are compared as the name
+// index compares them: case-sensitively without a name collation, and under
+// the collation, e.g. case-insensitively, with one.
+func (bp *BatchProcessor) CompaniesByNamePrefix(ctx context.Context, prefix string, limit int) (_ []Company, err error) {
+	defer recoverPanic("CompaniesByNamePrefix", &err)
+	if prefix == "" {
+		return nil, fmt.Errorf("prefix must not be empty")
+	}
+
+	filter := namePrefixFilter(prefix, bp.nameCollation)
+	opts := findOptions(ctx).
+		SetSort(bson.D{{Key: "name", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetCollation(bp.nameCollation)
+
+	cur, err := bp.readCollection(ctx).Find(ctx, live(filter), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch companies by prefix: %v", err)
+	}
+	defer cur.Close(ctx)
+
+	return decodeCompanies(ctx, cur, "CompaniesByNamePrefix")
+}
+
+// collationMax sorts after every other string under a collation: CLDR gives
+// U+FFFF the highest primary weight so it can bound prefix ranges
+const collationMax = "\uffff"
+
+// namePrefixFilter matches names starting with prefix. A regex cannot use a
+// collated index and compares bytes rather than collation keys, so under a
+// collation the prefix becomes a range query, which the collated name index
+// answers by scanning only the matching keys. Without one the name index is
+// a plain one and an escaped, anchored regex is bounded by it as well.
+func namePrefixFilter(prefix string, collation *options.Collation) bson.M {
+	if collation != nil {
+		return bson.M{"name": bson.M{"$gte": prefix, "$lt": prefix + collationMax}}
+	}
+	return bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}
+}
+
+// CountCompanies counts the companies whose name contains query, or all
+// companies when query is empty
+func (bp *BatchProcessor) CountCompanies(ctx context.Context, query string) (_ int64, err error) {
+	defer recoverPanic("CountCompanies", &err)
+	filter := bson.M{}
+	if query != "" {
+		filter = nameSearchFilter(query)
+	}
+	count, err := bp.readCollection(ctx).CountDocuments(ctx, live(filter))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count companies: %v", err)
+	}
+	return count, nil
+}
+
+// nameSearchFilter matches names containing query, case-insensitively
+func nameSearchFilter(query string) bson.M {
+	return bson.M{"name": bson.M{
+		"$regex":   regexp.QuoteMeta(query),
+		"$options": "i",
+	}}
+}
+
+// findPage runs a name-ordered, keyset-paginated Find. It reads one extra
+// document to tell whether another page follows. The sort and the cursor
+// comparison both use the name collation, so pages follow the name index's
+// order and a cursor never skips or repeats a name that differs only in case.
+func (bp *BatchProcessor) findPage(ctx context.Context, filter bson.M, limit int, cursor string) (_ *Page, err error) {
+	defer recoverPanic("findPage", &err)
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter = bson.M{"$and": bson.A{filter, bson.M{"name": bson.M{"$gt": after}}}}
+	}
+
+	opts := findOptions(ctx).
+		SetSort(bson.D{{Key: "name", Value: 1}}).
+		SetLimit(int64(limit) + 1).
+		SetCollation(bp.nameCollation)
+
+	cur, err := bp.readCollection(ctx).Find(ctx, live(filter), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch companies: %v", err)
+	}
+	defer cur.Close(ctx)
+
+	return decodePage(ctx, cur, "findPage", limit, func(doc bson.Raw) (string, bool) {
+		name, ok := doc.Lookup("name").StringValueOK()
+		return encodeCursor(name), ok
+	})
+}
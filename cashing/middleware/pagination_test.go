@@ -0,0 +1,302 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, name := range []string{"Acme", "Café/Bar & Co", ""} {
+		got, err := decodeCursor(encodeCursor(name))
+		if err != nil || got != name {
+			t.Errorf("decodeCursor(encodeCursor(%q)) = %q, %v", name, got, err)
+		}
+	}
+	if _, err := decodeCursor("not base64!"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("decodeCursor of garbage = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestFetchCompaniesPage(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp,
+		Company{Name: "Echo"}, Company{Name: "Alpha"}, Company{Name: "Delta"},
+		Company{Name: "Bravo"}, Company{Name: "Charlie"})
+
+	var names []string
+	cursor := ""
+	for pages := 1; ; pages++ {
+		page, err := bp.FetchCompaniesPage(ctx, 2, cursor)
+		if err != nil {
+			t.Fatalf("FetchCompaniesPage failed: %v", err)
+		}
+		names = append(names, companyNames(page.Companies)...)
+		if !page.HasMore {
+			if pages != 3 {
+				t.Errorf("got %d pages, want 3", pages)
+			}
+			break
+		}
+		cursor = page.NextCursor
+	}
+	want := []string{"Alpha", "Bravo", "Charlie", "Delta", "Echo"}
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	if _, err := bp.FetchCompaniesPage(ctx, 2, "%%%"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("FetchCompaniesPage with a bad cursor = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestSearchCompaniesByName(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme (Europe)"}, Company{Name: "ACME Inc"}, Company{Name: "Globex"})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"acme", []string{"ACME Inc", "Acme (Europe)"}},
+		{"(europe)", []string{"Acme (Europe)"}},
+		{".*", nil},
+	}
+	for _, tt := range tests {
+		page, err := bp.SearchCompaniesByName(ctx, tt.query, 10, "")
+		if err != nil {
+			t.Fatalf("SearchCompaniesByName(%q) failed: %v", tt.query, err)
+		}
+		if got := companyNames(page.Companies); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("SearchCompaniesByName(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCountCompanies(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"}, Company{Name: "Acme Europe"}, Company{Name: "Globex"})
+
+	for query, want := range map[string]int64{"": 3, "acme": 2, "initech": 0} {
+		got, err := bp.CountCompanies(ctx, query)
+		if err != nil {
+			t.Fatalf("CountCompanies(%q) failed: %v", query, err)
+		}
+		if got != want {
+			t.Errorf("CountCompanies(%q) = %d, want %d", query, got, want)
+		}
+	}
+}
+
+func TestCompaniesChangedBetween(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"})
+	between := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	seedCompanies(t, bp, Company{Name: "Globex"})
+
+	page, err := bp.CompaniesChangedBetween(ctx, between, time.Now().Add(time.Minute), 10, "")
+	if err != nil {
+		t.Fatalf("CompaniesChangedBetween failed: %v", err)
+	}
+	if got := companyNames(page.Companies); len(got) != 1 || got[0] != "Globex" {
+		t.Errorf("changed companies = %v, want [Globex]", got)
+	}
+	company := page.Companies[0]
+	if company.CreatedAt.IsZero() || company.UpdatedAt.Before(company.CreatedAt) {
+		t.Errorf("timestamps = created %v, updated %v", company.CreatedAt, company.UpdatedAt)
+	}
+
+	if _, err := bp.CompaniesChangedBetween(ctx, time.Now(), between, 10, ""); err == nil {
+		t.Error("CompaniesChangedBetween should reject from after to")
+	}
+}
+
+func TestRecentCompanies(t *testing.T) {
+	bp := newTestProcessor(t)
+	for _, name := range []string{"Acme", "Globex", "Initech"} {
+		seedCompanies(t, bp, Company{Name: name})
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	recent, err := bp.RecentCompanies(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("RecentCompanies failed: %v", err)
+	}
+	want := []string{"Initech", "Globex"}
+	if got := companyNames(recent); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("RecentCompanies = %v, want %v", got, want)
+	}
+}
+
+func TestRecentlyTreatedCompanies(t *testing.T) {
+	bp := newTestProcessor(t)
+	seedCompanies(t, bp, Company{Name: "Acme"}, Company{Name: "Globex"}, Company{Name: "Initech"})
+	for _, name := range []string{"Initech", "Acme"} {
+		seedCompanies(t, bp, Company{Name: name, Treated: true})
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	recent, err := bp.RecentlyTreatedCompanies(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("RecentlyTreatedCompanies failed: %v", err)
+	}
+	want := []string{"Acme", "Initech"}
+	if got := companyNames(recent); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("RecentlyTreatedCompanies = %v, want %v", got, want)
+	}
+}
+
+func TestCompaniesMissingAddress(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme", Address: "1 Main St"}, Company{Name: "Globex"}, Company{Name: "Initech"})
+	if _, err := bp.collection.InsertOne(ctx, bson.M{"name": "Hooli", "address": nil}); err != nil {
+		t.Fatalf("InsertOne failed: %v", err)
+	}
+	if _, err := bp.collection.InsertOne(ctx, bson.M{"name": "Umbrella"}); err != nil {
+		t.Fatalf("InsertOne failed: %v", err)
+	}
+
+	var names []string
+	cursor := ""
+	for {
+		page, err := bp.CompaniesMissingAddress(ctx, 2, cursor)
+		if err != nil {
+			t.Fatalf("CompaniesMissingAddress failed: %v", err)
+		}
+		names = append(names, companyNames(page.Companies)...)
+		if !page.HasMore {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	want := []string{"Globex", "Hooli", "Initech", "Umbrella"}
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
+
+func TestCompaniesCreatedBefore(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Globex"}, Company{Name: "Acme"}, Company{Name: "Initech"})
+	if _, err := bp.collection.InsertOne(ctx, bson.M{"name": "Hooli"}); err != nil {
+		t.Fatalf("InsertOne failed: %v", err)
+	}
+	// Backdate rather than sleep, so the server's clock does not matter
+	cutoff := time.Now().Add(-time.Hour)
+	_, err := bp.collection.UpdateMany(ctx, bson.M{"name": bson.M{"$in": bson.A{"Acme", "Globex"}}},
+		bson.M{"$set": bson.M{"createdAt": cutoff.Add(-time.Hour)}})
+	if err != nil {
+		t.Fatalf("failed to backdate companies: %v", err)
+	}
+
+	page, err := bp.CompaniesCreatedBefore(ctx, cutoff, 10, "")
+	if err != nil {
+		t.Fatalf("CompaniesCreatedBefore failed: %v", err)
+	}
+	if got := companyNames(page.Companies); fmt.Sprint(got) != "[Acme Globex]" {
+		t.Errorf("CompaniesCreatedBefore = %v, want [Acme Globex]", got)
+	}
+}
+
+func TestCompaniesByNamePrefix(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp,
+		Company{Name: "Acme Corp"},
+		Company{Name: "Acme"},
+		Company{Name: "acme labs"},
+		Company{Name: "Ac.me"},
+		Company{Name: "Big Acme"},
+		Company{Name: "Globex"},
+	)
+
+	tests := []struct {
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{"Acme", 10, []string{"Acme", "Acme Corp"}},
+		{"Acme", 1, []string{"Acme"}},
+		{"Ac.", 10, []string{"Ac.me"}},
+		{".*", 10, nil},
+	}
+	for _, tt := range tests {
+		companies, err := bp.CompaniesByNamePrefix(ctx, tt.prefix, tt.limit)
+		if err != nil {
+			t.Fatalf("CompaniesByNamePrefix(%q) failed: %v", tt.prefix, err)
+		}
+		if got := companyNames(companies); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("CompaniesByNamePrefix(%q, %d) = %v, want %v", tt.prefix, tt.limit, got, tt.want)
+		}
+	}
+
+	if _, err := bp.CompaniesByNamePrefix(ctx, "", 10); err == nil {
+		t.Error("CompaniesByNamePrefix with an empty prefix should fail")
+	}
+}
+
+func TestNamePrefixFilter(t *testing.T) {
+	if got := fmt.Sprint(namePrefixFilter("Ac.", nil)); got != `map[name:map[$regex:^Ac\.]]` {
+		t.Errorf("filter without a collation = %s, want an escaped, anchored regex", got)
+	}
+	collation := &options.Collation{Locale: "en", Strength: 2}
+	filter := namePrefixFilter("Ac.", collation)["name"].(bson.M)
+	if filter["$gte"] != "Ac." || filter["$lt"] != "Ac.\uffff" {
+		t.Errorf("filter under a collation = %v, want the range [Ac., Ac.\uffff)", filter)
+	}
+}
+
+func TestCompaniesByNamePrefixCollation(t *testing.T) {
+	bp := newTestProcessor(t, WithNameCollation("en", 2))
+	ctx := context.Background()
+	seedCompanies(t, bp,
+		Company{Name: "Acme Corp"},
+		Company{Name: "acme labs"},
+		Company{Name: "Big Acme"},
+		Company{Name: "Globex"},
+	)
+
+	companies, err := bp.CompaniesByNamePrefix(ctx, "ACME", 10)
+	if err != nil {
+		t.Fatalf("CompaniesByNamePrefix failed: %v", err)
+	}
+	if got := companyNames(companies); fmt.Sprint(got) != "[Acme Corp acme labs]" {
+		t.Errorf("CompaniesByNamePrefix(ACME) = %v, want [Acme Corp acme labs] in collation order", got)
+	}
+}
+
+func TestFetchCompaniesPageCollation(t *testing.T) {
+	bp := newTestProcessor(t, WithNameCollation("en", 2))
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Banana"}, Company{Name: "apple"}, Company{Name: "cherry"})
+
+	var got []string
+	cursor := ""
+	for {
+		page, err := bp.FetchCompaniesPage(ctx, 1, cursor)
+		if err != nil {
+			t.Fatalf("FetchCompaniesPage failed: %v", err)
+		}
+		got = append(got, companyNames(page.Companies)...)
+		if !page.HasMore {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	// Binary order would put "Banana" first
+	if fmt.Sprint(got) != "[apple Banana cherry]" {
+		t.Errorf("pages = %v, want [apple Banana cherry] in collation order", got)
+	}
+}
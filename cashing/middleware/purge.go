@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PurgeDeleted permanently removes companies marked deleted (deleted: true)
+// whose deletedAt is before olderThan, returning how many were removed
+func (bp *BatchProcessor) PurgeDeleted(ctx context.Context, olderThan time.Time) (_ int64, err error) {
+	defer recoverPanic("PurgeDeleted", &err)
+	defer bp.cache.invalidate()
+
+	result, err := bp.baseCollection(ctx).DeleteMany(ctx, bson.M{
+		"deleted":   true,
+		"deletedAt": bson.M{"$lt": olderThan},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted companies: %v", err)
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPurgeDeleted(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"}, Company{Name: "Globex"}, Company{Name: "Initech"})
+	softDelete(t, bp, "Globex")
+	cutoff := time.Now().Add(time.Second)
+	softDelete(t, bp, "Initech")
+	// Initech was deleted after the cutoff
+	if _, err := bp.collection.UpdateOne(ctx, bson.M{"name": "Initech"},
+		bson.M{"$set": bson.M{"deletedAt": cutoff.Add(time.Hour)}}); err != nil {
+		t.Fatalf("failed to move deletedAt: %v", err)
+	}
+
+	purged, err := bp.PurgeDeleted(ctx, cutoff)
+	if err != nil {
+		t.Fatalf("PurgeDeleted failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("purged %d companies, want 1", purged)
+	}
+
+	cur, err := bp.collection.Find(ctx, bson.M{})
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	var companies []Company
+	if err := cur.All(ctx, &companies); err != nil {
+		t.Fatalf("failed to decode companies: %v", err)
+	}
+	remaining := companyNames(companies)
+	if len(remaining) != 2 || slices.Contains(remaining, "Globex") {
+		t.Errorf("remaining = %v, want Acme and the recently deleted Initech", remaining)
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// readOptionsKey is the context key for per-request read overrides
+type readOptionsKey struct{}
+
+// readOptions holds per-request overrides applied to reads
+type readOptions struct {
+	concern    *readconcern.ReadConcern
+	preference *readpref.ReadPref
+}
+
+// readConcerns lists the read concern levels a request may ask for
+var readConcerns = map[string]*readconcern.ReadConcern{
+	"local":     readconcern.Local(),
+	"available": readconcern.Available(),
+	"majority":  readconcern.Majority(),
+}
+
+// WithReadConcern returns a context whose reads use the named read concern
+// level instead of the collection default
+func WithReadConcern(ctx context.Context, level string) (context.Context, error) {
+	concern, ok := readConcerns[strings.ToLower(level)]
+	if !ok {
+		return ctx, fmt.Errorf("unsupported read concern %q (want local, available or majority)", level)
+	}
+	overrides := readOptionsFrom(ctx)
+	overrides.concern = concern
+	return context.WithValue(ctx, readOptionsKey{}, overrides), nil
+}
+
+// readPreferences lists the read preferences a request may ask for
+var readPreferences = map[string]*readpref.ReadPref{
+	"primary":            readpref.Primary(),
+	"primarypreferred":   readpref.PrimaryPreferred(),
+	"secondary":          readpref.Secondary(),
+	"secondarypreferred": readpref.SecondaryPreferred(),
+	"nearest":            readpref.Nearest(),
+}
+
+// WithReadPreference returns a context whose reads are routed by the named
+// read preference mode instead of the client default (primary). Reads from a
+// secondary keep load off the primary but may lag it by the replication
+// delay, so recent writes can be missing; pair with a read concern if that
+// matters. Writes always go to the primary.
+func WithReadPreference(ctx context.Context, mode string) (context.Context, error) {
+	preference, ok := readPreferences[strings.ToLower(mode)]
+	if !ok {
+		return ctx, fmt.Errorf("unsupported read preference %q (want primary, primaryPreferred, secondary, secondaryPreferred or nearest)", mode)
+	}
+	overrides := readOptionsFrom(ctx)
+	overrides.preference = preference
+	return context.WithValue(ctx, readOptionsKey{}, overrides), nil
+}
+
+// readOptionsFrom returns the read overrides carried by ctx, if any
+func readOptionsFrom(ctx context.Context) readOptions {
+	overrides, _ := ctx.Value(readOptionsKey{}).(readOptions)
+	return overrides
+}
+
+// readCollection returns the collection to read from for this request: the
+// request's tenant collection, with any read overrides carried by ctx
+func (bp *BatchProcessor) readCollection(ctx context.Context) *mongo.Collection {
+	base := bp.baseCollection(ctx)
+	overrides := readOptionsFrom(ctx)
+	if overrides.concern == nil && overrides.preference == nil {
+		return base
+	}
+	opts := options.Collection()
+	if overrides.concern != nil {
+		opts.SetReadConcern(overrides.concern)
+	}
+	if overrides.preference != nil {
+		opts.SetReadPreference(overrides.preference)
+	}
+	coll, err := base.Clone(opts)
+	if err != nil {
+		return base
+	}
+	return coll
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestWithReadConcern(t *testing.T) {
+	tests := []struct {
+		level string
+		want  *readconcern.ReadConcern
+	}{
+		{"majority", readconcern.Majority()},
+		{"LOCAL", readconcern.Local()},
+		{"available", readconcern.Available()},
+		{"linearizable", nil},
+	}
+	for _, tt := range tests {
+		ctx, err := WithReadConcern(context.Background(), tt.level)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("WithReadConcern(%q) should fail", tt.level)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("WithReadConcern(%q) failed: %v", tt.level, err)
+		}
+		if got := readOptionsFrom(ctx).concern; got.Level != tt.want.Level {
+			t.Errorf("WithReadConcern(%q) level = %q, want %q", tt.level, got.Level, tt.want.Level)
+		}
+	}
+}
+
+func TestReadWithConcern(t *testing.T) {
+	bp := newTestProcessor(t)
+	seedCompanies(t, bp, Company{Name: "Acme"})
+
+	ctx, err := WithReadConcern(context.Background(), "majority")
+	if err != nil {
+		t.Fatalf("WithReadConcern failed: %v", err)
+	}
+	exists, err := bp.CompanyExists(ctx, "Acme")
+	if err != nil || !exists {
+		t.Errorf("CompanyExists with majority read concern = %v, %v; want true", exists, err)
+	}
+}
+
+func TestWithReadPreference(t *testing.T) {
+	tests := []struct {
+		mode  string
+		want  readpref.Mode
+		valid bool
+	}{
+		{"secondaryPreferred", readpref.SecondaryPreferredMode, true},
+		{"NEAREST", readpref.NearestMode, true},
+		{"primary", readpref.PrimaryMode, true},
+		{"closest", 0, false},
+	}
+	for _, tt := range tests {
+		ctx, err := WithReadPreference(context.Background(), tt.mode)
+		if (err == nil) != tt.valid {
+			t.Errorf("WithReadPreference(%q) error = %v, want valid %v", tt.mode, err, tt.valid)
+			continue
+		}
+		if tt.valid && readOptionsFrom(ctx).preference.Mode() != tt.want {
+			t.Errorf("WithReadPreference(%q) mode = %v, want %v", tt.mode, readOptionsFrom(ctx).preference.Mode(), tt.want)
+		}
+	}
+}
+
+func TestReadOverridesCombine(t *testing.T) {
+	ctx, err := WithReadConcern(context.Background(), "majority")
+	if err == nil {
+		ctx, err = WithReadPreference(ctx, "secondary")
+	}
+	if err != nil {
+		t.Fatalf("failed to set read overrides: %v", err)
+	}
+	overrides := readOptionsFrom(ctx)
+	if overrides.concern == nil || overrides.preference == nil {
+		t.Errorf("overrides = %+v, want both the concern and the preference kept", overrides)
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import "context"
+
+// TreatedReconciliation classifies a list of names by their stored treated
+// flag
+type TreatedReconciliation struct {
+	Treated   []string `json:"treated"`
+	Untreated []string `json:"untreated"`
+	Missing   []string `json:"missing"`
+}
+
+// ReconcileTreated looks up the given names, one chunk of the batch size at
+// a time, and reports which are stored as treated, which are stored
+// untreated and which are not stored. Repeated names are reported once, in
+// the order they first appear.
+func (bp *BatchProcessor) ReconcileTreated(ctx context.Context, names []string) (_ TreatedReconciliation, err error) {
+	defer recoverPanic("ReconcileTreated", &err)
+	result := TreatedReconciliation{Treated: []string{}, Untreated: []string{}, Missing: []string{}}
+
+	seen := make(map[string]bool, len(names))
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+
+	for start := 0; start < len(unique); start += bp.batchSize {
+		chunk := unique[start:min(start+bp.batchSize, len(unique))]
+		found, err := bp.GetCompaniesByNames(ctx, chunk)
+		if err != nil {
+			return TreatedReconciliation{}, err
+		}
+		treated := make(map[string]bool, len(found))
+		for _, company := range found {
+			treated[company.Name] = company.Treated
+		}
+
+		for _, name := range chunk {
+			isTreated, ok := treated[name]
+			switch {
+			case !ok:
+				result.Missing = append(result.Missing, name)
+			case isTreated:
+				result.Treated = append(result.Treated, name)
+			default:
+				result.Untreated = append(result.Untreated, name)
+			}
+		}
+	}
+	return result, nil
+}
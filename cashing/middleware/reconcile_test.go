@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestReconcileTreated(t *testing.T) {
+	bp := newTestProcessor(t)
+	seedCompanies(t, bp,
+		Company{Name: "Acme", Treated: true},
+		Company{Name: "Globex"},
+		Company{Name: "Initech", Treated: true},
+	)
+
+	names := []string{"Acme", "Globex", "Hooli", "Initech", "Acme", "Umbrella"}
+	got, err := bp.ReconcileTreated(context.Background(), names)
+	if err != nil {
+		t.Fatalf("ReconcileTreated failed: %v", err)
+	}
+	want := TreatedReconciliation{
+		Treated:   []string{"Acme", "Initech"},
+		Untreated: []string{"Globex"},
+		Missing:   []string{"Hooli", "Umbrella"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReconcileTreated = %+v, want %+v", got, want)
+	}
+}
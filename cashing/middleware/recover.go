@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+)
+
+// recoverPanic turns a panic in op, such as the driver failing on malformed
+// BSON, into an error stored in *err. BatchProcessor methods defer it so
+// callers without an HTTP recovery middleware, like background goroutines,
+// get an error instead of a crash.
+func recoverPanic(op string, err *error) {
+	if r := recover(); r != nil {
+		slog.Error("Recovered from panic", "op", op, "panic", r, "stack", string(debug.Stack()))
+		*err = fmt.Errorf("%s: internal error: %v", op, r)
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	fail := func() (err error) {
+		defer recoverPanic("fail", &err)
+		panic("malformed document")
+	}
+	if err := fail(); err == nil || err.Error() != "fail: internal error: malformed document" {
+		t.Errorf("error = %v, want the panic as an error", err)
+	}
+
+	succeed := func() (err error) {
+		defer recoverPanic("succeed", &err)
+		return errors.New("plain failure")
+	}
+	if err := succeed(); err == nil || err.Error() != "plain failure" {
+		t.Errorf("error = %v, want the returned error untouched", err)
+	}
+}
+
+func TestBatchProcessorMethodsRecover(t *testing.T) {
+	// A processor without a collection makes the driver calls panic
+	bp := &BatchProcessor{cache: &listCache{}}
+	_, err := bp.ScanCompanies(context.Background(), 10, "")
+	if err == nil || !strings.Contains(err.Error(), "ScanCompanies: internal error") {
+		t.Errorf("ScanCompanies error = %v, want the panic recovered", err)
+	}
+}
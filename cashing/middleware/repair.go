@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// treatedTrueStrings are the string values a legacy importer used for a
+// treated company, compared case-insensitively; any other string is false
+var treatedTrueStrings = bson.A{"true", "1", "yes", "y", "t"}
+
+// RepairTreatedType converts a treated field stored as anything other than a
+// boolean, such as the string "true" written by an old importer, into a
+// boolean, returning how many companies were repaired. Strings in
+// treatedTrueStrings and non-zero numbers become true; every other value,
+// including a missing field, becomes false. updatedAt is left alone since the
+// company's meaning does not change.
+func (bp *BatchProcessor) RepairTreatedType(ctx context.Context) (_ int64, err error) {
+	defer recoverPanic("RepairTreatedType", &err)
+	defer bp.cache.invalidate()
+
+	coll, err := bp.writeCollection(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	coerced := bson.M{"$switch": bson.M{
+		"branches": bson.A{
+			bson.M{
+				"case": bson.M{"$eq": bson.A{bson.M{"$type": "$treated"}, "string"}},
+				"then": bson.M{"$in": bson.A{bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$treated"}}}, treatedTrueStrings}},
+			},
+			bson.M{
+				"case": bson.M{"$isNumber": "$treated"},
+				"then": bson.M{"$ne": bson.A{"$treated", 0}},
+			},
+		},
+		"default": false,
+	}}
+	result, err := coll.UpdateMany(ctx,
+		bson.M{"treated": bson.M{"$not": bson.M{"$type": "bool"}}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"treated": coerced}}}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to repair treated field: %v", err)
+	}
+
+	slog.Info("Repaired treated field type", "repaired", result.ModifiedCount)
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRepairTreatedType(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme", Treated: true}, Company{Name: "Globex"})
+
+	want := map[string]bool{"Acme": true, "Globex": false}
+	legacy := []struct {
+		name    string
+		treated interface{}
+		want    bool
+	}{
+		{"String true", "true", true},
+		{"Padded yes", " Yes ", true},
+		{"String false", "false", false},
+		{"Number one", 1, true},
+		{"Number zero", 0, false},
+		{"Null", nil, false},
+	}
+	for _, doc := range legacy {
+		if _, err := bp.collection.InsertOne(ctx, bson.M{"name": doc.name, "treated": doc.treated}); err != nil {
+			t.Fatalf("InsertOne failed: %v", err)
+		}
+		want[doc.name] = doc.want
+	}
+	if _, err := bp.collection.InsertOne(ctx, bson.M{"name": "Missing"}); err != nil {
+		t.Fatalf("InsertOne failed: %v", err)
+	}
+	want["Missing"] = false
+
+	repaired, err := bp.RepairTreatedType(ctx)
+	if err != nil {
+		t.Fatalf("RepairTreatedType failed: %v", err)
+	}
+	if repaired != int64(len(legacy)+1) {
+		t.Errorf("repaired %d companies, want %d", repaired, len(legacy)+1)
+	}
+
+	for name, treated := range want {
+		company, err := bp.GetCompany(ctx, name)
+		if err != nil {
+			t.Fatalf("GetCompany(%q) failed after the repair: %v", name, err)
+		}
+		if company.Treated != treated {
+			t.Errorf("%s treated = %v, want %v", name, company.Treated, treated)
+		}
+	}
+
+	if repaired, err := bp.RepairTreatedType(ctx); err != nil || repaired != 0 {
+		t.Errorf("second repair = %d, %v; want nothing left to repair", repaired, err)
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ReplaceAll atomically replaces the contents of the collection with the
+// given companies and returns the resulting document count.
+//
+// The companies are loaded into a temporary collection first, which is then
+// renamed over the live one with dropTarget. Readers see either the old or the
+// new contents, never a partially emptied collection; on any failure the
+// temporary collection is dropped and the live collection is left untouched.
+// renameCollection is not supported for sharded collections.
+func (bp *BatchProcessor) ReplaceAll(ctx context.Context, companies []Company) (_ int64, err error) {
+	defer recoverPanic("ReplaceAll", &err)
+	defer bp.cache.invalidate()
+	live := bp.baseCollection(ctx)
+	db := live.Database()
+	tempName := fmt.Sprintf("%s_replace_%d", live.Name(), time.Now().UnixNano())
+	temp := db.Collection(tempName)
+
+	renamed := false
+	defer func() {
+		if renamed {
+			return
+		}
+		dropCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := temp.Drop(dropCtx); err != nil {
+			slog.Error("Failed to drop temporary collection", "collection", tempName, "error", err)
+		}
+	}()
+
+	if err := ensureIndexes(ctx, temp, bp.indexBuild); err != nil {
+		return 0, err
+	}
+
+	result, err := bp.processInto(ctx, temp, companies, BatchOptions{})
+	if err != nil {
+		return 0, err
+	}
+	if len(result.Errors) > 0 {
+		return 0, fmt.Errorf("failed to write %d companies, first: %s", len(result.Errors), result.Errors[0].Message)
+	}
+
+	rename := bson.D{
+		{Key: "renameCollection", Value: db.Name() + "." + tempName},
+		{Key: "to", Value: db.Name() + "." + live.Name()},
+		{Key: "dropTarget", Value: true},
+	}
+	if err := bp.client.Database("admin").RunCommand(ctx, rename).Err(); err != nil {
+		return 0, fmt.Errorf("failed to swap in replacement collection: %v", err)
+	}
+	renamed = true
+
+	count, err := live.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count companies: %v", err)
+	}
+
+	slog.Info("Replaced all companies", "count", count)
+	return count, nil
+}
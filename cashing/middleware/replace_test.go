@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReplaceAll(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"}, Company{Name: "Globex"})
+
+	count, err := bp.ReplaceAll(ctx, []Company{{Name: "Initech"}})
+	if err != nil {
+		t.Fatalf("ReplaceAll failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+	if exists, err := bp.CompanyExists(ctx, "Acme"); err != nil || exists {
+		t.Errorf("Acme exists = %v (%v) after replace, want false", exists, err)
+	}
+	missing, err := bp.MissingIndexes(ctx)
+	if err != nil || len(missing) != 0 {
+		t.Errorf("missing indexes after replace = %v (%v), want none", missing, err)
+	}
+}
+
+func TestReplaceAllKeepsCollectionOnFailure(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"})
+
+	if _, err := bp.ReplaceAll(ctx, []Company{oversizedCompany("Globex")}); err == nil {
+		t.Fatal("ReplaceAll should fail when a company cannot be written")
+	}
+	if exists, err := bp.CompanyExists(ctx, "Acme"); err != nil || !exists {
+		t.Errorf("Acme exists = %v (%v) after a failed replace, want true", exists, err)
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SampleCompanies returns up to size companies chosen at random with $sample,
+// for spot checks. A collection smaller than size is returned whole, in
+// random order.
+func (bp *BatchProcessor) SampleCompanies(ctx context.Context, size int) (_ []Company, err error) {
+	defer recoverPanic("SampleCompanies", &err)
+	if size <= 0 {
+		return nil, fmt.Errorf("sample size must be positive, got %d", size)
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": live(bson.M{})},
+		bson.M{"$sample": bson.M{"size": size}},
+	}
+	cursor, err := bp.readCollection(ctx).Aggregate(ctx, pipeline, aggregateOptions(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample companies: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	return decodeCompanies(ctx, cursor, "SampleCompanies")
+}
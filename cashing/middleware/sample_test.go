@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestSampleCompanies(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp, Company{Name: "Acme"}, Company{Name: "Globex"}, Company{Name: "Initech"}, Company{Name: "Umbrella"})
+	softDelete(t, bp, "Umbrella")
+
+	sample, err := bp.SampleCompanies(ctx, 2)
+	if err != nil {
+		t.Fatalf("SampleCompanies failed: %v", err)
+	}
+	if len(sample) != 2 {
+		t.Errorf("got %d companies, want 2", len(sample))
+	}
+
+	all, err := bp.SampleCompanies(ctx, 10)
+	if err != nil {
+		t.Fatalf("SampleCompanies failed: %v", err)
+	}
+	names := companyNames(all)
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"Acme", "Globex", "Initech"}) {
+		t.Errorf("oversized sample = %v, want every live company", names)
+	}
+
+	if _, err := bp.SampleCompanies(ctx, 0); err == nil {
+		t.Error("SampleCompanies should reject a size of 0")
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScanCompanies returns up to limit companies in _id order, starting after
+// the given cursor (empty for the first page). Unlike the name-ordered pages,
+// _id never changes, so a scan visits every document exactly once even while
+// companies are renamed.
+func (bp *BatchProcessor) ScanCompanies(ctx context.Context, limit int, cursor string) (_ *Page, err error) {
+	defer recoverPanic("ScanCompanies", &err)
+	filter := bson.M{}
+	if cursor != "" {
+		after, err := primitive.ObjectIDFromHex(cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		filter = bson.M{"_id": bson.M{"$gt": after}}
+	}
+
+	opts := findOptions(ctx).
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit) + 1)
+
+	cur, err := bp.readCollection(ctx).Find(ctx, live(filter), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan companies: %v", err)
+	}
+	defer cur.Close(ctx)
+
+	return decodePage(ctx, cur, "ScanCompanies", limit, func(doc bson.Raw) (string, bool) {
+		id, ok := doc.Lookup("_id").ObjectIDOK()
+		return id.Hex(), ok
+	})
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestScanCompanies(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	seedCompanies(t, bp,
+		Company{Name: "Alpha"}, Company{Name: "Bravo"}, Company{Name: "Charlie"},
+		Company{Name: "Delta"}, Company{Name: "Echo"})
+	softDelete(t, bp, "Echo")
+
+	seen := map[string]int{}
+	cursor := ""
+	for {
+		page, err := bp.ScanCompanies(ctx, 2, cursor)
+		if err != nil {
+			t.Fatalf("ScanCompanies failed: %v", err)
+		}
+		for _, company := range page.Companies {
+			seen[company.Name]++
+			if cursor != "" && company.ID.Hex() <= cursor {
+				t.Errorf("%s (_id %s) is not after cursor %s", company.Name, company.ID.Hex(), cursor)
+			}
+		}
+		if !page.HasMore {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	for _, name := range []string{"Alpha", "Bravo", "Charlie", "Delta"} {
+		if seen[name] != 1 {
+			t.Errorf("scan visited %s %d times, want once", name, seen[name])
+		}
+	}
+	if seen["Echo"] != 0 {
+		t.Error("scan should skip soft-deleted companies")
+	}
+
+	if _, err := bp.ScanCompanies(ctx, 2, "not-an-object-id"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("ScanCompanies with a bad cursor = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// selfTestName is the name of the sentinel company written by SelfTest
+const selfTestName = "__company-api-self-test__"
+
+// SelfTest verifies the full write and read path by upserting a sentinel
+// company into a throwaway "<collection>_selftest" collection through the
+// same code path as batch uploads, reading it back and dropping the
+// collection. Unlike HealthCheck, it fails if the server rejects our writes
+// (e.g. missing privileges or an unsupported update form).
+func (bp *BatchProcessor) SelfTest(ctx context.Context) (err error) {
+	defer recoverPanic("SelfTest", &err)
+	coll := bp.collection.Database().Collection(bp.collection.Name() + "_selftest")
+	defer func() {
+		if err := coll.Drop(context.WithoutCancel(ctx)); err != nil {
+			slog.Warn("Failed to drop self-test collection", "collection", coll.Name(), "error", err)
+		}
+	}()
+
+	sentinel := Company{
+		Name:    selfTestName,
+		Address: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	chunk, err := writeChunk(ctx, coll, []Company{sentinel}, bp.writeSettings(ConflictOverwrite, ModeUpsert))
+	if err != nil {
+		return fmt.Errorf("self-test write failed: %v", err)
+	}
+	if len(chunk.errors) > 0 {
+		return fmt.Errorf("self-test write failed: %s", chunk.errors[0].Message)
+	}
+
+	var stored Company
+	if err := coll.FindOne(ctx, bson.M{"name": selfTestName}).Decode(&stored); err != nil {
+		return fmt.Errorf("self-test read failed: %v", err)
+	}
+	if bp.fields["address"] && stored.Address != sentinel.Address {
+		return fmt.Errorf("self-test read back %q, wrote %q", stored.Address, sentinel.Address)
+	}
+	return nil
+}
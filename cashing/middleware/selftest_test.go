@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSelfTest(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+
+	if err := bp.SelfTest(ctx); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+
+	names, err := bp.collection.Database().ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		t.Fatalf("ListCollectionNames failed: %v", err)
+	}
+	for _, name := range names {
+		if name == "companies_selftest" {
+			t.Error("SelfTest should drop its collection")
+		}
+	}
+	if count, err := bp.collection.CountDocuments(ctx, bson.M{}); err != nil || count != 0 {
+		t.Errorf("companies collection holds %d documents (err %v), want 0", count, err)
+	}
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// CompanySource yields the companies of a streamed import one at a time. It
+// returns io.EOF once the stream is exhausted.
+type CompanySource func() (Company, error)
+
+// SourceError reports a company that could not be read from a streamed
+// import. Chunks read before it may already have been written.
+type SourceError struct {
+	Index int
+	Err   error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("company %d: %v", e.Index, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// importChunk is a run of companies read from a stream, with the input index
+// of its first company
+type importChunk struct {
+	start     int
+	companies []Company
+}
+
+// ImportStream upserts companies as they are read from next instead of
+// holding the whole import in memory. A reader goroutine groups companies
+// into chunks of batchSize on a channel with room for one chunk per worker,
+// so when MongoDB falls behind the reader blocks rather than buffering.
+//
+// Duplicate names are resolved within each chunk only, and chunks are written
+// concurrently, so the error strategy, which needs the whole batch up front,
+// is not supported.
+func (bp *BatchProcessor) ImportStream(ctx context.Context, next CompanySource, opts BatchOptions) (_ BatchResult, err error) {
+	defer recoverPanic("ImportStream", &err)
+	defer bp.cache.invalidate()
+	defer bp.work.startBatch()()
+	var result BatchResult
+
+	strategy := opts.ConflictStrategy
+	if strategy == "" {
+		strategy = ConflictOverwrite
+	}
+	if strategy == ConflictError {
+		return result, fmt.Errorf("conflict strategy %q is not supported for streamed imports", strategy)
+	}
+
+	settings := bp.writeSettings(strategy, ModeUpsert)
+	settings.keepAddress = opts.KeepAddress
+	settings.fields = settings.fields.restrict(opts.Fields)
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunkSize := bp.batchSize
+	workers := bp.workers
+	chunks := make(chan importChunk, workers)
+
+	var (
+		mu              sync.Mutex
+		fatal           error
+		written         int
+		completedChunks int
+		readChunks      int
+	)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				if ctx.Err() != nil {
+					continue
+				}
+				err := bp.writeImportChunk(ctx, chunk, settings, &mu, &result)
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					completedChunks++
+					written += len(chunk.companies)
+					if opts.Progress != nil {
+						// The total is unknown until the stream ends
+						opts.Progress(written, 0)
+					}
+				case ctx.Err() == nil && fatal == nil:
+					fatal = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	readErr := func() error {
+		defer close(chunks)
+		batch := importChunk{}
+		send := func() bool {
+			select {
+			case chunks <- batch:
+				readChunks++
+				batch = importChunk{start: batch.start + len(batch.companies)}
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for index := 0; ; index++ {
+			company, err := next()
+			if errors.Is(err, io.EOF) {
+				if len(batch.companies) > 0 {
+					send()
+				}
+				return nil
+			}
+			if err != nil {
+				return &SourceError{Index: index, Err: err}
+			}
+
+			batch.companies = append(batch.companies, company)
+			if len(batch.companies) == chunkSize && !send() {
+				return nil
+			}
+		}
+	}()
+	wg.Wait()
+
+	switch {
+	case fatal != nil:
+		return result, fatal
+	case readErr != nil:
+		return result, readErr
+	case ctx.Err() != nil:
+		return result, &BatchCanceledError{
+			CompletedChunks: completedChunks,
+			TotalChunks:     readChunks,
+			Err:             ctx.Err(),
+		}
+	}
+
+	// The companies are already written, so a logging failure is not fatal
+	importID, err := bp.recordImport(ctx, result)
+	if err != nil {
+		slog.Error("Failed to record import", "error", err)
+	}
+	result.ImportID = importID
+
+	return result, nil
+}
+
+// writeImportChunk resolves duplicates within chunk, writes it and folds the
+// outcome into result under mu
+func (bp *BatchProcessor) writeImportChunk(ctx context.Context, chunk importChunk, settings writeSettings, mu *sync.Mutex, result *BatchResult) (err error) {
+	// Workers run on their own goroutines, out of reach of ImportStream's recover
+	defer recoverPanic("ImportStream", &err)
+	companies, inputIndexes, dropped, err := resolveBatchConflicts(chunk.companies, settings.strategy, settings.collation)
+	if err != nil {
+		return err
+	}
+
+	coll, err := bp.writeCollection(ctx)
+	if err != nil {
+		return err
+	}
+	done := bp.work.startChunk()
+	written, err := writeChunk(ctx, coll, companies, settings)
+	done()
+	if err != nil {
+		return err
+	}
+	bp.logChunk(ctx, written)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if settings.strategy == ConflictSkip {
+		result.Skipped += dropped + written.matched
+	} else {
+		result.Overwritten += dropped + written.matched
+		result.Unchanged += written.matched - written.modified
+	}
+
+	failed := make(map[int]bool, len(written.errors))
+	for _, writeError := range written.errors {
+		failed[writeError.Index] = true
+		writeError.Index = chunk.start + inputIndexes[writeError.Index]
+		result.Errors = append(result.Errors, writeError)
+	}
+	for i, company := range companies {
+		if !failed[i] && (settings.strategy != ConflictSkip || written.inserted[i]) {
+			result.affected = append(result.affected, company.Name)
+		}
+		if !failed[i] && written.inserted[i] {
+			result.created = append(result.created, company.Name)
+		}
+	}
+	result.Processed += written.modified + written.upserted
+	result.Inserted += written.upserted
+	result.Modified += written.modified
+	return nil
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// sliceSource yields companies and then io.EOF, or err in place of the
+// company at index failAt
+func sliceSource(companies []Company, failAt int, err error) CompanySource {
+	i := 0
+	return func() (Company, error) {
+		if i == failAt {
+			i++
+			return Company{}, err
+		}
+		if i >= len(companies) {
+			return Company{}, io.EOF
+		}
+		company := companies[i]
+		i++
+		return company, nil
+	}
+}
+
+func TestImportStream(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+	companies := make([]Company, 250)
+	for i := range companies {
+		companies[i] = Company{Name: fmt.Sprintf("Company %03d", i)}
+	}
+
+	result, err := bp.ImportStream(ctx, sliceSource(companies, -1, nil), BatchOptions{})
+	if err != nil {
+		t.Fatalf("ImportStream failed: %v", err)
+	}
+	if result.Inserted != 250 {
+		t.Errorf("Inserted = %d, want 250", result.Inserted)
+	}
+	count, err := bp.CountCompanies(ctx, "")
+	if err != nil || count != 250 {
+		t.Errorf("stored %d companies (%v), want 250", count, err)
+	}
+}
+
+func TestImportStreamSourceError(t *testing.T) {
+	bp := newTestProcessor(t)
+	companies := []Company{{Name: "Acme"}, {Name: "Globex"}}
+	malformed := errors.New("malformed line")
+
+	_, err := bp.ImportStream(context.Background(), sliceSource(companies, 1, malformed), BatchOptions{})
+	var sourceErr *SourceError
+	if !errors.As(err, &sourceErr) || sourceErr.Index != 1 || !errors.Is(err, malformed) {
+		t.Errorf("ImportStream error = %v, want a SourceError at index 1", err)
+	}
+}
+
+func TestImportStreamRejectsErrorStrategy(t *testing.T) {
+	bp := newTestProcessor(t)
+	opts := BatchOptions{ConflictStrategy: ConflictError}
+	if _, err := bp.ImportStream(context.Background(), sliceSource(nil, -1, nil), opts); err == nil {
+		t.Error("ImportStream should reject the error conflict strategy")
+	}
+}
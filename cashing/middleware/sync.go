@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrSyncAborted is returned when a full sync is rolled back because some of
+// its companies could not be written; the result lists their errors
+var ErrSyncAborted = errors.New("full sync aborted")
+
+// syncAll writes companies and deletes every stored company whose name is not
+// among them, in one transaction: either the collection ends up holding
+// exactly the batch, or nothing changes. A company that fails to write aborts
+// the sync with ErrSyncAborted rather than deleting around the gap. With
+// opts.SoftDelete missing companies are marked deleted instead, and companies
+// in the batch lose any earlier mark.
+// Transactions need a replica set or sharded cluster, and MongoDB aborts any
+// that runs longer than transactionLifetimeLimitSeconds (60s by default),
+// which bounds how large a full sync can be.
+func (bp *BatchProcessor) syncAll(ctx context.Context, companies []Company, opts BatchOptions) (BatchResult, error) {
+	coll, err := bp.writeCollection(ctx)
+	if err != nil {
+		return BatchResult{}, err
+	}
+
+	session, err := bp.client.StartSession()
+	if err != nil {
+		return BatchResult{}, fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(ctx)
+
+	names := make([]string, len(companies))
+	for i, company := range companies {
+		names[i] = company.Name
+	}
+
+	var result BatchResult
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		// The callback is rerun from scratch on transient errors
+		var err error
+		result, err = bp.processInto(sc, coll, companies, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Errors) > 0 {
+			return nil, fmt.Errorf("%w: %d companies failed to write, first: %s",
+				ErrSyncAborted, len(result.Errors), result.Errors[0].Message)
+		}
+
+		missing := bson.M{"name": bson.M{"$nin": names}}
+		if !opts.SoftDelete {
+			deleted, err := coll.DeleteMany(sc, missing, options.Delete().SetCollation(bp.nameCollation))
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete companies missing from sync: %v", err)
+			}
+			result.Deleted = int(deleted.DeletedCount)
+			return nil, nil
+		}
+
+		missing["deleted"] = bson.M{"$ne": true}
+		collated := options.Update().SetCollation(bp.nameCollation)
+		marked, err := coll.UpdateMany(sc, missing, bson.M{
+			"$set": bson.M{"deleted": true, "deletedAt": time.Now()},
+		}, collated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mark companies missing from sync deleted: %v", err)
+		}
+		result.Deleted = int(marked.ModifiedCount)
+		_, err = coll.UpdateMany(sc, bson.M{"name": bson.M{"$in": names}, "deleted": true}, bson.M{
+			"$unset": bson.M{"deleted": "", "deletedAt": ""},
+		}, collated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore soft-deleted companies: %v", err)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		// Nothing was committed, so only the write errors are worth reporting
+		return BatchResult{Errors: result.Errors}, err
+	}
+
+	slog.Info("Full sync completed",
+		"companies", len(companies),
+		"deleted", result.Deleted,
+		"soft_delete", opts.SoftDelete)
+	return result, nil
+}
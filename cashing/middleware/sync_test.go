@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFullSync(t *testing.T) {
+	tests := []struct {
+		name        string
+		softDelete  bool
+		wantStored  int64
+		wantDeleted int
+	}{
+		{"hard delete", false, 2, 2},
+		{"soft delete", true, 4, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bp := newTestProcessor(t)
+			ctx := context.Background()
+			seedCompanies(t, bp, Company{Name: "Acme"}, Company{Name: "Globex"}, Company{Name: "Initech"}, Company{Name: "Umbrella"})
+
+			batch := []Company{{Name: "Acme"}, {Name: "Initech", Address: "1 Main St"}}
+			result, err := bp.ProcessBatch(ctx, batch, BatchOptions{FullSync: true, SoftDelete: tt.softDelete})
+			if err != nil {
+				t.Fatalf("full sync failed: %v", err)
+			}
+			if result.Deleted != tt.wantDeleted {
+				t.Errorf("deleted = %d, want %d", result.Deleted, tt.wantDeleted)
+			}
+
+			all, err := bp.FetchAllCompanies(ctx)
+			if err != nil {
+				t.Fatalf("FetchAllCompanies failed: %v", err)
+			}
+			if got := companyNames(all); len(got) != 2 || got[0] != "Acme" || got[1] != "Initech" {
+				t.Errorf("companies after sync = %v, want [Acme Initech]", got)
+			}
+			if stored, _ := bp.collection.CountDocuments(ctx, bson.M{}); stored != tt.wantStored {
+				t.Errorf("%d documents stored, want %d", stored, tt.wantStored)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// tenantKey is the context key for the request's tenant
+type tenantKey struct{}
+
+// tenantPattern restricts tenant identifiers to names that are safe to embed
+// in a collection name
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,47}$`)
+
+// WithTenant returns a context whose operations use the named tenant's
+// companies collection instead of the default one. Tenant identifiers are
+// case-insensitive and limited to letters, digits, '-' and '_'. Audit and
+// import records stay in the shared collections, tagged with the tenant.
+func WithTenant(ctx context.Context, tenant string) (context.Context, error) {
+	tenant, err := ParseTenant(tenant)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant), nil
+}
+
+// ParseTenant validates a tenant identifier and returns its canonical,
+// lower-case form
+func ParseTenant(tenant string) (string, error) {
+	tenant = strings.ToLower(tenant)
+	if !tenantPattern.MatchString(tenant) {
+		return "", fmt.Errorf("invalid tenant %q: want up to 48 letters, digits, '-' or '_'", tenant)
+	}
+	return tenant, nil
+}
+
+// tenantFrom returns the tenant carried by ctx, or "" for the default
+// collection
+func tenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// tenantFilter matches the audit and import records of ctx's tenant. Records
+// of the default tenant carry no tenant field, which a null filter matches.
+func tenantFilter(ctx context.Context) interface{} {
+	if tenant := tenantFrom(ctx); tenant != "" {
+		return tenant
+	}
+	return nil
+}
+
+// tenantCollections caches each tenant's collection and whether its indexes
+// have been created
+type tenantCollections struct {
+	mu      sync.Mutex
+	entries map[string]*tenantCollection
+}
+
+// tenantCollection is one tenant's collection. mu serializes the first index
+// build so concurrent first writes do not each create the indexes.
+type tenantCollection struct {
+	coll    *mongo.Collection
+	mu      sync.Mutex
+	indexed bool
+}
+
+// tenantCollectionName names a tenant's collection after the default one,
+// e.g. companies_tenant_acme, so tenant collections cannot collide with the
+// audit and import collections
+func (bp *BatchProcessor) tenantCollectionName(tenant string) string {
+	return bp.collection.Name() + "_tenant_" + tenant
+}
+
+// tenant returns the cached entry for tenant, creating it on first use. Only
+// writes create entries, so the cache is bounded by the tenants that have
+// data rather than by every identifier a client sends.
+func (bp *BatchProcessor) tenant(tenant string) *tenantCollection {
+	bp.tenants.mu.Lock()
+	defer bp.tenants.mu.Unlock()
+	entry, ok := bp.tenants.entries[tenant]
+	if !ok {
+		name := bp.tenantCollectionName(tenant)
+		entry = &tenantCollection{coll: bp.collection.Database().Collection(name)}
+		bp.tenants.entries[tenant] = entry
+	}
+	return entry
+}
+
+// baseCollection returns the companies collection for the request's tenant
+// without touching the server; reading a tenant that has never been written
+// simply finds nothing. Reads do not add to the tenant cache.
+func (bp *BatchProcessor) baseCollection(ctx context.Context) *mongo.Collection {
+	tenant := tenantFrom(ctx)
+	if tenant == "" {
+		return bp.collection
+	}
+	bp.tenants.mu.Lock()
+	entry, ok := bp.tenants.entries[tenant]
+	bp.tenants.mu.Unlock()
+	if ok {
+		return entry.coll
+	}
+	return bp.collection.Database().Collection(bp.tenantCollectionName(tenant))
+}
+
+// writeCollection returns the companies collection for the request's tenant,
+// creating its indexes before the first write so that names are unique from
+// the start. A failed index build is retried on the next write.
+func (bp *BatchProcessor) writeCollection(ctx context.Context) (*mongo.Collection, error) {
+	tenant := tenantFrom(ctx)
+	if tenant == "" {
+		return bp.collection, nil
+	}
+
+	entry := bp.tenant(tenant)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if !entry.indexed {
+		if err := ensureIndexes(ctx, entry.coll, bp.indexBuild); err != nil {
+			return nil, fmt.Errorf("failed to prepare collection for tenant %q: %v", tenant, err)
+		}
+		entry.indexed = true
+	}
+	return entry.coll, nil
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func tenantContext(t *testing.T, tenant string) context.Context {
+	t.Helper()
+	ctx, err := WithTenant(context.Background(), tenant)
+	if err != nil {
+		t.Fatalf("WithTenant(%q) failed: %v", tenant, err)
+	}
+	return ctx
+}
+
+func TestWithTenant(t *testing.T) {
+	tests := []struct {
+		tenant  string
+		want    string
+		wantErr bool
+	}{
+		{"acme", "acme", false},
+		{"Acme-EU_2", "acme-eu_2", false},
+		{"", "", true},
+		{"-acme", "", true},
+		{"acme.eu", "", true},
+		{"acme/../admin", "", true},
+	}
+	for _, tt := range tests {
+		ctx, err := WithTenant(context.Background(), tt.tenant)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("WithTenant(%q) error = %v, want error %v", tt.tenant, err, tt.wantErr)
+			continue
+		}
+		if got := tenantFrom(ctx); got != tt.want {
+			t.Errorf("WithTenant(%q) tenant = %q, want %q", tt.tenant, got, tt.want)
+		}
+	}
+}
+
+func TestSubscribeImportsPerTenant(t *testing.T) {
+	bp := &BatchProcessor{importFeed: newImportFeed()}
+	acme, unsubscribe := bp.SubscribeImports(tenantContext(t, "acme"))
+	defer unsubscribe()
+	shared, unsubscribeShared := bp.SubscribeImports(context.Background())
+	defer unsubscribeShared()
+
+	bp.importFeed.publish(ImportLog{ID: "1", Tenant: "globex"})
+	bp.importFeed.publish(ImportLog{ID: "2", Tenant: "acme"})
+	bp.importFeed.publish(ImportLog{ID: "3"})
+
+	if entry := <-acme; entry.ID != "2" || len(acme) != 0 {
+		t.Errorf("acme subscriber got import %s and %d more, want only import 2", entry.ID, len(acme))
+	}
+	if entry := <-shared; entry.ID != "3" || len(shared) != 0 {
+		t.Errorf("default subscriber got import %s and %d more, want only import 3", entry.ID, len(shared))
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	bp := newTestProcessor(t)
+	acme := tenantContext(t, "acme")
+	globex := tenantContext(t, "globex")
+
+	acmeResult, err := bp.ProcessBatch(acme, []Company{{Name: "Shared", Address: "1 Acme Way"}}, BatchOptions{})
+	if err != nil {
+		t.Fatalf("ProcessBatch for acme failed: %v", err)
+	}
+	if _, err := bp.ProcessBatch(globex, []Company{{Name: "Shared", Address: "2 Globex Rd"}, {Name: "Other"}}, BatchOptions{}); err != nil {
+		t.Fatalf("ProcessBatch for globex failed: %v", err)
+	}
+
+	for ctx, want := range map[context.Context]string{acme: "1 Acme Way", globex: "2 Globex Rd"} {
+		company, err := bp.GetCompany(ctx, "Shared")
+		if err != nil {
+			t.Fatalf("GetCompany failed: %v", err)
+		}
+		if company.Address != want {
+			t.Errorf("address = %q, want %q", company.Address, want)
+		}
+	}
+	if exists, _ := bp.CompanyExists(acme, "Other"); exists {
+		t.Error("acme sees a company written by globex")
+	}
+	if exists, _ := bp.CompanyExists(context.Background(), "Shared"); exists {
+		t.Error("the default tenant sees a company written by a tenant")
+	}
+
+	// Audit and import records are shared collections but scoped by tenant
+	if err := bp.SetTreated(acme, "Shared", true); err != nil {
+		t.Fatalf("SetTreated failed: %v", err)
+	}
+	if entries, err := bp.CompanyAudit(acme, "Shared"); err != nil || len(entries) != 1 || entries[0].Tenant != "acme" {
+		t.Errorf("acme audit = %+v, %v; want one acme entry", entries, err)
+	}
+	if entries, err := bp.CompanyAudit(globex, "Shared"); err != nil || len(entries) != 0 {
+		t.Errorf("globex audit = %+v, %v; want none", entries, err)
+	}
+	if _, history, err := bp.GetCompanyWithHistory(globex, "Shared", 10); err != nil || len(history) != 0 {
+		t.Errorf("globex history = %+v, %v; want none", history, err)
+	}
+
+	if _, err := bp.GetImport(acme, acmeResult.ImportID); err != nil {
+		t.Errorf("GetImport for acme failed: %v", err)
+	}
+	for _, ctx := range []context.Context{globex, context.Background()} {
+		if _, err := bp.GetImport(ctx, acmeResult.ImportID); !errors.Is(err, ErrImportNotFound) {
+			t.Errorf("GetImport of another tenant's import = %v, want ErrImportNotFound", err)
+		}
+	}
+}
+
+func TestBaseCollectionDoesNotCacheTenants(t *testing.T) {
+	// Connect does not dial, so no server is needed to hand out collections
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+	bp := &BatchProcessor{
+		collection: client.Database("test").Collection("companies"),
+		tenants:    &tenantCollections{entries: make(map[string]*tenantCollection)},
+	}
+
+	if coll := bp.baseCollection(tenantContext(t, "acme")); coll.Name() != "companies_tenant_acme" {
+		t.Errorf("collection = %q, want companies_tenant_acme", coll.Name())
+	}
+	if len(bp.tenants.entries) != 0 {
+		t.Errorf("a read cached %d tenant entries, want none", len(bp.tenants.entries))
+	}
+}
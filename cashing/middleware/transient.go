@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrUnavailable marks an operation that failed with a transient error, such
+// as during a replica set failover, and kept failing after its retries
+var ErrUnavailable = errors.New("database temporarily unavailable")
+
+// transientBackoff is the delay before the first retry of a transient
+// failure; each further retry waits one more step
+const transientBackoff = 100 * time.Millisecond
+
+// transientCodes are the server errors seen while a primary steps down or a
+// node is unreachable
+var transientCodes = []int{
+	6,     // HostUnreachable
+	7,     // HostNotFound
+	89,    // NetworkTimeout
+	91,    // ShutdownInProgress
+	189,   // PrimarySteppedDown
+	9001,  // SocketException
+	10107, // NotWritablePrimary
+	11600, // InterruptedAtShutdown
+	11602, // InterruptedDueToReplStateChange
+	13435, // NotPrimaryNoSecondaryOk
+	13436, // NotPrimaryOrSecondary
+}
+
+// isPoolCleared reports whether err is a failure to check out a connection
+// from a pool that was cleared, typically after a failover. The operation was
+// never sent, so retrying it is always safe.
+func isPoolCleared(err error) bool {
+	// Implemented by the driver's pool errors; see driver.RetryablePoolError
+	var poolErr interface{ Retryable() bool }
+	return errors.As(err, &poolErr) && poolErr.Retryable()
+}
+
+// isTransient reports whether err is a pool, network or failover error that
+// is likely to succeed when retried
+func isTransient(err error) bool {
+	if errors.Is(err, ErrUnavailable) || isPoolCleared(err) || mongo.IsNetworkError(err) {
+		return true
+	}
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	if serverErr.HasErrorLabel("RetryableWriteError") {
+		return true
+	}
+	for _, code := range transientCodes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// databaseError describes err from a failed database operation as
+// "action: err", marking it ErrUnavailable if it was transient so handlers
+// can answer 503 rather than 500
+func databaseError(action string, err error) error {
+	if isTransient(err) {
+		return fmt.Errorf("%w: %s: %v", ErrUnavailable, action, err)
+	}
+	return fmt.Errorf("%s: %v", action, err)
+}
+
+// retryable returns the check for retrying a write built with settings. A
+// repeated insert or seen counter bump is not idempotent: a write that failed
+// on the network may have been applied, so these are only retried when they
+// never reached the server.
+func (settings writeSettings) retryable() func(error) bool {
+	if settings.mode == ModeInsert || settings.countSeen {
+		return isPoolCleared
+	}
+	return isTransient
+}
+
+// retryTransient runs fn, retrying it up to retries times while it fails with
+// an error retryable accepts. The driver already retries most operations
+// once, but a failover can outlast that single retry. Inside a transaction
+// nothing is retried, as the failed operation has aborted it; WithTransaction
+// retries the whole transaction instead.
+func retryTransient(ctx context.Context, retries int, op string, retryable func(error) bool, fn func() error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn()
+	}
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries || !retryable(err) {
+			return err
+		}
+		slog.Warn("Database operation failed with a transient error, retrying",
+			"operation", op,
+			"attempt", attempt+1,
+			"error", err)
+		select {
+		case <-time.After(time.Duration(attempt+1) * transientBackoff):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// poolClearedError mimics the driver's error for a checkout from a cleared pool
+type poolClearedError struct{}
+
+func (poolClearedError) Error() string   { return "connection pool for localhost:27017 was cleared" }
+func (poolClearedError) Retryable() bool { return true }
+
+func TestRetryTransientPoolCleared(t *testing.T) {
+	calls := 0
+	err := retryTransient(context.Background(), 2, "test", isTransient, func() error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("server selection: %w", poolClearedError{})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2", calls)
+	}
+}
+
+func TestRetryTransientGivesUp(t *testing.T) {
+	calls := 0
+	err := retryTransient(context.Background(), 1, "test", isTransient, func() error {
+		calls++
+		return poolClearedError{}
+	})
+	if err == nil {
+		t.Fatal("expected the last error after the retries ran out")
+	}
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2", calls)
+	}
+	if !errors.Is(databaseError("failed to process batch", err), ErrUnavailable) {
+		t.Error("expected the transient failure to be marked ErrUnavailable")
+	}
+}
+
+func TestRetryTransientPermanentError(t *testing.T) {
+	calls := 0
+	duplicate := mongo.CommandError{Code: 11000, Message: "duplicate key"}
+	err := retryTransient(context.Background(), 2, "test", isTransient, func() error {
+		calls++
+		return duplicate
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected one call and the error, got %d calls and %v", calls, err)
+	}
+	if errors.Is(databaseError("failed to process batch", err), ErrUnavailable) {
+		t.Error("a permanent error must not be marked ErrUnavailable")
+	}
+}
+
+func TestWriteSettingsRetryable(t *testing.T) {
+	network := mongo.CommandError{Labels: []string{"NetworkError"}, Message: "connection reset"}
+	steppedDown := mongo.CommandError{Code: 189, Message: "primary stepped down"}
+
+	tests := []struct {
+		name     string
+		settings writeSettings
+		err      error
+		want     bool
+	}{
+		{"upsert on network error", writeSettings{mode: ModeUpsert}, network, true},
+		{"upsert on step down", writeSettings{mode: ModeUpsert}, steppedDown, true},
+		{"upsert on pool cleared", writeSettings{mode: ModeUpsert}, poolClearedError{}, true},
+		{"counted upsert on network error", writeSettings{mode: ModeUpsert, countSeen: true}, network, false},
+		{"counted upsert on pool cleared", writeSettings{mode: ModeUpsert, countSeen: true}, poolClearedError{}, true},
+		{"insert on step down", writeSettings{mode: ModeInsert}, steppedDown, false},
+		{"insert on pool cleared", writeSettings{mode: ModeInsert}, poolClearedError{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.settings.retryable()(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
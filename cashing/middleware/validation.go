@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes why one field of a request is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError reports every invalid field found in a company or patch,
+// rather than only the first
+type ValidationError struct {
+	// Company names the company, if known
+	Company string
+	Fields  []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		parts[i] = field.Field + ": " + field.Message
+	}
+	if e.Company == "" {
+		return strings.Join(parts, "; ")
+	}
+	return fmt.Sprintf("company %q: %s", e.Company, strings.Join(parts, "; "))
+}
+
+// add records an invalid field
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns e as an error, or nil if no field was invalid
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// validMetadataKey reports whether key can be written as part of a dotted
+// path: non-empty, free of '.' and without a leading '$'
+func validMetadataKey(key string) bool {
+	return key != "" && !strings.Contains(key, ".") && !strings.HasPrefix(key, "$")
+}
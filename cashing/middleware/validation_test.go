@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompanyValidateReportsEveryField(t *testing.T) {
+	company := Company{Metadata: map[string]interface{}{"b.c": 1, "$a": 2, "ok": 3}}
+	err := company.Validate()
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Validate = %v, want a *ValidationError", err)
+	}
+	want := []FieldError{
+		{Field: "name", Message: "is required"},
+		{Field: "metadata.$a", Message: `invalid metadata key "$a"`},
+		{Field: "metadata.b.c", Message: `invalid metadata key "b.c"`},
+	}
+	if !reflect.DeepEqual(invalid.Fields, want) {
+		t.Errorf("fields = %+v, want %+v", invalid.Fields, want)
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	invalid := &ValidationError{Company: "Acme"}
+	if invalid.err() != nil {
+		t.Error("a ValidationError without fields should not be an error")
+	}
+	invalid.add("metadata.a.b", "invalid metadata key %q", "a.b")
+	invalid.add("treated", "must be a boolean")
+	want := `company "Acme": metadata.a.b: invalid metadata key "a.b"; treated: must be a boolean`
+	if err := invalid.err(); err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import "sync/atomic"
+
+// workCounters track the batch work in progress
+type workCounters struct {
+	batches atomic.Int64
+	chunks  atomic.Int64
+}
+
+// WorkStats reports how busy the processor is, for capacity planning
+type WorkStats struct {
+	// InFlightBatches counts batch writes in progress: uploads, streamed
+	// and NDJSON imports, single upserts and replace-all loads
+	InFlightBatches int64 `json:"in_flight_batches"`
+	// InFlightChunks counts chunk writes in progress
+	InFlightChunks int64 `json:"in_flight_chunks"`
+	// Workers is the configured number of concurrent chunk writers per
+	// streamed import
+	Workers int `json:"workers"`
+	// MaxPoolSize is the MongoDB connection pool size, which bounds the
+	// writes that can run at once across all batches
+	MaxPoolSize int `json:"max_pool_size"`
+}
+
+// WorkStats returns the processor's current load and configured concurrency
+func (bp *BatchProcessor) WorkStats() WorkStats {
+	return WorkStats{
+		InFlightBatches: bp.work.batches.Load(),
+		InFlightChunks:  bp.work.chunks.Load(),
+		Workers:         bp.workers,
+		MaxPoolSize:     MaxPoolSize(bp.workers),
+	}
+}
+
+// startBatch counts a batch as in flight until the returned function is called
+func (c *workCounters) startBatch() func() {
+	c.batches.Add(1)
+	return func() { c.batches.Add(-1) }
+}
+
+// startChunk counts a chunk write as in flight until the returned function is
+// called
+func (c *workCounters) startChunk() func() {
+	c.chunks.Add(1)
+	return func() { c.chunks.Add(-1) }
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import "testing"
+
+func TestWorkStats(t *testing.T) {
+	bp := &BatchProcessor{workers: 4}
+	batchDone := bp.work.startBatch()
+	firstChunk := bp.work.startChunk()
+	secondChunk := bp.work.startChunk()
+
+	want := WorkStats{InFlightBatches: 1, InFlightChunks: 2, Workers: 4, MaxPoolSize: 8}
+	if got := bp.WorkStats(); got != want {
+		t.Errorf("WorkStats() = %+v, want %+v", got, want)
+	}
+
+	firstChunk()
+	secondChunk()
+	batchDone()
+	if got := bp.WorkStats(); got.InFlightBatches != 0 || got.InFlightChunks != 0 {
+		t.Errorf("WorkStats() after the work finished = %+v, want nothing in flight", got)
+	}
+}
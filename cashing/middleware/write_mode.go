@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WriteMode selects how a batch writes its companies
+type WriteMode string
+
+const (
+	// ModeUpsert creates new companies and updates existing ones by name
+	ModeUpsert WriteMode = "upsert"
+	// ModeInsert only creates companies; a name that already exists, in the
+	// collection or earlier in the batch, fails with a duplicate key error
+	ModeInsert WriteMode = "insert"
+)
+
+// ParseWriteMode validates a mode name; an empty value selects ModeUpsert
+func ParseWriteMode(value string) (WriteMode, error) {
+	switch mode := WriteMode(strings.ToLower(value)); mode {
+	case "":
+		return ModeUpsert, nil
+	case ModeUpsert, ModeInsert:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown write mode %q (want upsert or insert)", value)
+	}
+}
+
+// insertModel builds the insert for one company, writing the same fields an
+// upsert would
+func insertModel(company Company, settings writeSettings) (mongo.WriteModel, *WriteError) {
+	now := time.Now().UTC()
+	doc := bson.M{
+		"name":      company.Name,
+		"createdAt": now,
+		"updatedAt": now,
+	}
+	if settings.fields["address"] {
+		setAddress(doc, company, settings)
+	}
+	if settings.fields["treated"] {
+		doc["treated"] = company.Treated
+		if company.Treated {
+			doc["treatedAt"] = now
+		}
+	} else {
+		doc["treated"] = false
+	}
+	if settings.fields["source"] && company.Source != "" {
+		doc["source"] = company.Source
+	}
+	if settings.fields["metadata"] && len(company.Metadata) > 0 {
+		doc["metadata"] = company.Metadata
+	}
+	if settings.countSeen {
+		doc["seen"] = 1
+	}
+
+	if writeError := checkDocumentSize(doc); writeError != nil {
+		writeError.Name = company.Name
+		return nil, writeError
+	}
+	return mongo.NewInsertOneModel().SetDocument(doc), nil
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseWriteMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    WriteMode
+		wantErr bool
+	}{
+		{"", ModeUpsert, false},
+		{"upsert", ModeUpsert, false},
+		{"INSERT", ModeInsert, false},
+		{"replace", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWriteMode(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseWriteMode(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestProcessBatchInsertMode(t *testing.T) {
+	bp := newTestProcessor(t)
+	ctx := context.Background()
+
+	batch := []Company{
+		{Name: "Acme", Address: "1 Main St", Treated: true},
+		{Name: "Acme", Address: "2 Main St"},
+	}
+	result, err := bp.ProcessBatch(ctx, batch, BatchOptions{Mode: ModeInsert})
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	if result.Processed != 1 || len(result.Errors) != 1 || result.Errors[0].Index != 1 {
+		t.Errorf("result = %+v, want the repeated name reported at index 1", result)
+	}
+
+	company, err := bp.GetCompany(ctx, "Acme")
+	if err != nil {
+		t.Fatalf("GetCompany failed: %v", err)
+	}
+	if company.Address != "1 Main St" || !company.Treated || company.TreatedAt.IsZero() || company.CreatedAt.IsZero() {
+		t.Errorf("inserted company = %+v, want the first entry with upsert's fields", company)
+	}
+}
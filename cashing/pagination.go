@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"company-api/middleware"
+)
+
+// parsePageParams reads the limit and cursor query parameters. A limit above
+// MaxPageSize is clamped, or rejected under the "reject" policy.
+func (s *Server) parsePageParams(r *http.Request) (int, string, error) {
+	limit := s.config.DefaultPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return 0, "", fmt.Errorf("limit must be a positive integer, got %q", value)
+		}
+		if n > s.config.MaxPageSize && s.config.RejectOversizedPages {
+			return 0, "", fmt.Errorf("limit must not exceed %d, got %d", s.config.MaxPageSize, n)
+		}
+		limit = min(n, s.config.MaxPageSize)
+	}
+	return limit, r.URL.Query().Get("cursor"), nil
+}
+
+// isPaginated reports whether the request asked for a page rather than the
+// full list
+func isPaginated(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Has("limit") || query.Has("cursor")
+}
+
+// sendPage writes a page of companies in the configured response shape
+func (s *Server) sendPage(w http.ResponseWriter, page *middleware.Page) {
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Companies fetched successfully",
+		Data: map[string]interface{}{
+			"companies":   s.presentCompanies(page.Companies),
+			"next_cursor": page.NextCursor,
+			"has_more":    page.HasMore,
+		},
+	})
+}
+
+// setTotalCount sets X-Total-Count to the number of companies matching query
+// (all companies if empty). Clients can skip the extra count with count=false.
+// It must run before the response header is written.
+func (s *Server) setTotalCount(ctx context.Context, w http.ResponseWriter, r *http.Request, query string) error {
+	if r.URL.Query().Get("count") == "false" {
+		return nil
+	}
+	total, err := s.batchProcessor.CountCompanies(ctx, query)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	return nil
+}
+
+// sendPageError maps an error from a paginated query to a response
+func (s *Server) sendPageError(w http.ResponseWriter, ctx context.Context, err error) {
+	if errors.Is(err, middleware.ErrInvalidCursor) {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid cursor",
+		})
+		return
+	}
+	s.sendServerError(w, ctx, "Failed to fetch companies", err)
+}
+
+// searchCompaniesHandler searches companies by name, one page at a time
+func (s *Server) searchCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Search query \"q\" is required",
+		})
+		return
+	}
+
+	limit, cursor, err := s.parsePageParams(r)
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	page, err := s.batchProcessor.SearchCompaniesByName(ctx, query, limit, cursor)
+	if err == nil {
+		err = s.setTotalCount(ctx, w, r, query)
+	}
+	if err != nil {
+		s.sendPageError(w, ctx, err)
+		return
+	}
+	s.sendPage(w, page)
+}
+
+// changedCompaniesHandler lists companies modified between the RFC 3339
+// timestamps in from and to (default now), one page at a time
+func (s *Server) changedCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "\"from\" must be an RFC 3339 timestamp",
+		})
+		return
+	}
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "\"to\" must be an RFC 3339 timestamp",
+			})
+			return
+		}
+	}
+	if from.After(to) {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "\"from\" must not be after \"to\"",
+		})
+		return
+	}
+
+	limit, cursor, err := s.parsePageParams(r)
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	page, err := s.batchProcessor.CompaniesChangedBetween(ctx, from, to, limit, cursor)
+	if err != nil {
+		s.sendPageError(w, ctx, err)
+		return
+	}
+	s.sendPage(w, page)
+}
+
+// incompleteCompaniesHandler lists companies without an address, one page at
+// a time, for data-quality checks
+func (s *Server) incompleteCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	limit, cursor, err := s.parsePageParams(r)
+	if err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	page, err := s.batchProcessor.CompaniesMissingAddress(ctx, limit, cursor)
+	if err != nil {
+		s.sendPageError(w, ctx, err)
+		return
+	}
+	s.sendPage(w, page)
+}
+
+// recentCompaniesHandler lists the most recently created companies, newest
+// first
+func (s *Server) recentCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	s.sendLimited(w, r, s.batchProcessor.RecentCompanies)
+}
+
+// recentlyTreatedHandler lists the companies most recently marked treated,
+// newest first
+func (s *Server) recentlyTreatedHandler(w http.ResponseWriter, r *http.Request) {
+	s.sendLimited(w, r, s.batchProcessor.RecentlyTreatedCompanies)
+}
+
+// autocompleteHandler lists the companies whose name starts with prefix, in
+// name order, limited like the newest-first listings
+func (s *Server) autocompleteHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Name prefix \"prefix\" is required",
+		})
+		return
+	}
+	s.sendLimited(w, r, func(ctx context.Context, limit int) ([]middleware.Company, error) {
+		return s.batchProcessor.CompaniesByNamePrefix(ctx, prefix, limit)
+	})
+}
+
+// nameLengthHandler lists the companies whose name length is between min
+// and max, inclusive, shortest first, or longest first with order=desc. min
+// defaults to 0 and an absent max to no upper bound.
+func (s *Server) nameLengthHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	bounds := make(map[string]int, 2)
+	for _, param := range []string{"min", "max"} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("%s must be a non-negative integer, got %q", param, value),
+			})
+			return
+		}
+		bounds[param] = n
+	}
+	if upper, ok := bounds["max"]; ok && (upper == 0 || bounds["min"] > upper) {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("max must be positive and at least min, got min %d and max %d", bounds["min"], upper),
+		})
+		return
+	}
+	var longest bool
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		longest = true
+	default:
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("order must be \"asc\" or \"desc\", got %q", order),
+		})
+		return
+	}
+
+	s.sendLimited(w, r, func(ctx context.Context, limit int) ([]middleware.Company, error) {
+		return s.batchProcessor.CompaniesByNameLength(ctx, bounds["min"], bounds["max"], longest, limit)
+	})
+}
+
+// sendLimited answers an unpaginated listing of up to limit companies from
+// fetch. limit defaults to DefaultPageSize and may not exceed MaxPageSize.
+func (s *Server) sendLimited(w http.ResponseWriter, r *http.Request, fetch func(context.Context, int) ([]middleware.Company, error)) {
+	limit := s.config.DefaultPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > s.config.MaxPageSize {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("limit must be between 1 and %d, got %q", s.config.MaxPageSize, value),
+			})
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	companies, err := fetch(ctx, limit)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to fetch companies", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Companies fetched successfully",
+		Data:    s.presentCompanies(companies),
+	})
+}
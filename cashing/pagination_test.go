@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"company-api/middleware"
+)
+
+func TestParsePageParams(t *testing.T) {
+	s := newTestServer(t, map[string]string{"DEFAULT_PAGE_SIZE": "20", "MAX_PAGE_SIZE": "50"})
+	tests := []struct {
+		query      string
+		wantLimit  int
+		wantCursor string
+		valid      bool
+	}{
+		{"", 20, "", true},
+		{"limit=5&cursor=QWNtZQ", 5, "QWNtZQ", true},
+		{"limit=0", 0, "", false},
+		{"limit=ten", 0, "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/companies?"+tt.query, nil)
+		limit, cursor, err := s.parsePageParams(r)
+		if (err == nil) != tt.valid || limit != tt.wantLimit || cursor != tt.wantCursor {
+			t.Errorf("parsePageParams(%q) = %d, %q, %v; want %d, %q, valid %v",
+				tt.query, limit, cursor, err, tt.wantLimit, tt.wantCursor, tt.valid)
+		}
+	}
+}
+
+func TestIsPaginated(t *testing.T) {
+	for query, want := range map[string]bool{"": false, "limit=5": true, "cursor=": true, "count=false": false} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/companies?"+query, nil)
+		if got := isPaginated(r); got != want {
+			t.Errorf("isPaginated(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestSearchRequiresQuery(t *testing.T) {
+	s := newTestServer(t, nil)
+	if w := serve(s, http.MethodGet, "/api/v1/companies/search", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("search without q answered %d, want 400", w.Code)
+	}
+}
+
+func TestAutocompleteValidation(t *testing.T) {
+	s := newTestServer(t, map[string]string{"MAX_PAGE_SIZE": "100"})
+	for _, target := range []string{
+		"/api/v1/companies/autocomplete",
+		"/api/v1/companies/autocomplete?prefix=",
+		"/api/v1/companies/autocomplete?prefix=Ac&limit=0",
+		"/api/v1/companies/autocomplete?prefix=Ac&limit=101",
+	} {
+		if w := serve(s, http.MethodGet, target, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s answered %d, want 400", target, w.Code)
+		}
+	}
+}
+
+func TestNameLengthValidation(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, query := range []string{"min=-1", "min=short", "max=0", "min=3&max=2", "order=random", "limit=0"} {
+		if w := serve(s, http.MethodGet, "/api/v1/companies/by-name-length?"+query, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /companies/by-name-length?%s answered %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestTotalCountHeader(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+	seed := []middleware.Company{{Name: "Acme"}, {Name: "Acme Europe"}, {Name: "Globex"}}
+	if _, err := s.batchProcessor.ProcessBatch(context.Background(), seed, middleware.BatchOptions{}); err != nil {
+		t.Fatalf("failed to seed companies: %v", err)
+	}
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/api/v1/companies", "3"},
+		{"/api/v1/companies?limit=1", "3"},
+		{"/api/v1/companies/search?q=acme&limit=1", "2"},
+		{"/api/v1/companies/search?q=acme&count=false", ""},
+	}
+	for _, tt := range tests {
+		w := serve(s, http.MethodGet, tt.target, "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s answered %d: %s", tt.target, w.Code, w.Body)
+		}
+		if got := w.Header().Get("X-Total-Count"); got != tt.want {
+			t.Errorf("GET %s: X-Total-Count = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestMaxListSize(t *testing.T) {
+	s := newStoreTestServer(t, map[string]string{"MAX_LIST_SIZE": "2"})
+	seed := []middleware.Company{{Name: "Acme"}, {Name: "Globex"}, {Name: "Initech"}}
+	if _, err := s.batchProcessor.ProcessBatch(context.Background(), seed, middleware.BatchOptions{}); err != nil {
+		t.Fatalf("failed to seed companies: %v", err)
+	}
+
+	w := serve(s, http.MethodGet, "/api/v1/companies", "", nil)
+	if w.Code != http.StatusRequestEntityTooLarge || w.Header().Get("X-Total-Count") != "3" {
+		t.Errorf("full list = %d with X-Total-Count %q, want 413 with 3", w.Code, w.Header().Get("X-Total-Count"))
+	}
+	if w := serve(s, http.MethodGet, "/api/v1/companies?limit=2", "", nil); w.Code != http.StatusOK {
+		t.Errorf("paginated list = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestParsePageParamsOversized(t *testing.T) {
+	tests := []struct {
+		policy    string
+		wantLimit int
+		valid     bool
+	}{
+		{"clamp", 50, true},
+		{"reject", 0, false},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t, map[string]string{"MAX_PAGE_SIZE": "50", "DEFAULT_PAGE_SIZE": "10", "PAGE_SIZE_POLICY": tt.policy})
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/companies?limit=51", nil)
+		limit, _, err := s.parsePageParams(r)
+		if (err == nil) != tt.valid || limit != tt.wantLimit {
+			t.Errorf("PAGE_SIZE_POLICY=%s: limit %d, %v; want %d, valid %v", tt.policy, limit, err, tt.wantLimit, tt.valid)
+		}
+	}
+}
+
+func TestChangedCompaniesValidation(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, query := range []string{
+		"",
+		"from=yesterday",
+		"from=2026-01-02T00:00:00Z&to=2026-01-01T00:00:00Z",
+		"from=2026-01-01T00:00:00Z&to=later",
+		"from=2026-01-01T00:00:00Z&limit=-1",
+	} {
+		if w := serve(s, http.MethodGet, "/api/v1/companies/changed?"+query, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /companies/changed?%s answered %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestSendLimitedValidatesLimit(t *testing.T) {
+	s := newTestServer(t, map[string]string{"DEFAULT_PAGE_SIZE": "10", "MAX_PAGE_SIZE": "50"})
+	for _, path := range []string{"/api/v1/companies/recent", "/api/v1/companies/recently-treated"} {
+		for _, limit := range []string{"0", "-1", "51", "many"} {
+			if w := serve(s, http.MethodGet, path+"?limit="+limit, "", nil); w.Code != http.StatusBadRequest {
+				t.Errorf("GET %s?limit=%s answered %d, want 400", path, limit, w.Code)
+			}
+		}
+	}
+}
+
+func TestIncompleteCompaniesValidatesLimit(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, limit := range []string{"0", "-1", "many"} {
+		if w := serve(s, http.MethodGet, "/api/v1/companies/incomplete?limit="+limit, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /companies/incomplete?limit=%s answered %d, want 400", limit, w.Code)
+		}
+	}
+}
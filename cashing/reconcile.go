@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ReconcileTreatedRequest is the body of a treated reconciliation request
+type ReconcileTreatedRequest struct {
+	Names []string `json:"names"`
+}
+
+// reconcileTreatedHandler reports which of the posted names are stored as
+// treated, which are stored untreated and which do not exist, for
+// reconciliation jobs comparing against an external record
+func (s *Server) reconcileTreatedHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReconcileTreatedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if len(req.Names) == 0 {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "No names provided",
+		})
+		return
+	}
+	if !s.checkWriteOps(w, len(req.Names)) {
+		return
+	}
+
+	ctx, cancel := withWriteTimeout(w, r, 30*time.Second)
+	defer cancel()
+
+	result, err := s.batchProcessor.ReconcileTreated(ctx, req.Names)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to reconcile treated companies", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Treated companies reconciled successfully",
+		Data:    result,
+	})
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReconcileTreatedValidation(t *testing.T) {
+	for name, body := range map[string]string{
+		"malformed": `{"names":`,
+		"no names":  `{"names":[]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			w := serve(s, http.MethodPost, "/api/v1/companies/reconcile-treated", body, nil)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
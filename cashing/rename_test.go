@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"company-api/middleware"
+)
+
+func TestRenameCompanyHandler(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+	seed := []middleware.Company{{Name: "Acme"}, {Name: "Globex"}}
+	if _, err := s.batchProcessor.ProcessBatch(context.Background(), seed, middleware.BatchOptions{}); err != nil {
+		t.Fatalf("failed to seed companies: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"missing name", `{"from":"Acme"}`, http.StatusBadRequest},
+		{"taken", `{"from":"Acme","to":"Globex"}`, http.StatusConflict},
+		{"unknown", `{"from":"Initech","to":"Initrode"}`, http.StatusNotFound},
+		{"renamed", `{"from":"Acme","to":"Acme Corp"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, http.MethodPost, "/api/v1/companies/rename", tt.body, nil)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAPIPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		target string
+		routed bool
+	}{
+		{"/v2", "/v2/companies/replace-all", true},
+		{"/v2", "/api/v1/companies/replace-all", false},
+		{"/", "/companies/replace-all", true},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t, map[string]string{"API_PREFIX": tt.prefix})
+		// With no API keys configured, the replace-all handler answers 403
+		w := serve(s, http.MethodPost, tt.target, `{}`, nil)
+		if routed := w.Code == http.StatusForbidden; routed != tt.routed {
+			t.Errorf("API_PREFIX=%s: POST %s answered %d, want routed %v", tt.prefix, tt.target, w.Code, tt.routed)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sampleCompaniesHandler returns a random sample of companies. size defaults
+// to DefaultPageSize and may not exceed MaxPageSize.
+func (s *Server) sampleCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	size := s.config.DefaultPageSize
+	if value := r.URL.Query().Get("size"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > s.config.MaxPageSize {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("size must be between 1 and %d, got %q", s.config.MaxPageSize, value),
+			})
+			return
+		}
+		size = n
+	}
+
+	ctx, cancel := withRequestTimeout(r, 10*time.Second)
+	defer cancel()
+
+	companies, err := s.batchProcessor.SampleCompanies(ctx, size)
+	if err != nil {
+		s.sendServerError(w, ctx, "Failed to sample companies", err)
+		return
+	}
+
+	s.sendResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Companies sampled successfully",
+		Data:    s.presentCompanies(companies),
+	})
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSampleCompaniesValidatesSize(t *testing.T) {
+	s := newTestServer(t, map[string]string{"DEFAULT_PAGE_SIZE": "10", "MAX_PAGE_SIZE": "50"})
+	for _, size := range []string{"0", "-3", "51", "some"} {
+		if w := serve(s, http.MethodGet, "/api/v1/companies/sample?size="+size, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /companies/sample?size=%s answered %d, want 400", size, w.Code)
+		}
+	}
+}
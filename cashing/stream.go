@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"company-api/middleware"
+)
+
+// streamFrame is a single line of a streamed batch upload response
+type streamFrame struct {
+	Type      string                  `json:"type"`
+	Processed int                     `json:"processed"`
+	Total     int                     `json:"total"`
+	Success   bool                    `json:"success,omitempty"`
+	Message   string                  `json:"message,omitempty"`
+	Result    *middleware.BatchResult `json:"result,omitempty"`
+}
+
+// streamBatchUpload processes a batch in the background and writes one JSON
+// line per progress update, followed by a final "result" frame. If the client
+// disconnects, the batch continues to completion without a listener.
+func (s *Server) streamBatchUpload(w http.ResponseWriter, r *http.Request, companies []middleware.Company, opts middleware.BatchOptions) {
+	total := len(companies)
+	progress := make(chan streamFrame, 16)
+	result := make(chan streamFrame, 1)
+
+	go func() {
+		// Detach from the request so the batch survives a disconnect; its
+		// deadline comes from StreamBatchTimeout instead
+		ctx := context.WithoutCancel(r.Context())
+		opts.Timeout = s.config.StreamBatchTimeout
+
+		opts.Progress = func(processed, total int) {
+			// Drop frames rather than stall the batch on a slow or absent reader
+			select {
+			case progress <- streamFrame{Type: "progress", Processed: processed, Total: total}:
+			default:
+			}
+		}
+		batchResult, err := s.batchProcessor.ProcessBatch(ctx, companies, opts)
+
+		frame := streamFrame{Type: "result", Total: total, Result: &batchResult}
+		switch {
+		case err != nil:
+			frame.Message = s.internalError("Failed to process batch", err)
+		case len(batchResult.Errors) > 0:
+			frame.Processed = total
+			frame.Message = fmt.Sprintf("Batch partially processed: %d companies failed", len(batchResult.Errors))
+		default:
+			frame.Processed = total
+			frame.Success = true
+			frame.Message = "Batch processed successfully"
+		}
+		result <- frame
+	}()
+
+	rc := http.NewResponseController(w)
+	// The server WriteTimeout is sized for regular requests, not long streams
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("Unable to clear write deadline for streamed batch", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	send := func(frame streamFrame) error {
+		if err := enc.Encode(frame); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if err := send(streamFrame{Type: "progress", Total: total}); err != nil {
+		slog.Info("Client left streamed batch", "total", total, "error", err)
+		return
+	}
+
+	for {
+		select {
+		case frame := <-progress:
+			if err := send(frame); err != nil {
+				slog.Info("Client left streamed batch", "total", total, "error", err)
+				return
+			}
+		case frame := <-result:
+			// Flush progress queued before the result so frames stay ordered
+			for len(progress) > 0 {
+				if err := send(<-progress); err != nil {
+					return
+				}
+			}
+			if err := send(frame); err != nil {
+				slog.Error("Error writing final frame for streamed batch", "error", err)
+			}
+			return
+		case <-r.Context().Done():
+			slog.Info("Client disconnected from streamed batch; continuing in background", "total", total)
+			return
+		}
+	}
+}
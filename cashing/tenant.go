@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"company-api/middleware"
+)
+
+// tenantMiddleware scopes the request to the tenant named by the {tenant}
+// path segment or the X-Tenant-ID header. Requests naming neither use the
+// default collection. Naming a tenant while MultiTenant is off is refused
+// rather than silently writing to the shared collection, as is naming a
+// tenant missing from the Tenants allowlist.
+func (s *Server) tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := mux.Vars(r)["tenant"]
+		header := r.Header.Get("X-Tenant-ID")
+		if tenant == "" {
+			tenant = header
+		} else if header != "" && header != tenant {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "X-Tenant-ID header does not match the tenant in the path",
+			})
+			return
+		}
+		if tenant == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !s.config.MultiTenant {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Multi-tenancy is not enabled",
+			})
+			return
+		}
+		tenant, err := middleware.ParseTenant(tenant)
+		if err != nil {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid tenant: " + err.Error(),
+			})
+			return
+		}
+		if !s.tenantAllowed(tenant) {
+			s.sendResponse(w, http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Unknown tenant: " + tenant,
+			})
+			return
+		}
+		ctx, _ := middleware.WithTenant(r.Context(), tenant)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tenantAllowed reports whether tenant is in the Tenants allowlist
+func (s *Server) tenantAllowed(tenant string) bool {
+	for _, allowed := range s.config.Tenants {
+		if tenant == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		multiTenant string
+		target      string
+		header      string
+		want        int
+	}{
+		{"no tenant", "false", "/companies", "", http.StatusOK},
+		{"path tenant", "true", "/tenants/acme/companies", "", http.StatusOK},
+		{"header tenant", "true", "/companies", "acme", http.StatusOK},
+		{"matching header", "true", "/tenants/acme/companies", "acme", http.StatusOK},
+		{"mismatched header", "true", "/tenants/acme/companies", "globex", http.StatusBadRequest},
+		{"invalid tenant", "true", "/tenants/acme.eu/companies", "", http.StatusBadRequest},
+		{"upper-case tenant", "true", "/tenants/ACME/companies", "", http.StatusOK},
+		{"unknown tenant", "true", "/tenants/initech/companies", "", http.StatusNotFound},
+		{"unknown header tenant", "true", "/companies", "initech", http.StatusNotFound},
+		{"multi-tenancy off", "false", "/tenants/acme/companies", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, map[string]string{"MULTI_TENANT": tt.multiTenant, "TENANTS": "acme,globex"})
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			router := mux.NewRouter()
+			router.Handle("/companies", s.tenantMiddleware(ok))
+			router.Handle("/tenants/{tenant}/companies", s.tenantMiddleware(ok))
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				r.Header.Set("X-Tenant-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
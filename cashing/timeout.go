@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"company-api/middleware"
+)
+
+// requestTimeoutKey is the context key for a client's X-Request-Timeout
+type requestTimeoutKey struct{}
+
+// requestTimeoutMiddleware reads the X-Request-Timeout header, a duration
+// such as "45s", which replaces the route's own timeout for clients that
+// know a request will take longer (or should give up sooner). Values above
+// MaxRequestTimeout are clamped to it; malformed or non-positive values are
+// answered with 400. The connection's write deadline is extended to match so
+// the response can still be sent.
+func (s *Server) requestTimeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get("X-Request-Timeout")
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			s.sendResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Invalid X-Request-Timeout header: want a positive duration such as \"30s\", got %q", value),
+			})
+			return
+		}
+		timeout = min(timeout, s.config.MaxRequestTimeout)
+
+		if timeout > serverWriteTimeout {
+			extendWriteDeadline(w, timeout)
+		}
+
+		ctx := context.WithValue(r.Context(), requestTimeoutKey{}, timeout)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestTimeout returns the client's clamped X-Request-Timeout if it sent
+// one, or fallback, the route's default
+func requestTimeout(r *http.Request, fallback time.Duration) time.Duration {
+	if override, ok := r.Context().Value(requestTimeoutKey{}).(time.Duration); ok {
+		return override
+	}
+	return fallback
+}
+
+// withRequestTimeout returns the context a handler runs its operation under:
+// r's context bounded by requestTimeout
+func withRequestTimeout(r *http.Request, fallback time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), requestTimeout(r, fallback))
+}
+
+// withWriteTimeout is withRequestTimeout for handlers whose default timeout
+// exceeds the server's WriteTimeout: it also extends the connection's write
+// deadline, so an operation that runs past WriteTimeout is still answered
+// instead of completing behind a dropped connection
+func withWriteTimeout(w http.ResponseWriter, r *http.Request, fallback time.Duration) (context.Context, context.CancelFunc) {
+	timeout := requestTimeout(r, fallback)
+	extendWriteDeadline(w, timeout)
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// extendWriteDeadline gives the response timeout, plus a margin for writing
+// it, from now
+func extendWriteDeadline(w http.ResponseWriter, timeout time.Duration) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Now().Add(timeout + 5*time.Second)); err != nil {
+		slog.Warn("Unable to extend write deadline", "error", err)
+	}
+}
+
+// statusClientClosedRequest is the nginx convention for a request the client
+// abandoned before the server could answer
+const statusClientClosedRequest = 499
+
+// errorStatus maps a failed operation to a response status. Errors caused by
+// ctx running out of time become 504 and client cancellations 499, so that
+// slow-database timeouts are not counted as server errors; transient failures
+// that outlasted their retries, as in a failover, become 503. The store wraps
+// errors without preserving the chain, so ctx itself is consulted as well.
+func errorStatus(ctx context.Context, err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		return statusClientClosedRequest
+	case errors.Is(err, middleware.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errorMessage describes err for a response under status, naming timeouts
+// plainly rather than echoing the driver's wrapped context error
+func (s *Server) errorMessage(status int, action string, err error) string {
+	switch status {
+	case http.StatusGatewayTimeout:
+		return action + ": timed out waiting for the database"
+	case statusClientClosedRequest:
+		return action + ": request canceled"
+	default:
+		// A client error describes the client's input, not our internals
+		if status < http.StatusInternalServerError {
+			return action + ": " + err.Error()
+		}
+		return s.internalError(action, err)
+	}
+}
+
+// internalError describes an unexpected failure for a client. With
+// ErrorDetail off only action is returned and err, which may carry database
+// internals, is logged instead.
+func (s *Server) internalError(action string, err error) string {
+	if s.config.ErrorDetail {
+		return action + ": " + err.Error()
+	}
+	slog.Error(action, "error", err)
+	return action
+}
+
+// sendServerError answers a failed operation with 504, 503, 499 or 500 as
+// errorStatus decides. action describes what failed, e.g. "Failed to fetch
+// companies".
+func (s *Server) sendServerError(w http.ResponseWriter, ctx context.Context, action string, err error) {
+	status := errorStatus(ctx, err)
+	if status == http.StatusServiceUnavailable {
+		// A failover usually completes within seconds
+		w.Header().Set("Retry-After", "1")
+	}
+	s.sendResponse(w, status, APIResponse{
+		Success: false,
+		Message: s.errorMessage(status, action, err),
+	})
+}
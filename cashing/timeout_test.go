@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"company-api/middleware"
+)
+
+func TestErrorStatus(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want int
+	}{
+		{"deadline", expired, errors.New("failed to fetch companies: context deadline exceeded"), http.StatusGatewayTimeout},
+		{"canceled", canceled, errors.New("failed to fetch companies"), statusClientClosedRequest},
+		{"unavailable", context.Background(), fmt.Errorf("%w: failed to process batch: pool cleared", middleware.ErrUnavailable), http.StatusServiceUnavailable},
+		{"other", context.Background(), errors.New("failed to process batch"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorStatus(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("errorStatus = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendServerErrorTimeouts(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		want    int
+		message string
+	}{
+		{"timed out", expired, http.StatusGatewayTimeout, "Failed to fetch companies: timed out waiting for the database"},
+		{"canceled", canceled, statusClientClosedRequest, "Failed to fetch companies: request canceled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			w := httptest.NewRecorder()
+			s.sendServerError(w, tt.ctx, "Failed to fetch companies", errors.New("connection(localhost:27017) read: context done"))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if !strings.Contains(w.Body.String(), tt.message) || strings.Contains(w.Body.String(), "27017") {
+				t.Errorf("body = %s, want %q without the driver error", w.Body, tt.message)
+			}
+		})
+	}
+}
+
+func TestSendServerErrorDetail(t *testing.T) {
+	tests := []struct {
+		name      string
+		detail    string
+		wantInMsg bool
+	}{
+		{"dev", "true", true},
+		{"prod", "false", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			previous := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+			t.Cleanup(func() { slog.SetDefault(previous) })
+
+			s := newTestServer(t, map[string]string{"ERROR_DETAIL": tt.detail})
+			w := httptest.NewRecorder()
+			err := errors.New("failed to fetch companies: (Unauthorized) command find requires authentication")
+			s.sendServerError(w, context.Background(), "Failed to fetch companies", err)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want 500", w.Code)
+			}
+			if got := strings.Contains(w.Body.String(), "requires authentication"); got != tt.wantInMsg {
+				t.Errorf("body = %s, want detail included: %v", w.Body, tt.wantInMsg)
+			}
+			if !tt.wantInMsg && !strings.Contains(buf.String(), "requires authentication") {
+				t.Errorf("hidden error was not logged: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestErrorMessageClientErrors(t *testing.T) {
+	s := newTestServer(t, map[string]string{"ERROR_DETAIL": "false"})
+	got := s.errorMessage(http.StatusBadRequest, "Failed to save company", errors.New("name is required"))
+	if got != "Failed to save company: name is required" {
+		t.Errorf("errorMessage = %q, want the client error kept", got)
+	}
+}
+
+func TestSendServerErrorRetryAfter(t *testing.T) {
+	s := newTestServer(t, nil)
+	w := httptest.NewRecorder()
+	err := fmt.Errorf("%w: failed to process batch", middleware.ErrUnavailable)
+	s.sendServerError(w, context.Background(), "Failed to process batch", err)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want \"1\"", got)
+	}
+}
+
+func TestRequestTimeoutHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		status int
+		want   time.Duration
+	}{
+		{"no header", "", http.StatusOK, 30 * time.Second},
+		{"extended", "45s", http.StatusOK, 45 * time.Second},
+		{"shortened", "2s", http.StatusOK, 2 * time.Second},
+		{"clamped", "10m", http.StatusOK, time.Minute},
+		{"malformed", "soon", http.StatusBadRequest, 0},
+		{"negative", "-5s", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, map[string]string{"MAX_REQUEST_TIMEOUT": "1m"})
+			var got, remaining time.Duration
+			handler := s.requestTimeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = requestTimeout(r, 30*time.Second)
+				ctx, cancel := withRequestTimeout(r, 30*time.Second)
+				defer cancel()
+				deadline, _ := ctx.Deadline()
+				remaining = time.Until(deadline)
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/companies/batch", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-Timeout", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got != tt.want {
+				t.Errorf("timeout = %v, want %v", got, tt.want)
+			}
+			if tt.want > 0 && (remaining > tt.want || remaining < tt.want-time.Second) {
+				t.Errorf("context deadline is %v away, want about %v", remaining, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithWriteTimeoutExtendsDeadline(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := withWriteTimeout(w, r, time.Second)
+		defer cancel()
+		// Outlast the server's WriteTimeout, as a slow database operation would
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+		}
+		w.Write([]byte("done"))
+	}))
+	ts.Config.WriteTimeout = 50 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "done" {
+		t.Errorf("body = %q, %v; want the response written after WriteTimeout", body, err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"company-api/middleware"
+)
+
+func TestSetTreatedHandler(t *testing.T) {
+	s := newStoreTestServer(t, nil)
+	if _, err := s.batchProcessor.ProcessBatch(context.Background(), []middleware.Company{{Name: "Acme Corp"}}, middleware.BatchOptions{}); err != nil {
+		t.Fatalf("failed to seed companies: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		want        int
+		wantTreated bool
+	}{
+		{"default treats", "/api/v1/companies/Acme%20Corp/treated", ``, http.StatusOK, true},
+		{"untreat", "/api/v1/companies/Acme%20Corp/treated", `{"treated":false}`, http.StatusOK, false},
+		{"unknown company", "/api/v1/companies/Globex/treated", `{"treated":true}`, http.StatusNotFound, false},
+		{"invalid body", "/api/v1/companies/Acme%20Corp/treated", `{"treated":`, http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, http.MethodPut, tt.target, tt.body, nil)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			company, err := s.batchProcessor.GetCompany(context.Background(), "Acme Corp")
+			if err != nil {
+				t.Fatalf("GetCompany failed: %v", err)
+			}
+			if company.Treated != tt.wantTreated {
+				t.Errorf("treated = %v, want %v", company.Treated, tt.wantTreated)
+			}
+		})
+	}
+}
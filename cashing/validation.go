@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"company-api/middleware"
+)
+
+// codeValidationFailed marks a response whose errors list the invalid fields
+const codeValidationFailed = "VALIDATION_FAILED"
+
+// sendValidationError answers 400 for a request that failed validation. A
+// *middleware.ValidationError is rendered with code VALIDATION_FAILED and one
+// entry per invalid field; any other error becomes the message.
+func (s *Server) sendValidationError(w http.ResponseWriter, message string, err error) {
+	var invalid *middleware.ValidationError
+	if !errors.As(err, &invalid) {
+		s.sendResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: message + ": " + err.Error(),
+		})
+		return
+	}
+	s.sendResponse(w, http.StatusBadRequest, APIResponse{
+		Success: false,
+		Message: message,
+		Code:    codeValidationFailed,
+		Errors:  invalid.Fields,
+	})
+}
+
+// validateCompanies validates every company, returning a single
+// *middleware.ValidationError whose fields are prefixed with the company's
+// position in list, e.g. companies[3].metadata.a.b
+func validateCompanies(list string, companies []middleware.Company) error {
+	combined := &middleware.ValidationError{}
+	for i, company := range companies {
+		err := company.Validate()
+		var invalid *middleware.ValidationError
+		if !errors.As(err, &invalid) {
+			continue
+		}
+		for _, field := range invalid.Fields {
+			field.Field = fmt.Sprintf("%s[%d].%s", list, i, field.Field)
+			combined.Fields = append(combined.Fields, field)
+		}
+	}
+	if len(combined.Fields) == 0 {
+		return nil
+	}
+	return combined
+}
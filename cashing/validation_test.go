@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"company-api/middleware"
+)
+
+func TestValidateCompanies(t *testing.T) {
+	companies := []middleware.Company{
+		{Name: "Acme"},
+		{Metadata: map[string]interface{}{"a.b": 1}},
+		{Name: "Initech"},
+	}
+	err := validateCompanies("companies", companies)
+	var invalid *middleware.ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("validateCompanies = %v, want a *middleware.ValidationError", err)
+	}
+	var fields []string
+	for _, field := range invalid.Fields {
+		fields = append(fields, field.Field)
+	}
+	if want := []string{"companies[1].name", "companies[1].metadata.a.b"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+
+	if err := validateCompanies("companies", companies[:1]); err != nil {
+		t.Errorf("validateCompanies of valid companies = %v", err)
+	}
+}
+
+func TestSendValidationError(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	w := httptest.NewRecorder()
+	s.sendValidationError(w, "Invalid companies", validateCompanies("companies", []middleware.Company{{}}))
+	var resp APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusBadRequest || resp.Code != codeValidationFailed || len(resp.Errors) != 1 || resp.Errors[0].Field != "companies[0].name" {
+		t.Errorf("response = %d %+v, want 400 VALIDATION_FAILED naming companies[0].name", w.Code, resp)
+	}
+
+	w = httptest.NewRecorder()
+	s.sendValidationError(w, "Invalid company", errors.New("unexpected EOF"))
+	resp = APIResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Code != "" || resp.Message != "Invalid company: unexpected EOF" {
+		t.Errorf("response = %+v, want the plain error as the message", resp)
+	}
+}
+
+func TestBatchUploadValidationFailed(t *testing.T) {
+	s := newTestServer(t, nil)
+	w := serve(s, http.MethodPost, "/api/v1/companies/batch", `{"companies":[{"name":"Acme"},{"name":"","metadata":{"$x":1}}]}`, nil)
+	var resp APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusBadRequest || resp.Code != codeValidationFailed || len(resp.Errors) != 2 {
+		t.Errorf("response = %d %+v, want 400 VALIDATION_FAILED with two fields", w.Code, resp)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"time"
+
+	"company-api/middleware"
+)
+
+// CompanyView is the public representation of a company. It carries only the
+// fields API consumers are meant to see, independent of the stored document.
+type CompanyView struct {
+	Name     string                 `json:"name"`
+	Address  string                 `json:"address"`
+	Treated  bool                   `json:"treated"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Seen     int                    `json:"seen"`
+	Source   string                 `json:"source,omitempty"`
+	// TreatedAt is set while the company is treated
+	TreatedAt *time.Time `json:"treated_at,omitempty"`
+}
+
+// newCompanyView maps a stored company to its public view
+func newCompanyView(c middleware.Company) CompanyView {
+	view := CompanyView{
+		Name:     c.Name,
+		Address:  c.Address,
+		Treated:  c.Treated,
+		Metadata: c.Metadata,
+		Seen:     c.Seen,
+		Source:   c.Source,
+	}
+	if !c.TreatedAt.IsZero() {
+		view.TreatedAt = &c.TreatedAt
+	}
+	return view
+}
+
+// presentCompanies returns companies in the configured response shape:
+// public views, or the full documents when PublicView is off
+func (s *Server) presentCompanies(companies []middleware.Company) interface{} {
+	if !s.config.PublicView {
+		return companies
+	}
+	views := make([]CompanyView, len(companies))
+	for i, c := range companies {
+		views[i] = newCompanyView(c)
+	}
+	return views
+}
+
+// presentCompany returns a single company in the configured response shape
+func (s *Server) presentCompany(c middleware.Company) interface{} {
+	if !s.config.PublicView {
+		return c
+	}
+	return newCompanyView(c)
+}
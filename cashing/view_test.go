@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"company-api/middleware"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPresentCompany(t *testing.T) {
+	company := middleware.Company{
+		ID:      primitive.NewObjectID(),
+		Name:    "Acme",
+		Treated: true,
+	}
+	tests := []struct {
+		publicView string
+		wantID     bool
+	}{
+		{"true", false},
+		{"false", true},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t, map[string]string{"PUBLIC_VIEW": tt.publicView})
+		data, err := json.Marshal(s.presentCompanies([]middleware.Company{company}))
+		if err != nil {
+			t.Fatalf("failed to encode companies: %v", err)
+		}
+		if hasID := strings.Contains(string(data), `"id"`); hasID != tt.wantID {
+			t.Errorf("PUBLIC_VIEW=%s: %s, want id included %v", tt.publicView, data, tt.wantID)
+		}
+	}
+}
+
+func TestNewCompanyViewTreatedAt(t *testing.T) {
+	if view := newCompanyView(middleware.Company{Name: "Acme"}); view.TreatedAt != nil {
+		t.Errorf("TreatedAt = %v for an untreated company, want nil", view.TreatedAt)
+	}
+	treatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	view := newCompanyView(middleware.Company{Name: "Acme", Treated: true, TreatedAt: treatedAt})
+	if view.TreatedAt == nil || !view.TreatedAt.Equal(treatedAt) {
+		t.Errorf("TreatedAt = %v, want %v", view.TreatedAt, treatedAt)
+	}
+}
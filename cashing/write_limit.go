@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"company-api/middleware"
+)
+
+// checkWriteOps answers 413 and returns false if a request would generate
+// more than MaxWriteOps database writes. The body size limit bounds bytes,
+// not work: small companies can still pack millions of upserts into one
+// request and occupy the workers for minutes.
+func (s *Server) checkWriteOps(w http.ResponseWriter, ops int) bool {
+	if s.config.MaxWriteOps == 0 || ops <= s.config.MaxWriteOps {
+		return true
+	}
+	s.sendResponse(w, http.StatusRequestEntityTooLarge, APIResponse{
+		Success: false,
+		Message: fmt.Sprintf("%d write operations exceed the limit of %d per request; split the upload", ops, s.config.MaxWriteOps),
+	})
+	return false
+}
+
+// limitWriteOps ends next after max companies, so a streamed import stops at
+// the cap with exactly the first max companies written, and sets *exceeded
+// if the stream held more. A stream cannot be counted before it is written,
+// so unlike checkWriteOps this does not reject the request outright.
+func limitWriteOps(next middleware.CompanySource, max int, exceeded *bool) middleware.CompanySource {
+	if max == 0 {
+		return next
+	}
+	read := 0
+	return func() (middleware.Company, error) {
+		if read == max {
+			// Anything but the end of the stream, even a malformed line, is
+			// past the cap
+			if _, err := next(); !errors.Is(err, io.EOF) {
+				*exceeded = true
+			}
+			return middleware.Company{}, io.EOF
+		}
+		read++
+		return next()
+	}
+}
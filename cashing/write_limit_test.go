@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"company-api/middleware"
+)
+
+// sliceSource yields companies and then err
+func sliceSource(companies []middleware.Company, err error) middleware.CompanySource {
+	return func() (middleware.Company, error) {
+		if len(companies) == 0 {
+			return middleware.Company{}, err
+		}
+		company := companies[0]
+		companies = companies[1:]
+		return company, nil
+	}
+}
+
+func TestLimitWriteOps(t *testing.T) {
+	three := []middleware.Company{{Name: "Acme"}, {Name: "Globex"}, {Name: "Initech"}}
+	tests := []struct {
+		name         string
+		max          int
+		tail         error
+		wantRead     int
+		wantExceeded bool
+	}{
+		{"under the cap", 5, io.EOF, 3, false},
+		{"at the cap", 3, io.EOF, 3, false},
+		{"over the cap", 2, io.EOF, 2, true},
+		{"malformed line past the cap", 3, errors.New("invalid character"), 3, true},
+		{"disabled", 0, io.EOF, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var exceeded bool
+			source := limitWriteOps(sliceSource(three, tt.tail), tt.max, &exceeded)
+			read := 0
+			for {
+				_, err := source()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				read++
+			}
+			if read != tt.wantRead || exceeded != tt.wantExceeded {
+				t.Errorf("read %d companies, exceeded %v; want %d, %v", read, exceeded, tt.wantRead, tt.wantExceeded)
+			}
+		})
+	}
+}
+
+func TestCheckWriteOps(t *testing.T) {
+	s := newTestServer(t, map[string]string{"MAX_WRITE_OPS": "2"})
+	for ops, want := range map[int]bool{1: true, 2: true, 3: false} {
+		w := httptest.NewRecorder()
+		if got := s.checkWriteOps(w, ops); got != want {
+			t.Errorf("checkWriteOps(%d) = %v, want %v", ops, got, want)
+		}
+		if !want && w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("checkWriteOps(%d) answered %d, want 413", ops, w.Code)
+		}
+	}
+}
+
+func TestBatchUploadOverWriteCap(t *testing.T) {
+	s := newTestServer(t, map[string]string{"MAX_WRITE_OPS": "2"})
+	body := `{"companies":[{"name":"Acme"},{"name":"Globex"},{"name":"Initech"}]}`
+	w := serve(s, http.MethodPost, "/api/v1/companies/batch", body, nil)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413: %s", w.Code, w.Body)
+	}
+}
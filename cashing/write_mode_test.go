@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBatchUploadRejectsBadMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+	}{
+		{"unknown mode", "/api/v1/companies/batch?mode=replace", nil},
+		{"conflict strategy with insert", "/api/v1/companies/batch?mode=insert", http.Header{"X-Conflict-Strategy": {"skip"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			w := serve(s, http.MethodPost, tt.target, `{"companies":[{"name":"Acme"}]}`, tt.header)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid mode") {
+				t.Errorf("response = %d %s, want %d for the mode", w.Code, w.Body, http.StatusBadRequest)
+			}
+		})
+	}
+}